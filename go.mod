@@ -1,6 +1,6 @@
 module github.com/johnietre/commands
 
-go 1.18
+go 1.20
 
 require (
 	github.com/BurntSushi/toml v1.3.2
@@ -8,15 +8,16 @@ require (
 	github.com/johnietre/utils/go v0.0.0-20240712084910-4fb386379ba6
 	github.com/mattn/go-sqlite3 v1.14.9
 	github.com/spf13/cobra v1.8.0
+	github.com/spf13/pflag v1.0.5
 	golang.org/x/crypto v0.7.0
 	golang.org/x/net v0.8.0
+	golang.org/x/sys v0.6.0
 	golang.org/x/term v0.6.0
+	gopkg.in/yaml.v3 v3.0.1
 	nhooyr.io/websocket v1.8.11
 )
 
 require (
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
 	github.com/klauspost/compress v1.10.3 // indirect
-	github.com/spf13/pflag v1.0.5 // indirect
-	golang.org/x/sys v0.6.0 // indirect
 )
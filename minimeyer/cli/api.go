@@ -0,0 +1,326 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Prefix of the REST API paths. The API is served alongside the websocket
+// protocol and uses the same App methods:
+//
+//	GET    /api/v1/procs                 list the processes
+//	POST   /api/v1/procs                 add (and start) a process or an array
+//	                                     of processes (?start=false to only add)
+//	GET    /api/v1/procs/{num}           get a process
+//	DELETE /api/v1/procs/{num}           kill and remove a process
+//	POST   /api/v1/procs/{num}/start     start a process
+//	POST   /api/v1/procs/{num}/stop      stop a process and wait for it to exit
+//	                                     (?method=kill or ?method=interrupt)
+//	POST   /api/v1/procs/{num}/restart   restart a process (same ?method)
+//	GET    /api/v1/procs/{num}/logs      get the captured output (?tail=N)
+//
+// {num} may also be the name of the process. Errors are returned as
+// {"error": "..."} with the appropriate status code. If the web server has a
+// password, requests are authenticated by requireAuth.
+//
+// Since a browser will send requests to the API for any site (with the
+// session cookie), requests that change anything are rejected if they come
+// from another site (by their Origin or Sec-Fetch-Site header) or if they
+// have a body that isn't JSON (Content-Type: application/json).
+const apiPrefix = "/api/v1/"
+
+// Max size of request bodies
+const maxAPIBodySize = 1 << 20
+
+// Body of errors returned by the API
+type APIError struct {
+	Error string `json:"error"`
+}
+
+// Response to adding processes with the API
+type APIAddResponse struct {
+	Processes []*Process `json:"processes"`
+	// Errors starting the processes (they're still added)
+	Errors []string `json:"errors,omitempty"`
+}
+
+func apiHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		if err := checkSameSite(r); err != nil {
+			apiError(w, http.StatusForbidden, err.Error())
+			return
+		}
+	}
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, apiPrefix), "/")
+	parts := strings.Split(path, "/")
+	if parts[0] != "procs" {
+		apiError(w, http.StatusNotFound, "not found: "+r.URL.Path)
+		return
+	}
+	switch len(parts) {
+	case 1:
+		switch r.Method {
+		case http.MethodGet:
+			apiListProcs(w, r)
+		case http.MethodPost:
+			apiAddProcs(w, r)
+		default:
+			apiMethodNotAllowed(w, http.MethodGet, http.MethodPost)
+		}
+		return
+	case 2, 3:
+	default:
+		apiError(w, http.StatusNotFound, "not found: "+r.URL.Path)
+		return
+	}
+
+	proc := apiGetProc(parts[1])
+	if proc == nil {
+		apiError(w, http.StatusNotFound, "no process: "+parts[1])
+		return
+	}
+	if r.Method != http.MethodGet && r.Header.Get("Content-Type") != "" &&
+		!isJSONContentType(r) {
+		// The actions on a process don't take a body
+		apiError(
+			w, http.StatusUnsupportedMediaType,
+			"Content-Type must be application/json",
+		)
+		return
+	}
+	if len(parts) == 2 {
+		switch r.Method {
+		case http.MethodGet:
+			apiJSON(w, http.StatusOK, proc)
+		case http.MethodDelete:
+			app.BulkAction(ActionDel, []*Process{proc})
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			apiMethodNotAllowed(w, http.MethodGet, http.MethodDelete)
+		}
+		return
+	}
+	switch parts[2] {
+	case "start", "stop", "restart":
+		if r.Method != http.MethodPost {
+			apiMethodNotAllowed(w, http.MethodPost)
+			return
+		}
+		apiProcAction(w, r, proc, parts[2])
+	case "logs":
+		if r.Method != http.MethodGet {
+			apiMethodNotAllowed(w, http.MethodGet)
+			return
+		}
+		apiProcLogs(w, r, proc)
+	default:
+		apiError(w, http.StatusNotFound, "not found: "+r.URL.Path)
+	}
+}
+
+// Gets a process by number or, if s isn't a number, name
+func apiGetProc(s string) *Process {
+	if num, err := strconv.Atoi(s); err == nil {
+		return app.GetProcByNum(num)
+	}
+	return app.GetProcByName(s)
+}
+
+func apiListProcs(w http.ResponseWriter, r *http.Request) {
+	procs := app.procsSnapshot()
+	if procs == nil {
+		procs = []*Process{}
+	}
+	apiJSON(w, http.StatusOK, procs)
+}
+
+// Returns an error if the request was made by a page from another site.
+// Browsers send Sec-Fetch-Site (newer ones) and Origin with such requests;
+// requests with neither (e.g., from curl) aren't from a browser.
+func checkSameSite(r *http.Request) error {
+	switch site := r.Header.Get("Sec-Fetch-Site"); site {
+	case "", "same-origin", "none":
+	default:
+		return fmt.Errorf("cross-site request rejected (Sec-Fetch-Site: %s)", site)
+	}
+	if origin := r.Header.Get("Origin"); origin != "" {
+		// "null" for some requests (e.g., from sandboxed pages) has no host
+		if u, err := url.Parse(origin); err != nil || u.Host != r.Host {
+			return fmt.Errorf("cross-origin request rejected (Origin: %s)", origin)
+		}
+	}
+	return nil
+}
+
+// Returns true if the request's body is JSON
+func isJSONContentType(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == "application/json"
+}
+
+// Adds the process or array of processes in the body. Nothing is added if any
+// of them are invalid.
+func apiAddProcs(w http.ResponseWriter, r *http.Request) {
+	if !isJSONContentType(r) {
+		apiError(
+			w, http.StatusUnsupportedMediaType,
+			"Content-Type must be application/json",
+		)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxAPIBodySize))
+	if err != nil {
+		apiError(w, http.StatusBadRequest, "error reading body: "+err.Error())
+		return
+	}
+	var procs []*Process
+	if body = bytes.TrimSpace(body); len(body) != 0 && body[0] == '[' {
+		err = json.Unmarshal(body, &procs)
+	} else {
+		proc := &Process{}
+		err = json.Unmarshal(body, proc)
+		procs = append(procs, proc)
+	}
+	if err != nil {
+		apiError(w, http.StatusBadRequest, "invalid process: "+err.Error())
+		return
+	} else if len(procs) == 0 {
+		apiError(w, http.StatusBadRequest, "no processes given")
+		return
+	}
+	start := true
+	if s := r.URL.Query().Get("start"); s != "" {
+		if start, err = strconv.ParseBool(s); err != nil {
+			apiError(w, http.StatusBadRequest, "invalid start: "+s)
+			return
+		}
+	}
+
+	names := make(map[string]bool, len(procs))
+	for _, proc := range procs {
+		if proc == nil {
+			apiError(w, http.StatusBadRequest, "invalid process: null")
+			return
+		} else if err := proc.validate(); err != nil {
+			apiError(w, http.StatusBadRequest, err.Error())
+			return
+		} else if names[proc.Name] || app.GetProcByName(proc.Name) != nil {
+			apiError(
+				w, http.StatusConflict, "process name in use: "+proc.Name,
+			)
+			return
+		} else if err := app.checkDeps(proc, procs...); err != nil {
+			apiError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		names[proc.Name] = true
+	}
+	// Added (and started) after their dependencies
+	if procs, err = app.sortBatchByDeps(procs); err != nil {
+		apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	resp := APIAddResponse{Processes: procs}
+	for _, proc := range procs {
+		app.AddRuntimeProc(proc)
+	}
+	for _, proc := range procs {
+		if !start || proc.Schedule != "" {
+			// Scheduled processes are started by their schedule
+			continue
+		}
+		if err := proc.Start(); err != nil {
+			resp.Errors = append(
+				resp.Errors,
+				fmt.Sprintf("error starting process %s: %v", proc.Name, err),
+			)
+		}
+	}
+	apiJSON(w, http.StatusCreated, resp)
+}
+
+// Starts, stops, or restarts the process, responding with the process once
+// done
+func apiProcAction(
+	w http.ResponseWriter, r *http.Request, proc *Process, action string,
+) {
+	stop := (*Process).stop
+	switch method := r.URL.Query().Get("method"); method {
+	case "", "stop":
+	case "kill":
+		stop = (*Process).kill
+	case "interrupt":
+		stop = (*Process).interruptStop
+	default:
+		apiError(w, http.StatusBadRequest, "invalid method: "+method)
+		return
+	}
+	var err error
+	errPrefix := "error starting process: "
+	switch action {
+	case "start":
+		err = proc.Start()
+	case "stop":
+		if !isRunningStatus(proc.status.Load()) {
+			apiError(w, http.StatusConflict, "process not running")
+			return
+		}
+		errPrefix = "error stopping process: "
+		if err = stop(proc); err == nil {
+			proc.waitExit()
+		}
+	case "restart":
+		errPrefix = "error restarting process: "
+		err = proc.restart(stop)
+	}
+	if err == errProcRunning {
+		apiError(w, http.StatusConflict, err.Error())
+		return
+	} else if err != nil {
+		apiError(w, http.StatusInternalServerError, errPrefix+err.Error())
+		return
+	}
+	apiJSON(w, http.StatusOK, proc)
+}
+
+func apiProcLogs(w http.ResponseWriter, r *http.Request, proc *Process) {
+	tail := 0
+	if s := r.URL.Query().Get("tail"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			apiError(w, http.StatusBadRequest, "invalid tail: "+s)
+			return
+		}
+		tail = n
+	}
+	lines := proc.logBuffer().Tail(tail)
+	apiJSON(w, http.StatusOK, LogsContent{Num: proc.Num, Lines: lines})
+}
+
+func apiMethodNotAllowed(w http.ResponseWriter, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	apiError(w, http.StatusMethodNotAllowed, "method not allowed")
+}
+
+func apiError(w http.ResponseWriter, code int, msg string) {
+	apiJSON(w, code, APIError{Error: msg})
+}
+
+func apiJSON(w http.ResponseWriter, code int, v any) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		code = http.StatusInternalServerError
+		b, _ = json.Marshal(APIError{Error: "internal server error: " + err.Error()})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(append(b, '\n'))
+}
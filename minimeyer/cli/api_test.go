@@ -0,0 +1,171 @@
+package cli
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Sends the request to the API, returning the response
+func apiRequest(
+	t *testing.T, method, target, body string, header ...string,
+) *httptest.ResponseRecorder {
+	t.Helper()
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	for i := 0; i+1 < len(header); i += 2 {
+		r.Header.Set(header[i], header[i+1])
+	}
+	w := httptest.NewRecorder()
+	apiHandler(w, r)
+	return w
+}
+
+func checkAPIStatus(t *testing.T, w *httptest.ResponseRecorder, want int) {
+	t.Helper()
+	if w.Code != want {
+		t.Errorf("got status %d, want %d: %s", w.Code, want, w.Body)
+	} else if ct := w.Header().Get("Content-Type"); want != http.StatusNoContent &&
+		ct != "application/json" {
+		t.Errorf("got Content-Type %q", ct)
+	}
+}
+
+func TestAPI(t *testing.T) {
+	defer func(old *App) { app = old }(app)
+	app = NewApp()
+	defer app.StopProcs((*Process).kill)
+
+	const jsonType = "application/json"
+	w := apiRequest(t, http.MethodGet, "/api/v1/procs", "")
+	checkAPIStatus(t, w, http.StatusOK)
+	if body := strings.TrimSpace(w.Body.String()); body != "[]" {
+		t.Errorf("expected no processes, got %s", body)
+	}
+
+	body := `[{"name": "b", "program": "sleep", "args": ["10"], "dependsOn": ["a"]},
+		{"name": "a", "program": "sleep", "args": ["10"]}]`
+	w = apiRequest(t, http.MethodPost, "/api/v1/procs?start=false", body)
+	checkAPIStatus(t, w, http.StatusUnsupportedMediaType)
+	w = apiRequest(
+		t, http.MethodPost, "/api/v1/procs?start=false", body,
+		"Content-Type", jsonType+"; charset=utf-8",
+	)
+	checkAPIStatus(t, w, http.StatusCreated)
+	var added APIAddResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &added); err != nil {
+		t.Fatalf("error decoding response: %v", err)
+	} else if names := procNames(added.Processes); names != "a,b" {
+		t.Errorf("expected processes added in order a,b, got %s", names)
+	}
+	w = apiRequest(
+		t, http.MethodPost, "/api/v1/procs", `{"name": "a", "program": "x"}`,
+		"Content-Type", jsonType,
+	)
+	checkAPIStatus(t, w, http.StatusConflict)
+	w = apiRequest(
+		t, http.MethodPost, "/api/v1/procs", `{"name": "c"}`,
+		"Content-Type", jsonType,
+	)
+	checkAPIStatus(t, w, http.StatusBadRequest)
+
+	tests := []struct {
+		method, target string
+		want           int
+	}{
+		{http.MethodGet, "/api/v1/procs/a", http.StatusOK},
+		{http.MethodGet, "/api/v1/procs/1", http.StatusOK},
+		{http.MethodGet, "/api/v1/procs/x", http.StatusNotFound},
+		{http.MethodGet, "/api/v1/other", http.StatusNotFound},
+		{http.MethodGet, "/api/v1/procs/a/other", http.StatusNotFound},
+		{http.MethodGet, "/api/v1/procs/a/logs/x", http.StatusNotFound},
+		{http.MethodPut, "/api/v1/procs", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/api/v1/procs/a", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/api/v1/procs/a/start", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/api/v1/procs/a/logs?tail=x", http.StatusBadRequest},
+		{http.MethodGet, "/api/v1/procs/a/logs?tail=5", http.StatusOK},
+		{http.MethodPost, "/api/v1/procs/a/stop", http.StatusConflict},
+		{http.MethodPost, "/api/v1/procs/a/start?method=x", http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		w := apiRequest(t, test.method, test.target, "")
+		if w.Code != test.want {
+			t.Errorf(
+				"%s %s: got status %d, want %d: %s",
+				test.method, test.target, w.Code, test.want, w.Body,
+			)
+		}
+	}
+	w = apiRequest(t, http.MethodPut, "/api/v1/procs", "")
+	if allow := w.Header().Get("Allow"); allow != "GET, POST" {
+		t.Errorf("got Allow %q, want %q", allow, "GET, POST")
+	}
+
+	// Actions don't take a body, but a JSON one (e.g., {}) is allowed
+	w = apiRequest(
+		t, http.MethodPost, "/api/v1/procs/a/start", "a",
+		"Content-Type", "text/plain",
+	)
+	checkAPIStatus(t, w, http.StatusUnsupportedMediaType)
+	w = apiRequest(
+		t, http.MethodPost, "/api/v1/procs/a/start", "{}",
+		"Content-Type", jsonType,
+	)
+	checkAPIStatus(t, w, http.StatusOK)
+	proc := app.GetProcByName("a")
+	if !isRunningStatus(proc.status.Load()) {
+		t.Fatalf("expected the process to be running")
+	}
+	w = apiRequest(t, http.MethodPost, "/api/v1/procs/a/start", "")
+	checkAPIStatus(t, w, http.StatusConflict)
+	w = apiRequest(
+		t, http.MethodPost, "/api/v1/procs/a/stop?method=interrupt", "",
+	)
+	checkAPIStatus(t, w, http.StatusOK)
+	if isRunningStatus(proc.status.Load()) {
+		t.Errorf("expected the process to have exited once stopped")
+	}
+
+	w = apiRequest(t, http.MethodDelete, "/api/v1/procs/b", "")
+	checkAPIStatus(t, w, http.StatusNoContent)
+	if app.GetProcByName("b") != nil {
+		t.Errorf("expected the process to be removed")
+	}
+}
+
+func TestAPISameSite(t *testing.T) {
+	defer func(old *App) { app = old }(app)
+	app = NewApp()
+
+	// httptest requests are for example.com
+	tests := []struct {
+		header []string
+		want   int
+	}{
+		{nil, http.StatusBadRequest},
+		{[]string{"Origin", "http://example.com"}, http.StatusBadRequest},
+		{[]string{"Sec-Fetch-Site", "same-origin"}, http.StatusBadRequest},
+		{[]string{"Sec-Fetch-Site", "none"}, http.StatusBadRequest},
+		{[]string{"Origin", "http://evil.com"}, http.StatusForbidden},
+		{[]string{"Origin", "http://example.com:8080"}, http.StatusForbidden},
+		{[]string{"Origin", "null"}, http.StatusForbidden},
+		{[]string{"Sec-Fetch-Site", "same-site"}, http.StatusForbidden},
+		{[]string{"Sec-Fetch-Site", "cross-site"}, http.StatusForbidden},
+	}
+	for _, test := range tests {
+		header := append(test.header, "Content-Type", "application/json")
+		w := apiRequest(t, http.MethodPost, "/api/v1/procs", "{}", header...)
+		if w.Code != test.want {
+			t.Errorf(
+				"%q: got status %d, want %d: %s",
+				test.header, w.Code, test.want, w.Body,
+			)
+		}
+	}
+	// Reading is allowed from anywhere
+	w := apiRequest(
+		t, http.MethodGet, "/api/v1/procs", "", "Origin", "http://evil.com",
+	)
+	checkAPIStatus(t, w, http.StatusOK)
+}
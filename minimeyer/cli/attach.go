@@ -0,0 +1,297 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	webs "golang.org/x/net/websocket"
+	"golang.org/x/sys/unix"
+	"golang.org/x/term"
+)
+
+// Attaching to interactive processes
+//
+// Interactive processes are run in a pseudo-terminal, which clients can
+// attach to by sending an ActionAttach message (over a websocket or control
+// socket connection). Once attached, the connection is used only for the
+// terminal: the server sends the raw output of the process (binary frames
+// over websockets), starting with the recent output, and the client sends
+// AttachInput messages with the input for the process and the size of its
+// terminal. The connection is closed once the process exits.
+
+// Max bytes of recent output replayed to clients when they attach
+const ptyScrollback = 64 << 10
+
+// Max number of chunks of output buffered for each attached client. Output
+// is dropped for clients that fall further behind.
+const ptyClientBuffer = 256
+
+// Key that detaches from a process in the CLI (Ctrl-])
+const detachKey = 0x1d
+
+// How long terminal input is waited for before checking if reading should
+// stop (see readTerminalInput)
+const inputPollMs = 100
+
+// A message sent by attached clients: input for the process and/or the size
+// of the client's terminal
+type AttachInput struct {
+	Data string `json:"data,omitempty"`
+	Rows uint16 `json:"rows,omitempty"`
+	Cols uint16 `json:"cols,omitempty"`
+}
+
+// The pseudo-terminal of a run of an interactive process
+type processPTY struct {
+	master, tty *os.File
+	// Writer the output is copied to (the log buffer and output file)
+	out io.Writer
+	// Recent output and the channels of the attached clients
+	scrollback []byte
+	clients    map[chan []byte]struct{}
+	mtx        sync.Mutex
+	// Closed once all the output has been read
+	done chan struct{}
+}
+
+func newProcessPTY() (*processPTY, error) {
+	master, tty, err := openPTY()
+	if err != nil {
+		return nil, err
+	}
+	return &processPTY{
+		master:  master,
+		tty:     tty,
+		clients: make(map[chan []byte]struct{}),
+		done:    make(chan struct{}),
+	}, nil
+}
+
+// Reads the output until the process (and anything else using the terminal)
+// exits, copying it to out and the attached clients
+func (t *processPTY) readLoop() {
+	defer close(t.done)
+	buf := make([]byte, 32<<10)
+	for {
+		n, err := t.master.Read(buf)
+		if n != 0 {
+			chunk := append([]byte(nil), buf[:n]...)
+			t.out.Write(chunk)
+			t.mtx.Lock()
+			t.scrollback = append(t.scrollback, chunk...)
+			if extra := len(t.scrollback) - ptyScrollback; extra > 0 {
+				t.scrollback = append(t.scrollback[:0], t.scrollback[extra:]...)
+			}
+			for ch := range t.clients {
+				select {
+				case ch <- chunk:
+				default:
+				}
+			}
+			t.mtx.Unlock()
+		}
+		if err != nil {
+			break
+		}
+	}
+	t.mtx.Lock()
+	for ch := range t.clients {
+		close(ch)
+	}
+	t.clients = nil
+	t.mtx.Unlock()
+}
+
+// Waits for the output to be read once the process has exited, closing the
+// terminal. The terminal is closed regardless after a second since the
+// process's children may still be using it.
+func (t *processPTY) wait() {
+	select {
+	case <-t.done:
+	case <-time.After(time.Second):
+	}
+	t.master.Close()
+	<-t.done
+}
+
+// Closes the terminal if the process couldn't be started
+func (t *processPTY) close() {
+	t.tty.Close()
+	t.master.Close()
+}
+
+// Attaches a client, returning the recent output, the channel the output is
+// sent on (closed when the process exits), and the function that detaches
+// the client. The channel is nil if the process has exited.
+func (t *processPTY) attach() ([]byte, <-chan []byte, func()) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	scrollback := append([]byte(nil), t.scrollback...)
+	if t.clients == nil {
+		return scrollback, nil, func() {}
+	}
+	ch := make(chan []byte, ptyClientBuffer)
+	t.clients[ch] = struct{}{}
+	return scrollback, ch, func() {
+		t.mtx.Lock()
+		defer t.mtx.Unlock()
+		if _, ok := t.clients[ch]; ok {
+			delete(t.clients, ch)
+			close(ch)
+		}
+	}
+}
+
+// Writes the input to the process and/or resizes the terminal
+func (t *processPTY) input(in AttachInput) error {
+	if in.Data != "" {
+		if _, err := t.master.Write([]byte(in.Data)); err != nil {
+			return err
+		}
+	}
+	if in.Rows != 0 && in.Cols != 0 {
+		return setPTYSize(t.master, in.Rows, in.Cols)
+	}
+	return nil
+}
+
+// Returns the pseudo-terminal of the process's current run, or an error if
+// the process isn't interactive or running
+func (p *Process) attachablePTY() (*processPTY, error) {
+	p.procMtx.RLock()
+	defer p.procMtx.RUnlock()
+	if !p.Interactive {
+		return nil, fmt.Errorf("process not interactive")
+	} else if !isRunningStatus(p.status.Load()) || p.pty == nil {
+		return nil, fmt.Errorf("process not running")
+	}
+	return p.pty, nil
+}
+
+// Attaches the connection to the process's terminal until either the client
+// disconnects or the process exits. The AttachInput messages are decoded
+// with d. The connection mustn't receive notifications while attached.
+func attachConn(ws msgConn, d *json.Decoder, proc *Process) error {
+	pty, err := proc.attachablePTY()
+	if err != nil {
+		return err
+	}
+	scrollback, output, detach := pty.attach()
+	defer detach()
+	sendMsg(ws, Message{Action: ActionAttach, Content: proc.Num})
+	if wsConn, ok := ws.(*webs.Conn); ok {
+		wsConn.PayloadType = webs.BinaryFrame
+	}
+	if len(scrollback) != 0 {
+		ws.Write(scrollback)
+	}
+	go func() {
+		for chunk := range output {
+			if _, err := ws.Write(chunk); err != nil {
+				break
+			}
+		}
+		// Stops the input loop below
+		if c, ok := ws.(io.Closer); ok {
+			c.Close()
+		}
+	}()
+	for {
+		var in AttachInput
+		if err := d.Decode(&in); err != nil {
+			return nil
+		}
+		if err := pty.input(in); err != nil {
+			return nil
+		}
+	}
+}
+
+// Runs the terminal attached to a process until the detach key is pressed
+// (returning true) or the output ends. The terminal must be in raw mode;
+// the input read from it is received on input and sent with send, along with
+// the terminal's size when it changes.
+func runAttached(
+	input <-chan []byte, output <-chan []byte, send func(AttachInput) error,
+) bool {
+	sendSize := func() {
+		cols, rows, err := term.GetSize(int(os.Stdout.Fd()))
+		if err == nil {
+			send(AttachInput{Rows: uint16(rows), Cols: uint16(cols)})
+		}
+	}
+	winch := make(chan os.Signal, 1)
+	signal.Notify(winch, syscall.SIGWINCH)
+	defer signal.Stop(winch)
+	sendSize()
+	for {
+		select {
+		case b, ok := <-input:
+			if !ok {
+				return true
+			}
+			i := bytes.IndexByte(b, detachKey)
+			if i != -1 {
+				b = b[:i]
+			}
+			if len(b) != 0 {
+				if err := send(AttachInput{Data: string(b)}); err != nil {
+					return false
+				}
+			}
+			if i != -1 {
+				return true
+			}
+		case b, ok := <-output:
+			if !ok {
+				return false
+			}
+			os.Stdout.Write(b)
+		case <-winch:
+			sendSize()
+		}
+	}
+}
+
+// Reads the input from the terminal f, sending it on input, until f is
+// closed or stop is closed, and then closes input. f is polled so that
+// nothing is read once stop is closed (whatever reads f next gets the
+// input).
+func readTerminalInput(f *os.File, input chan<- []byte, stop <-chan struct{}) {
+	defer close(input)
+	fds := []unix.PollFd{{Fd: int32(f.Fd()), Events: unix.POLLIN}}
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		n, err := unix.Poll(fds, inputPollMs)
+		if err == unix.EINTR || (err == nil && n == 0) {
+			continue
+		} else if err != nil {
+			return
+		}
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		buf := make([]byte, 256)
+		if n, err = f.Read(buf); err != nil {
+			return
+		}
+		select {
+		case input <- buf[:n]:
+		case <-stop:
+			return
+		}
+	}
+}
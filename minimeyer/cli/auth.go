@@ -0,0 +1,432 @@
+package cli
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/term"
+)
+
+const (
+	loginPath         = "/login"
+	logoutPath        = "/logout"
+	sessionCookieName = "minimeyer_session"
+
+	defaultSessionTimeout = 24 * time.Hour
+
+	// Failed password attempts allowed from an address within the window
+	// before it's locked out for the rest of the window
+	maxLoginFailures   = 5
+	loginFailureWindow = 15 * time.Minute
+)
+
+var (
+	// bcrypt hash of the web password (nil if no password is required)
+	webPasswordHash []byte
+	// How long sessions last after logging in
+	webSessionTimeout = defaultSessionTimeout
+
+	webSessions  = newSessionStore()
+	loginLimiter = newRateLimiter(maxLoginFailures, loginFailureWindow)
+
+	// The last password checked against the bcrypt hash and found correct
+	verifiedPassword atomic.Pointer[verifiedPwd]
+)
+
+// A SHA-256 sum of a correct password and the bcrypt hash it was checked
+// against. Checking the password (given with every API request) with bcrypt
+// each time is deliberately slow, so the sum is checked instead.
+type verifiedPwd struct {
+	hash []byte
+	sum  [sha256.Size]byte
+}
+
+// Sets the web password from its bcrypt hash
+func setWebPasswordHash(hash string) error {
+	if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+		return fmt.Errorf("invalid web password hash: %v", err)
+	}
+	webPasswordHash = []byte(hash)
+	return nil
+}
+
+// Sets the web password from the plaintext password, which is hashed
+func setWebPassword(pwd string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(pwd), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("error hashing web password: %v", err)
+	}
+	webPasswordHash = hash
+	return nil
+}
+
+func checkWebPassword(pwd string) bool {
+	sum := sha256.Sum256([]byte(pwd))
+	// The web password may have changed since the sum was stored
+	if v := verifiedPassword.Load(); v != nil &&
+		subtle.ConstantTimeCompare(v.hash, webPasswordHash) == 1 &&
+		subtle.ConstantTimeCompare(v.sum[:], sum[:]) == 1 {
+		return true
+	}
+	if bcrypt.CompareHashAndPassword(webPasswordHash, []byte(pwd)) != nil {
+		return false
+	}
+	verifiedPassword.Store(&verifiedPwd{hash: webPasswordHash, sum: sum})
+	return true
+}
+
+// Sessions created by logging in, mapped to their expiry times
+type sessionStore struct {
+	sessions map[string]time.Time
+	mtx      sync.Mutex
+}
+
+func newSessionStore() *sessionStore {
+	return &sessionStore{sessions: make(map[string]time.Time)}
+}
+
+// Creates a session lasting for the timeout, returning its token
+func (s *sessionStore) create(timeout time.Duration) (string, time.Time, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", time.Time{}, err
+	}
+	token, now := hex.EncodeToString(b), time.Now()
+	expires := now.Add(timeout)
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	// Drop the expired sessions
+	for t, exp := range s.sessions {
+		if now.After(exp) {
+			delete(s.sessions, t)
+		}
+	}
+	s.sessions[token] = expires
+	return token, expires, nil
+}
+
+func (s *sessionStore) valid(token string) bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	exp, ok := s.sessions[token]
+	if ok && time.Now().After(exp) {
+		delete(s.sessions, token)
+		return false
+	}
+	return ok
+}
+
+func (s *sessionStore) delete(token string) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	delete(s.sessions, token)
+}
+
+// Limits the failed attempts from each address within a window
+type rateLimiter struct {
+	max      int
+	window   time.Duration
+	failures map[string]*failedAttempts
+	mtx      sync.Mutex
+}
+
+type failedAttempts struct {
+	count int
+	first time.Time
+}
+
+func newRateLimiter(max int, window time.Duration) *rateLimiter {
+	return &rateLimiter{
+		max:      max,
+		window:   window,
+		failures: make(map[string]*failedAttempts),
+	}
+}
+
+// Returns how long the address is locked out for (0 if it isn't)
+func (l *rateLimiter) blocked(addr string) time.Duration {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	f := l.failures[addr]
+	if f == nil || f.count < l.max {
+		return 0
+	}
+	left := l.window - time.Since(f.first)
+	if left <= 0 {
+		delete(l.failures, addr)
+		return 0
+	}
+	return left
+}
+
+func (l *rateLimiter) fail(addr string) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	now := time.Now()
+	for a, f := range l.failures {
+		if now.Sub(f.first) >= l.window {
+			delete(l.failures, a)
+		}
+	}
+	f := l.failures[addr]
+	if f == nil {
+		f = &failedAttempts{first: now}
+		l.failures[addr] = f
+	}
+	f.count++
+}
+
+func (l *rateLimiter) reset(addr string) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	delete(l.failures, addr)
+}
+
+// Returns the host of the request's remote address
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// Checks the password, respecting the rate limit. Writes the error response
+// and returns false if the request is locked out or the password is wrong.
+func checkLoginAttempt(w http.ResponseWriter, r *http.Request, pwd string) bool {
+	host := remoteHost(r)
+	if wait := loginLimiter.blocked(host); wait > 0 {
+		secs := int(wait.Seconds()) + 1
+		w.Header().Set("Retry-After", strconv.Itoa(secs))
+		authError(
+			w, r, http.StatusTooManyRequests,
+			fmt.Sprintf("too many failed attempts, try again in %d seconds", secs),
+		)
+		return false
+	}
+	if !checkWebPassword(pwd) {
+		loginLimiter.fail(host)
+		authError(w, r, http.StatusUnauthorized, "invalid password")
+		return false
+	}
+	loginLimiter.reset(host)
+	return true
+}
+
+// Requires every request (other than logging in) to have a valid session
+// cookie or the web password (given with HTTP basic auth, any username, or as
+// a bearer token) if there's a web password. Browsers are redirected to the
+// login page.
+func requireAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if webPasswordHash == nil || r.URL.Path == loginPath {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if c, err := r.Cookie(sessionCookieName); err == nil {
+			if webSessions.valid(c.Value) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+		if pwd, ok := requestPassword(r); ok {
+			if checkLoginAttempt(w, r, pwd) {
+				next.ServeHTTP(w, r)
+			}
+			return
+		}
+		if r.URL.Path == "/" && r.Method == http.MethodGet {
+			http.Redirect(w, r, loginPath, http.StatusSeeOther)
+			return
+		}
+		authError(w, r, http.StatusUnauthorized, "login required")
+	})
+}
+
+// Gets the password from the request's basic auth or bearer token
+func requestPassword(r *http.Request) (string, bool) {
+	if _, pwd, ok := r.BasicAuth(); ok {
+		return pwd, true
+	}
+	auth := r.Header.Get("Authorization")
+	if token := strings.TrimPrefix(auth, "Bearer "); token != auth {
+		return token, true
+	}
+	return "", false
+}
+
+func authError(w http.ResponseWriter, r *http.Request, code int, msg string) {
+	if code == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Basic realm="minimeyer"`)
+	}
+	if strings.HasPrefix(r.URL.Path, apiPrefix) {
+		apiError(w, code, msg)
+	} else {
+		http.Error(w, msg, code)
+	}
+}
+
+const loginPage = `<!DOCTYPE html>
+<html lang="en-US">
+<head>
+  <title>MiniMeyer - Login</title>
+  <meta charset="UTF-8">
+  <meta name="viewport" content="width=device-width, initial-scale=1.0">
+</head>
+<body style="text-align:center">
+  <h1>MiniMeyer</h1>
+  <p style="color:red">%s</p>
+  <form method="post" action="login">
+    <input type="password" name="password" placeholder="Password" autofocus>
+    <button type="submit">Log In</button>
+  </form>
+</body>
+</html>
+`
+
+// Serves the login page and logs in with the password posted from it,
+// setting the session cookie
+func loginHandler(w http.ResponseWriter, r *http.Request) {
+	if webPasswordHash == nil {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		writeLoginPage(w, http.StatusOK, "")
+		return
+	case http.MethodPost:
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	host := remoteHost(r)
+	if wait := loginLimiter.blocked(host); wait > 0 {
+		secs := int(wait.Seconds()) + 1
+		w.Header().Set("Retry-After", strconv.Itoa(secs))
+		writeLoginPage(
+			w, http.StatusTooManyRequests,
+			fmt.Sprintf("Too many failed attempts, try again in %d seconds", secs),
+		)
+		return
+	}
+	if !checkWebPassword(r.PostFormValue("password")) {
+		loginLimiter.fail(host)
+		writeLoginPage(w, http.StatusUnauthorized, "Invalid password")
+		return
+	}
+	loginLimiter.reset(host)
+	token, expires, err := webSessions.create(webSessionTimeout)
+	if err != nil {
+		http.Error(
+			w, "error creating session: "+err.Error(),
+			http.StatusInternalServerError,
+		)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    token,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+func writeLoginPage(w http.ResponseWriter, code int, msg string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(code)
+	fmt.Fprintf(w, loginPage, html.EscapeString(msg))
+}
+
+// Ends the session, if any
+func logoutHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if c, err := r.Cookie(sessionCookieName); err == nil {
+		webSessions.delete(c.Value)
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+	})
+	http.Redirect(w, r, loginPath, http.StatusSeeOther)
+}
+
+func NewHashPasswordCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "hash-password",
+		Short: "Print the bcrypt hash of a web password",
+		Long: `Read a password (from the terminal, or the first line of stdin) and print
+its bcrypt hash to put in the config file (webPasswordHash/web-password-hash).`,
+		Args: cobra.NoArgs,
+		Run:  runHashPassword,
+	}
+}
+
+func runHashPassword(cmd *cobra.Command, args []string) {
+	log.SetFlags(0)
+	pwd, err := readPassword()
+	if err != nil {
+		log.Fatal("error reading password: ", err)
+	} else if pwd == "" {
+		log.Fatal("empty password")
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(pwd), bcrypt.DefaultCost)
+	if err != nil {
+		log.Fatal("error hashing password: ", err)
+	}
+	fmt.Println(string(hash))
+}
+
+// Reads a password without echoing it if stdin is a terminal
+func readPassword() (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return "", err
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+	fmt.Fprint(os.Stderr, "Password: ")
+	pwd, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprint(os.Stderr, "Confirm Password: ")
+	confirm, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	} else if subtle.ConstantTimeCompare(pwd, confirm) != 1 {
+		return "", fmt.Errorf("passwords don't match")
+	}
+	return string(pwd), nil
+}
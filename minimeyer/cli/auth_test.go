@@ -0,0 +1,162 @@
+package cli
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSessionStore(t *testing.T) {
+	s := newSessionStore()
+	token, expires, err := s.create(time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if len(token) != 64 {
+		t.Errorf("expected a 64-character token, got %q", token)
+	} else if d := time.Until(expires); d <= 59*time.Minute || d > time.Hour {
+		t.Errorf("expected the session to expire in an hour, got %s", d)
+	}
+	if !s.valid(token) {
+		t.Errorf("expected the session to be valid")
+	} else if s.valid("other") {
+		t.Errorf("expected an unknown session to be invalid")
+	}
+	s.delete(token)
+	if s.valid(token) {
+		t.Errorf("expected a deleted session to be invalid")
+	}
+
+	expired, _, _ := s.create(-time.Second)
+	if s.valid(expired) {
+		t.Errorf("expected an expired session to be invalid")
+	}
+	// Expired sessions are dropped when others are created
+	s.sessions["old"] = time.Now().Add(-time.Second)
+	s.create(time.Hour)
+	if _, ok := s.sessions["old"]; ok {
+		t.Errorf("expected the expired session to be dropped")
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	l := newRateLimiter(3, time.Hour)
+	for i := 0; i < 3; i++ {
+		if l.blocked("a") != 0 {
+			t.Fatalf("blocked after %d failures", i)
+		}
+		l.fail("a")
+	}
+	if wait := l.blocked("a"); wait <= 59*time.Minute || wait > time.Hour {
+		t.Errorf("expected to be blocked for an hour, got %s", wait)
+	} else if l.blocked("b") != 0 {
+		t.Errorf("expected other addresses not to be blocked")
+	}
+	l.reset("a")
+	if l.blocked("a") != 0 {
+		t.Errorf("expected to not be blocked after a reset")
+	}
+
+	// Failures are forgotten after the window
+	l.fail("a")
+	l.failures["a"].count, l.failures["a"].first = 3, time.Now().Add(-time.Hour)
+	if l.blocked("a") != 0 {
+		t.Errorf("expected to not be blocked after the window")
+	} else if _, ok := l.failures["a"]; ok {
+		t.Errorf("expected the failures to be dropped")
+	}
+}
+
+func TestRequireAuth(t *testing.T) {
+	defer func(hash []byte) {
+		webPasswordHash = hash
+		webSessions = newSessionStore()
+		loginLimiter = newRateLimiter(maxLoginFailures, loginFailureWindow)
+		verifiedPassword.Store(nil)
+	}(webPasswordHash)
+	webPasswordHash = nil
+	ok := func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("ok")) }
+	handler := requireAuth(http.HandlerFunc(ok))
+	serve := func(r *http.Request) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+	check := func(
+		name string, r *http.Request, want int,
+	) *httptest.ResponseRecorder {
+		t.Helper()
+		w := serve(r)
+		if w.Code != want {
+			t.Errorf("%s: got status %d, want %d: %s", name, w.Code, want, w.Body)
+		}
+		return w
+	}
+
+	// No password is required if there isn't one
+	check("no password", httptest.NewRequest("GET", "/api/v1/procs", nil), 200)
+
+	if err := setWebPassword("secret"); err != nil {
+		t.Fatal(err)
+	}
+	w := check("browser", httptest.NewRequest("GET", "/", nil), http.StatusSeeOther)
+	if loc := w.Header().Get("Location"); loc != loginPath {
+		t.Errorf("expected a redirect to the login page, got %q", loc)
+	}
+	check("login page", httptest.NewRequest("GET", loginPath, nil), 200)
+	w = check(
+		"no auth", httptest.NewRequest("GET", "/api/v1/procs", nil),
+		http.StatusUnauthorized,
+	)
+	if w.Header().Get("WWW-Authenticate") == "" {
+		t.Errorf("expected a WWW-Authenticate header")
+	} else if !strings.Contains(w.Body.String(), `"error"`) {
+		t.Errorf("expected a JSON error for the API, got %s", w.Body)
+	}
+
+	r := httptest.NewRequest("GET", "/api/v1/procs", nil)
+	r.SetBasicAuth("anyone", "secret")
+	check("basic auth", r, 200)
+	if verifiedPassword.Load() == nil {
+		t.Errorf("expected the verified password to be stored")
+	}
+	// Checked again without bcrypt
+	check("basic auth again", r, 200)
+	r = httptest.NewRequest("GET", "/api/v1/procs", nil)
+	r.Header.Set("Authorization", "Bearer secret")
+	check("bearer", r, 200)
+
+	token, _, err := webSessions.create(time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r = httptest.NewRequest("GET", "/api/v1/procs", nil)
+	r.AddCookie(&http.Cookie{Name: sessionCookieName, Value: token})
+	check("session", r, 200)
+	r = httptest.NewRequest("GET", "/api/v1/procs", nil)
+	r.AddCookie(&http.Cookie{Name: sessionCookieName, Value: "bad"})
+	check("bad session", r, http.StatusUnauthorized)
+
+	// A new password isn't the verified one
+	if err := setWebPassword("other"); err != nil {
+		t.Fatal(err)
+	}
+	r = httptest.NewRequest("GET", "/api/v1/procs", nil)
+	r.SetBasicAuth("", "secret")
+	check("old password", r, http.StatusUnauthorized)
+
+	// The address is locked out after too many failures, even with the right
+	// password
+	for i := 1; i < maxLoginFailures; i++ {
+		serve(r)
+	}
+	r = httptest.NewRequest("GET", "/api/v1/procs", nil)
+	r.SetBasicAuth("", "other")
+	w = check("locked out", r, http.StatusTooManyRequests)
+	if w.Header().Get("Retry-After") == "" {
+		t.Errorf("expected a Retry-After header")
+	}
+	r.RemoteAddr = "192.0.2.2:1234"
+	check("other address", r, 200)
+}
@@ -1,13 +1,12 @@
 package cli
 
 // TODO: Make it so output files can't be overwritten?
-// TODO: Make it so the output file names can incorporate the special values,
-// e.g., -.log for stderr is process1-stderr.log
 
 import (
 	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -25,6 +24,8 @@ import (
 
 	"github.com/BurntSushi/toml"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"golang.org/x/term"
 )
 
 var (
@@ -32,6 +33,9 @@ var (
 	errProcRunning = fmt.Errorf("process running already")
 )
 
+// Default address of the web server when run with the root command
+const DefaultRootAddr = "127.0.0.1:3350"
+
 func NewCliCmd() *cobra.Command {
 	cliCmd := &cobra.Command{
 		Use:   "cli",
@@ -40,7 +44,30 @@ func NewCliCmd() *cobra.Command {
 		Run:   Run,
 		Args:  cobra.ExactArgs(0),
 	}
-	flags := cliCmd.Flags()
+	addRunFlags(cliCmd, "", false)
+	return cliCmd
+}
+
+// Returns the root command, which runs the web server (on DefaultRootAddr by
+// default) without the CLI, like "cli --no-cli". Clients of the old root
+// server's protocol are still supported (see legacy.go).
+func NewRootCmd() *cobra.Command {
+	rootCmd := &cobra.Command{
+		Use:   "minimeyer",
+		Short: "Process manager",
+		Long: `Process manager. Without a subcommand, runs the web server (on
+` + DefaultRootAddr + ` by default) and the processes in the config, if any,
+without the CLI (like "cli --no-cli").`,
+		Run:  Run,
+		Args: cobra.ExactArgs(0),
+	}
+	addRunFlags(rootCmd, DefaultRootAddr, true)
+	return rootCmd
+}
+
+// Adds the flags used by Run to the command
+func addRunFlags(cmd *cobra.Command, defaultAddr string, noCli bool) {
+	flags := cmd.Flags()
 	flags.StringP("out-dir", "o", "", "Directory to put output files in")
 	flags.StringP("config", "c", "", "Path to config file")
 	flags.BoolP(
@@ -60,16 +87,58 @@ func NewCliCmd() *cobra.Command {
 		"Generate a template config file without comments in the current directory",
 	)
 	flags.String(
-		"addr", "",
+		"import", "",
+		"Path of a Procfile or docker-compose file (.yml or .yaml) to import the processes from, instead of a config file",
+	)
+	flags.String(
+		"import-out", "",
+		"Write the imported processes to a TOML config file rather than running them",
+	)
+	flags.String(
+		"addr", defaultAddr,
 		"Address to run server on, if passed, overriding config file serverAddr",
 	)
 	flags.Bool(
-		"no-cli", false,
+		"no-cli", noCli,
 		"Run without starting the CLI for procs (must have an address to run on)",
 	)
+	flags.Bool(
+		"no-tui", false,
+		"Use the line-prompt CLI rather than the full-screen terminal UI",
+	)
+	flags.Bool(
+		"daemon", false,
+		"Run in the background without the CLI, controlled through the control socket",
+	)
+	flags.String(
+		"socket", "",
+		"Path of the control socket to listen on (default is used with --daemon)",
+	)
+	flags.String(
+		"daemon-log", "minimeyer-daemon.log",
+		"Path of the file the daemon's output is written to",
+	)
+	flags.String(
+		"state", "",
+		"Path of the state file (SQLite) to record history and runtime processes in, overriding config file stateFile",
+	)
+	flags.Bool(daemonChildFlag, false, "")
+	flags.MarkHidden(daemonChildFlag)
 	flags.Bool(
 		"web-password", false,
-		"Run web with password (use MINIMEYER_PASSWORD envvar to set password)",
+		"Run web with password (use MINIMEYER_PASSWORD envvar to set password, or MINIMEYER_PASSWORD_HASH to set its bcrypt hash), overriding config file webPasswordHash",
+	)
+	flags.String(
+		"tls-cert", "",
+		"Path of the certificate file to serve the web server over TLS with, overriding config file tlsCert",
+	)
+	flags.String(
+		"tls-key", "",
+		"Path of the key file for the TLS certificate, overriding config file tlsKey",
+	)
+	flags.Bool(
+		"tls-self-signed", false,
+		"Serve the web server over TLS with a generated self-signed certificate if no certificate is given",
 	)
 	flags.StringVar(
 		&indexPath,
@@ -91,9 +160,7 @@ func NewCliCmd() *cobra.Command {
 		"server-name", "",
 		"The name of the web server to display",
 	)
-	cliCmd.MarkFlagsRequiredTogether("html", "js", "css")
-
-	return cliCmd
+	cmd.MarkFlagsRequiredTogether("html", "js", "css")
 }
 
 func Run(cmd *cobra.Command, args []string) {
@@ -102,60 +169,83 @@ func Run(cmd *cobra.Command, args []string) {
 	flags := cmd.Flags()
 	outDir, _ := flags.GetString("out-dir")
 	configPath, _ := flags.GetString("config")
+	importPath, _ := flags.GetString("import")
+	importOut, _ := flags.GetString("import-out")
 	configTemp, _ := flags.GetBool("config-template")
 	bareConfigTemp, _ := flags.GetBool("bare-config-template")
 	configTomlTemp, _ := flags.GetBool("config-toml-template")
 	bareConfigTomlTemp, _ := flags.GetBool("bare-config-toml-template")
 	addr, _ := flags.GetString("addr")
 	noCli, _ := flags.GetBool("no-cli")
-	if b, _ := flags.GetBool("web-password"); b {
-		pwd := os.Getenv("MINIMEYER_PASSWORD")
-		webPassword = &pwd
+	noTUI, _ := flags.GetBool("no-tui")
+	daemon, _ := flags.GetBool("daemon")
+	socketPath, _ := flags.GetString("socket")
+	daemonLog, _ := flags.GetString("daemon-log")
+	daemonChild, _ := flags.GetBool(daemonChildFlag)
+	statePath, _ := flags.GetString("state")
+
+	if daemon {
+		noCli = true
+		if socketPath == "" {
+			socketPath = DefaultSocketPath()
+		}
 	}
-
-	if noCli && addr == "" {
-		log.Fatal(`Must provide "addr" with "no-cli"`)
+	if noCli && addr == "" && socketPath == "" {
+		log.Fatal(`Must provide "addr" or "socket" with "no-cli"`)
+	}
+	if configPath != "" && importPath != "" {
+		log.Fatal(`Can't use both "config" and "import"`)
+	} else if importOut != "" && importPath == "" {
+		log.Fatal(`Must provide "import" with "import-out"`)
 	}
 
 	intChan := make(chan os.Signal, 1)
 	go func() {
 		<-intChan
-		app.procsMtx.RLock()
-		for _, proc := range app.procs {
-			if err := proc.interrupt(); err != nil {
-				log.Printf(
-					"error interrupting process %d (%s): %v",
-					proc.Num, proc.Name, err,
-				)
-			}
-		}
-		app.procsMtx.RUnlock()
-		done := app.Done()
+		// Dependents are stopped before their dependencies
+		go app.StopProcs((*Process).stop)
 		select {
-		case _, _ = <-done:
+		case <-app.Done():
+			CloseCtl()
+			app.CloseState()
 			os.Exit(0)
 		case <-intChan:
 		}
+		// The processes were already marked as stopping, so they're killed
+		// with forceKill rather than kill
 		app.procsMtx.RLock()
 		for _, proc := range app.procs {
-			proc.kill()
+			proc.forceKill()
 		}
 		app.procsMtx.RUnlock()
+		CloseCtl()
+		app.CloseState()
 		os.Exit(0)
 	}()
 	signal.Notify(intChan, os.Interrupt)
 	termChan := make(chan os.Signal, 1)
 	go func() {
 		<-termChan
-		app.procsMtx.RLock()
-		for _, proc := range app.procs {
-			// TODO: Send sigterm?
-			proc.kill()
-		}
-		app.procsMtx.RLock()
+		app.StopProcs((*Process).stop)
+		CloseCtl()
+		app.CloseState()
 		os.Exit(0)
 	}()
 	signal.Notify(termChan, syscall.SIGTERM)
+	hupChan := make(chan os.Signal, 1)
+	go func() {
+		for range hupChan {
+			Println("Reloading config...")
+			plan, err := app.PlanReload()
+			if err != nil {
+				Println("Error reloading config:", err)
+				continue
+			}
+			Println(plan)
+			app.ApplyReload(plan)
+		}
+	}()
+	signal.Notify(hupChan, syscall.SIGHUP)
 
 	if configTemp {
 		_, thisFile, _, _ := runtime.Caller(0)
@@ -207,44 +297,87 @@ func Run(cmd *cobra.Command, args []string) {
 		return
 	}
 
-	if configPath != "" {
-		ext := filepath.Ext(configPath)
-		config := &Config{}
-		switch ext {
-		case ".json":
-			f, err := os.Open(configPath)
-			if err != nil {
-				log.Fatal("error opening config file: ", err)
-			}
-			err = json.NewDecoder(f).Decode(config)
-			f.Close()
-			if err != nil {
-				log.Fatal("error parsing config file: ", err)
-			}
-		case ".toml":
-			if _, err := toml.DecodeFile(configPath, config); err != nil {
-				log.Fatal("error parsing config file: ", err)
-			}
-		default:
-			log.Fatal("invalid config file, expected .json or .toml file")
+	if importOut != "" {
+		config, warnings, err := importConfig(importPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, w := range warnings {
+			Eprintln("Warning:", w)
+		}
+		if err := writeConfigTOML(importOut, config, warnings); err != nil {
+			log.Fatal("error writing config file: ", err)
+		}
+		Printf("Wrote %d processes to %s\n", len(config.Procs), importOut)
+		return
+	}
+
+	if daemon && !daemonChild {
+		pid, err := daemonize(daemonLog)
+		if err != nil {
+			log.Fatal("error starting daemon: ", err)
+		}
+		Printf("Started daemon (pid %d) with control socket %s\n", pid, socketPath)
+		return
+	}
+
+	if configPath != "" || importPath != "" {
+		var config *Config
+		var err error
+		if configPath != "" {
+			config, err = loadConfig(configPath)
+		} else {
+			config, err = loadImport(importPath)
 		}
-		if addr != "" {
+		if err != nil {
+			log.Fatal(err)
+		}
+		// The default address (of the root command) doesn't override the config
+		if addr != "" && (flags.Changed("addr") || config.ServerAddr == "") {
 			config.ServerAddr = addr
 		}
+		if err := setupWeb(config, flags); err != nil {
+			log.Fatal(err)
+		}
 		app = AppFromConfig(config)
+		app.configPath = configPath
 		if outDir != "" {
 			app.outDir = outDir
 		}
+		if statePath == "" {
+			statePath = config.StateFile
+		}
+		if statePath != "" {
+			if err := app.OpenState(statePath); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if socketPath != "" {
+			startCtl(socketPath)
+		}
 		if len(app.procs) != 0 {
 			Println("Starting processes...")
 			app.StartProcs()
 		}
-		handleInput()
+		if noCli {
+			waitForInterrupt()
+		} else {
+			runInteractive(noTUI)
+		}
 		app.Wait()
+		app.CloseState()
 		return
 	}
 
 	app.outDir = outDir
+	if err := setupWeb(&Config{}, flags); err != nil {
+		log.Fatal(err)
+	}
+	if statePath != "" {
+		if err := app.OpenState(statePath); err != nil {
+			log.Fatal(err)
+		}
+	}
 
 	if !noCli {
 		// Create the processes
@@ -255,7 +388,7 @@ func Run(cmd *cobra.Command, args []string) {
 			} else if proc == nil {
 				continue
 			}
-			app.AddProc(proc)
+			app.AddRuntimeProc(proc)
 
 			if confirm("Start now [Y/n]? ") {
 				Printf("Starting process %d (%s)\n", proc.Num, proc.Name)
@@ -287,17 +420,69 @@ func Run(cmd *cobra.Command, args []string) {
 	}
 	if addr != "" {
 		fmt.Println("Starting server on", addr)
-		RunWeb(addr)
+		if err := RunWeb(addr); err != nil {
+			log.Fatal("error starting server: ", err)
+		}
+	}
+	if socketPath != "" {
+		startCtl(socketPath)
 	}
-	signalCh := make(chan os.Signal)
 	if !noCli {
-		handleInput()
-		close(signalCh)
+		runInteractive(noTUI)
 	} else {
-		signal.Notify(signalCh, os.Interrupt)
+		waitForInterrupt()
 	}
-	<-signalCh
 	app.Wait()
+	app.CloseState()
+}
+
+// Sets up the web server's password, sessions, and TLS from the config and
+// the flags, which take precedence
+func setupWeb(config *Config, flags *pflag.FlagSet) error {
+	webTLSCert, webTLSKey = config.TLSCert, config.TLSKey
+	webTLSSelfSigned = config.TLSSelfSigned
+	if cert, _ := flags.GetString("tls-cert"); cert != "" {
+		webTLSCert = cert
+	}
+	if key, _ := flags.GetString("tls-key"); key != "" {
+		webTLSKey = key
+	}
+	if b, _ := flags.GetBool("tls-self-signed"); b {
+		webTLSSelfSigned = true
+	}
+	if config.SessionTimeout < 0 {
+		return fmt.Errorf("session timeout must be non-negative")
+	} else if config.SessionTimeout != 0 {
+		webSessionTimeout = time.Second * config.SessionTimeout
+	}
+	if b, _ := flags.GetBool("web-password"); b {
+		if hash := os.Getenv("MINIMEYER_PASSWORD_HASH"); hash != "" {
+			return setWebPasswordHash(hash)
+		}
+		pwd := os.Getenv("MINIMEYER_PASSWORD")
+		if pwd == "" {
+			return fmt.Errorf(
+				"MINIMEYER_PASSWORD or MINIMEYER_PASSWORD_HASH must be set with web-password",
+			)
+		}
+		return setWebPassword(pwd)
+	} else if config.WebPasswordHash != "" {
+		return setWebPasswordHash(config.WebPasswordHash)
+	}
+	return nil
+}
+
+func startCtl(path string) {
+	if err := RunCtl(path); err != nil {
+		log.Fatal("error starting control socket: ", err)
+	}
+	Println("Listening for control connections on", path)
+}
+
+func waitForInterrupt() {
+	signalCh := make(chan os.Signal, 1)
+	signal.Notify(signalCh, os.Interrupt)
+	<-signalCh
 }
 
 // False means the loop when initially creating the processes should break
@@ -321,7 +506,18 @@ func getProcessFromStdin(num int) (*Process, bool) {
 		}
 	}
 
-	proc.Env = os.Environ()
+	for {
+		proc.Dir = readline("Working directory (blank = current): ")
+		if err := proc.validateExec(); err != nil {
+			fmt.Println(err)
+			continue
+		}
+		break
+	}
+
+	// Only the process's own variables (the environment is added when it's
+	// added to the app), so that they're all that's saved to the state file
+	proc.Env = nil
 	for {
 		if kv := readline(fmt.Sprintf("Env Var (key=val): ")); kv != "" {
 			proc.Env = append(proc.Env, kv)
@@ -330,6 +526,33 @@ func getProcessFromStdin(num int) (*Process, bool) {
 		}
 	}
 
+	for {
+		proc.DependsOn = nil
+		for _, name := range strings.Split(
+			readline("Depends on (comma-separated names): "), ",",
+		) {
+			if name = strings.TrimSpace(name); name != "" {
+				proc.DependsOn = append(proc.DependsOn, name)
+			}
+		}
+		if err := app.checkDeps(proc); err != nil {
+			fmt.Println(err)
+			continue
+		}
+		break
+	}
+
+	for {
+		proc.Schedule = readline("Schedule (e.g., @every 10m; blank = none): ")
+		if proc.Schedule != "" {
+			if _, err := parseSchedule(proc.Schedule); err != nil {
+				fmt.Println(err)
+				continue
+			}
+		}
+		break
+	}
+
 	proc.OutFilename = readline(
 		"Stdout output filename (- = process number, % = name): ",
 	)
@@ -361,6 +584,13 @@ func handleInput() {
 		fmt.Println("10) Close Server")
 		fmt.Println("11) Shutdown Server")
 		fmt.Println("12) Server Address")
+		fmt.Println("13) Stop Process (Graceful)")
+		fmt.Println("14) Print Process Output")
+		fmt.Println("15) Reload Config")
+		fmt.Println("16) Print Job Runs")
+		fmt.Println("17) Bulk Action (Group or Tag)")
+		fmt.Println("18) Print History")
+		fmt.Println("19) Attach to Process")
 		fmt.Println("0) Resume Output")
 		fmt.Println("-1) Wait for procs and quit")
 	}
@@ -427,6 +657,20 @@ InputLoop:
 					} else {
 						fmt.Printf("%s (NOT RUNNING)\n", srvr.Addr)
 					}
+				case 13:
+					stopProcess()
+				case 14:
+					printProcessOutput()
+				case 15:
+					reloadConfig()
+				case 16:
+					printJobRuns()
+				case 17:
+					bulkAction()
+				case 18:
+					printHistory()
+				case 19:
+					attachProcess()
 				case 0:
 					stdout.Unlock()
 					continue InputLoop
@@ -440,16 +684,36 @@ InputLoop:
 				break
 			}
 		}
-		stdout.Unlock()
 	}
 }
 
 func printProcesses() {
 	for _, proc := range app.procs {
 		fmt.Printf(
-			"Process #%d (%s): %s\n",
+			"Process #%d (%s): %s",
 			proc.Num, proc.Name, statusString(proc.status.Load()),
 		)
+		if proc.ProcGroup != "" {
+			fmt.Printf(" (group: %s)", proc.ProcGroup)
+		}
+		if len(proc.Tags) != 0 {
+			fmt.Printf(" (tags: %s)", strings.Join(proc.Tags, ", "))
+		}
+		if info := proc.restartInfo(); info != "" {
+			fmt.Printf(" (%s)", info)
+		}
+		proc.procMtx.RLock()
+		if proc.healthErr != "" {
+			fmt.Printf(" (health check: %s)", proc.healthErr)
+		}
+		if proc.usage != nil {
+			fmt.Printf(" [%s]", proc.usage)
+		}
+		if !proc.nextRun.IsZero() {
+			fmt.Printf(" (next run: %s)", proc.nextRun.Format("2006-01-02 15:04"))
+		}
+		proc.procMtx.RUnlock()
+		fmt.Println()
 	}
 }
 
@@ -467,17 +731,43 @@ func restartProcessKill() {
 			fmt.Println("No process with num", num)
 			continue
 		}
-		if err := proc.kill(); err != nil {
-			fmt.Println("Error killing process:", err)
+		// The process's exit is printed, so output must be resumed while
+		// waiting for it to restart
+		stdout.Unlock()
+		err = proc.restart((*Process).kill)
+		stdout.Lock()
+		if err != nil {
+			fmt.Println("Error restarting process:", err)
+		}
+	}
+}
+
+func restartProcessInterrupt() {
+	for {
+		num, err := strconv.Atoi(readline("Process # (-1 = Back): "))
+		if err != nil {
+			fmt.Println("Invalid number")
+		}
+		if num == -1 {
+			return
+		}
+		proc := app.GetProcByNum(num)
+		if proc == nil {
+			fmt.Println("No process with num", num)
 			continue
 		}
-		if err := startProc(proc); err != nil {
-			fmt.Println("Error starting process:", err)
+		// The process's exit is printed, so output must be resumed while
+		// waiting for it to restart
+		stdout.Unlock()
+		err = proc.restart((*Process).interrupt)
+		stdout.Lock()
+		if err != nil {
+			fmt.Println("Error restarting process:", err)
 		}
 	}
 }
 
-func restartProcessInterrupt() {
+func killProcess() {
 	for {
 		num, err := strconv.Atoi(readline("Process # (-1 = Back): "))
 		if err != nil {
@@ -492,16 +782,38 @@ func restartProcessInterrupt() {
 			continue
 		}
 		if err := proc.interrupt(); err != nil {
-			fmt.Println("Error interrupt process:", err)
+			fmt.Println("Error killing process:", err)
+		}
+	}
+}
+
+func stopProcess() {
+	for {
+		num, err := strconv.Atoi(readline("Process # (-1 = Back): "))
+		if err != nil {
+			fmt.Println("Invalid number")
+			return
+		}
+		if num == -1 {
+			return
+		}
+		proc := app.GetProcByNum(num)
+		if proc == nil {
+			fmt.Println("No process with num", num)
 			continue
 		}
-		if err := startProc(proc); err != nil {
-			fmt.Println("Error starting process:", err)
+		// The process's exit is printed, so output must be resumed while
+		// waiting for it to stop
+		stdout.Unlock()
+		err = proc.stop()
+		stdout.Lock()
+		if err != nil {
+			fmt.Println("Error stopping process:", err)
 		}
 	}
 }
 
-func killProcess() {
+func printProcessOutput() {
 	for {
 		num, err := strconv.Atoi(readline("Process # (-1 = Back): "))
 		if err != nil {
@@ -515,12 +827,164 @@ func killProcess() {
 			fmt.Println("No process with num", num)
 			continue
 		}
-		if err := proc.interrupt(); err != nil {
-			fmt.Println("Error killing process:", err)
+		n, _ := strconv.Atoi(readline("Number of lines (0 = all): "))
+		for _, line := range proc.logBuffer().Tail(n) {
+			fmt.Println(line)
+		}
+	}
+}
+
+// Attaches the terminal to an interactive process until Ctrl-] is pressed or
+// the process exits
+func attachProcess() {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		fmt.Println("Stdin must be a terminal to attach")
+		return
+	}
+	num, err := strconv.Atoi(readline("Process # (-1 = Back): "))
+	if err != nil {
+		fmt.Println("Invalid number")
+		return
+	} else if num == -1 {
+		return
+	}
+	proc := app.GetProcByNum(num)
+	if proc == nil {
+		fmt.Println("No process with num", num)
+		return
+	}
+	pty, err := proc.attachablePTY()
+	if err != nil {
+		fmt.Printf("Can't attach to %s: %v\n", proc.Name, err)
+		return
+	}
+	scrollback, output, detach := pty.attach()
+	defer detach()
+	if output == nil {
+		fmt.Println(proc.Name, "exited")
+		return
+	}
+	oldState, err := term.MakeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		fmt.Println("Error setting up terminal:", err)
+		return
+	}
+	input, stop := make(chan []byte), make(chan struct{})
+	go readTerminalInput(os.Stdin, input, stop)
+	fmt.Printf("Attached to %s (Ctrl-] to detach)\r\n", proc.Name)
+	os.Stdout.Write(scrollback)
+	detached := runAttached(input, output, pty.input)
+	close(stop)
+	term.Restore(int(os.Stdin.Fd()), oldState)
+	// Undo any changes made by the process (e.g., switching to the alternate
+	// screen)
+	fmt.Print("\x1b[0m\x1b[?1l\x1b[?1049l\x1b[?25h\n")
+	if detached {
+		fmt.Println("Detached from", proc.Name)
+	} else {
+		fmt.Println(proc.Name, "exited")
+	}
+}
+
+func printJobRuns() {
+	for {
+		num, err := strconv.Atoi(readline("Process # (-1 = Back): "))
+		if err != nil {
+			fmt.Println("Invalid number")
+		}
+		if num == -1 {
+			return
+		}
+		proc := app.GetProcByNum(num)
+		if proc == nil {
+			fmt.Println("No process with num", num)
+			continue
+		}
+		runs := proc.Runs()
+		if len(runs) == 0 {
+			fmt.Println("No runs")
+		}
+		for _, run := range runs {
+			fmt.Println(run)
+		}
+	}
+}
+
+func bulkAction() {
+	for {
+		s := readline("Selector (group:NAME or tag:NAME, -1 = Back): ")
+		if s == "-1" {
+			return
+		}
+		sel, err := parseSelector(s)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		procs := app.SelectProcs(sel)
+		if len(procs) == 0 {
+			fmt.Println("No processes in", sel)
+			continue
+		}
+		names := make([]string, len(procs))
+		for i, proc := range procs {
+			names[i] = fmt.Sprintf("%d (%s)", proc.Num, proc.Name)
+		}
+		fmt.Println("Processes:", strings.Join(names, ", "))
+		action := readline(
+			"Action (start, stop, kill, interrupt, restart, kill-restart, " +
+				"interrupt-restart, del): ",
+		)
+		if !validBulkAction(action) {
+			fmt.Println("Invalid action")
+			continue
+		}
+		// The processes starting and exiting are printed, so output must be
+		// resumed while waiting for the action
+		stdout.Unlock()
+		err = app.BulkAction(action, procs)
+		stdout.Lock()
+		if err != nil {
+			fmt.Println(err)
 		}
 	}
 }
 
+func printHistory() {
+	name := readline("Process name (blank = all): ")
+	limit, _ := strconv.Atoi(readline(
+		fmt.Sprintf("Number of events (blank = %d): ", defaultHistoryLimit),
+	))
+	if limit <= 0 {
+		limit = defaultHistoryLimit
+	}
+	events, err := app.History(name, limit)
+	if err != nil {
+		fmt.Println("Error getting history:", err)
+		return
+	}
+	for _, event := range events {
+		fmt.Println(event)
+	}
+}
+
+func reloadConfig() {
+	plan, err := app.PlanReload()
+	if err != nil {
+		fmt.Println("Error reloading config:", err)
+		return
+	}
+	fmt.Println(plan)
+	if plan.Empty() || !confirm("Apply [Y/n]? ") {
+		return
+	}
+	// Processes exiting are printed, so output must be resumed while the plan
+	// is applied
+	stdout.Unlock()
+	app.ApplyReload(plan)
+	stdout.Lock()
+}
+
 func interruptProcess() {
 	for {
 		num, err := strconv.Atoi(readline("Process # (-1 = Back): "))
@@ -550,8 +1014,12 @@ func addProcess() {
 		}
 		proc.Num = app.getNextNum()
 		if proc != nil {
-			app.AddProc(proc)
+			app.AddRuntimeProc(proc)
 			fmt.Print("Added process ", proc.Num)
+			if proc.Schedule != "" {
+				fmt.Println()
+				continue
+			}
 			if err := startProc(proc); err != nil {
 				fmt.Println("Error starting process:", err)
 			}
@@ -569,7 +1037,7 @@ func delProcess() {
 			return
 		}
 		proc := app.RemoveProcByNum(num)
-		if proc != nil {
+		if proc == nil {
 			fmt.Println("No process with num", num)
 			continue
 		}
@@ -592,11 +1060,99 @@ func startProc(proc *Process) error {
 }
 
 type Config struct {
-	ServerAddr string     `json:"serverAddr,omitempty" toml:"server-addr"`
-	OutDir     string     `json:"outDir,omitempty" toml:"out-dir"`
-	Env        []string   `json:"env,omitempty" toml:"env"`
-	ServerName string     `json:"serverName,omitempty" toml:"server-name"`
-	Procs      []*Process `json:"procs,omitempty" toml:"proc"`
+	ServerAddr string   `json:"serverAddr,omitempty" toml:"server-addr"`
+	OutDir     string   `json:"outDir,omitempty" toml:"out-dir"`
+	Env        []string `json:"env,omitempty" toml:"env"`
+	ServerName string   `json:"serverName,omitempty" toml:"server-name"`
+	StateFile  string   `json:"stateFile,omitempty" toml:"state-file"`
+	// bcrypt hash of the web password (see the hash-password command)
+	WebPasswordHash string `json:"webPasswordHash,omitempty" toml:"web-password-hash"`
+	// How long web sessions last after logging in (default is 1 day)
+	SessionTimeout time.Duration `json:"sessionTimeout,omitempty" toml:"session-timeout"`
+	// Certificate and key files to serve the web server over TLS with
+	TLSCert string `json:"tlsCert,omitempty" toml:"tls-cert"`
+	TLSKey  string `json:"tlsKey,omitempty" toml:"tls-key"`
+	// Serve over TLS with a generated self-signed certificate if no
+	// certificate is given
+	TLSSelfSigned bool `json:"tlsSelfSigned,omitempty" toml:"tls-self-signed"`
+
+	Procs []*Process `json:"procs,omitempty" toml:"proc"`
+	// Processes expanded into multiple instances (added after procs)
+	Templates []*ProcessTemplate `json:"templates,omitempty" toml:"template"`
+}
+
+// Parses and validates the config file at path (.json or .toml)
+func loadConfig(path string) (*Config, error) {
+	config := &Config{}
+	switch filepath.Ext(path) {
+	case ".json":
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("error opening config file: %v", err)
+		}
+		err = json.NewDecoder(f).Decode(config)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error parsing config file: %v", err)
+		}
+	case ".toml":
+		if _, err := toml.DecodeFile(path, config); err != nil {
+			return nil, fmt.Errorf("error parsing config file: %v", err)
+		}
+	default:
+		return nil, fmt.Errorf("invalid config file, expected .json or .toml file")
+	}
+	names := make(map[string]bool, len(config.Procs))
+	for _, proc := range config.Procs {
+		names[proc.Name] = true
+	}
+	for _, tmpl := range config.Templates {
+		procs, err := tmpl.expand()
+		if err != nil {
+			return nil, fmt.Errorf("invalid config: %v", err)
+		}
+		for _, proc := range procs {
+			if names[proc.Name] {
+				return nil, fmt.Errorf(
+					"invalid config: %s: process name in use: %s",
+					tmpl.Name, proc.Name,
+				)
+			}
+			names[proc.Name] = true
+		}
+		config.Procs = append(config.Procs, procs...)
+	}
+	if err := validateProcs(config.Procs); err != nil {
+		return nil, fmt.Errorf("invalid config: %v", err)
+	}
+	return config, nil
+}
+
+// Imports the processes from a Procfile or docker-compose file (printing any
+// warnings) and validates them
+func loadImport(path string) (*Config, error) {
+	config, warnings, err := importConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, w := range warnings {
+		Eprintln("Warning:", w)
+	}
+	if err := validateProcs(config.Procs); err != nil {
+		return nil, fmt.Errorf("invalid import: %v", err)
+	}
+	return config, nil
+}
+
+// Validates the processes of a config and their dependencies
+func validateProcs(procs []*Process) error {
+	for _, proc := range procs {
+		if err := proc.validate(); err != nil {
+			return err
+		}
+	}
+	_, err := sortByDeps(procs)
+	return err
 }
 
 type App struct {
@@ -606,7 +1162,17 @@ type App struct {
 	procsMtx    sync.RWMutex
 	outDir      string
 	waitOnce    sync.Once
+	doneCh      chan struct{}
 	wg          sync.WaitGroup
+
+	// Path of the config file the app was created from (used when reloading)
+	configPath string
+	reloadMtx  sync.Mutex
+
+	// State file (nil if not used)
+	state *stateDB
+	// Used to start sampling the resource usage once a process starts
+	sampleOnce sync.Once
 }
 
 func NewApp() *App {
@@ -626,24 +1192,42 @@ func AppFromConfig(config *Config) *App {
 	}
 	if config.ServerAddr != "" {
 		fmt.Println("Starting server on ", config.ServerAddr)
-		RunWeb(config.ServerAddr)
+		if err := RunWeb(config.ServerAddr); err != nil {
+			Eprintln("Error starting server:", err)
+		}
 	}
 	return app
 }
 
 func (a *App) AddProc(p *Process) {
-	env := make([]string, len(a.env), len(a.env)+len(p.Env))
-	copy(env, a.env)
-	p.Env = append(env, p.Env...)
+	p.Env = processEnv(a.env, p)
 	p.app = a
+	if p.logs == nil {
+		p.logs = NewLogBuffer(p.LogLines)
+	}
 	a.procsMtx.Lock()
 	p.Num = a.nextProcNum
 	a.nextProcNum++
 	a.procs = append(a.procs, p)
 	a.procsMtx.Unlock()
+	p.procMtx.Lock()
+	p.startWatching()
+	p.startScheduling()
+	p.procMtx.Unlock()
 	notify(NewMessageProc(ActionAdd, p))
 }
 
+func (a *App) GetProcByName(name string) *Process {
+	a.procsMtx.RLock()
+	defer a.procsMtx.RUnlock()
+	for _, proc := range a.procs {
+		if proc.Name == name {
+			return proc
+		}
+	}
+	return nil
+}
+
 func (a *App) GetProcByNum(num int) *Process {
 	a.procsMtx.RLock()
 	defer a.procsMtx.RUnlock()
@@ -661,7 +1245,14 @@ func (a *App) RemoveProc(name string) bool {
 	defer a.procsMtx.Unlock()
 	for i, proc := range a.procs {
 		if proc.Name == name {
+			proc.cancelRestart()
+			proc.procMtx.Lock()
+			proc.stopWatching()
+			proc.stopScheduling()
+			proc.procMtx.Unlock()
 			a.procs = append(a.procs[:i], a.procs[i+1:]...)
+			a.state.deleteProc(proc.Name)
+			proc.recordEvent(eventRemove, nil, "")
 			notify(Message{Action: ActionDel, Content: proc.Num})
 			return true
 		}
@@ -675,7 +1266,14 @@ func (a *App) RemoveProcByNum(num int) *Process {
 	defer a.procsMtx.Unlock()
 	for i, proc := range a.procs {
 		if proc.Num == num {
+			proc.cancelRestart()
+			proc.procMtx.Lock()
+			proc.stopWatching()
+			proc.stopScheduling()
+			proc.procMtx.Unlock()
 			a.procs = append(a.procs[:i], a.procs[i+1:]...)
+			a.state.deleteProc(proc.Name)
+			proc.recordEvent(eventRemove, nil, "")
 			notify(Message{Action: ActionDel, Content: proc.Num})
 			return proc
 		}
@@ -683,30 +1281,26 @@ func (a *App) RemoveProcByNum(num int) *Process {
 	return nil
 }
 
-func (a *App) StartProcs() {
+// Returns a copy of the app's processes
+func (a *App) procsSnapshot() []*Process {
 	a.procsMtx.RLock()
 	defer a.procsMtx.RUnlock()
-	for _, proc := range a.procs {
-		if proc.Delay != 0 {
-			time.Sleep(time.Second * proc.Delay)
-		}
-		if err := proc.Start(); err != nil && err != errProcRunning {
-			Printf(
-				"error starting process %d (%s): %v\n", proc.Num, proc.Name, err,
-			)
-		}
-	}
+	procs := make([]*Process, len(a.procs))
+	copy(procs, a.procs)
+	return procs
 }
 
 // Done returns as channel that is closed whenever all processes are done
 // (app.Wait() returns)
 func (a *App) Done() <-chan struct{} {
-	ch := make(chan struct{})
 	a.waitOnce.Do(func() {
-		a.Wait()
-		close(ch)
+		a.doneCh = make(chan struct{})
+		go func() {
+			a.Wait()
+			close(a.doneCh)
+		}()
 	})
-	return ch
+	return a.doneCh
 }
 
 func (a *App) Wait() {
@@ -739,50 +1333,296 @@ type Process struct {
 	OutFilename string        `json:"outFilename,omitempty" toml:"out-filename"`
 	ErrFilename string        `json:"errFilename,omitempty" toml:"err-filename"`
 	Delay       time.Duration `json:"delay,omitempty" toml:"delay"`
-	// TODO: use
+	// Working directory of the process
 	Dir string `json:"dir,omitempty" toml:"dir"`
 	Num int    `json:"num" toml:"-"`
+	// User and group (names or IDs) to run the process as (requires running
+	// as root)
+	User  string `json:"user,omitempty" toml:"user"`
+	Group string `json:"group,omitempty" toml:"group"`
+	// Octal umask of the process (e.g., "022")
+	Umask string `json:"umask,omitempty" toml:"umask"`
+	// Path of a dotenv file with environment variables for the process. They
+	// take precedence over the global env and are overridden by env.
+	EnvFile string `json:"envFile,omitempty" toml:"env-file"`
+	// Path of a file to use as the process's stdin
+	Stdin string `json:"stdin,omitempty" toml:"stdin"`
+	// Run the process in a pseudo-terminal, which clients can attach to (see
+	// attach.go). Its stdout and stderr are combined (as stdout).
+	Interactive bool `json:"interactive,omitempty" toml:"interactive"`
+	// Names of the processes that must be running before this one is started
+	DependsOn []string `json:"dependsOn,omitempty" toml:"depends-on"`
+	// Group the process is in and its tags, used to select processes for bulk
+	// actions (e.g., stopping all the processes in a group)
+	ProcGroup string   `json:"procGroup,omitempty" toml:"proc-group"`
+	Tags      []string `json:"tags,omitempty" toml:"tags"`
+
+	// Restart policy: "never" (default), "on-failure", or "always"
+	Restart string `json:"restart,omitempty" toml:"restart"`
+	// Time in seconds before the first restart, doubled on each consecutive
+	// restart
+	RestartDelay time.Duration `json:"restartDelay,omitempty" toml:"restart-delay"`
+	// Max time in seconds between restarts
+	RestartMaxDelay time.Duration `json:"restartMaxDelay,omitempty" toml:"restart-max-delay"`
+	// Max number of consecutive restarts (0 = no limit)
+	MaxRetries int `json:"maxRetries,omitempty" toml:"max-retries"`
+	// Time in seconds the process must run for before consecutive restarts
+	// are reset
+	RestartReset time.Duration `json:"restartReset,omitempty" toml:"restart-reset"`
+	// Check used to determine when the process is ready (healthy) after
+	// starting. Dependents aren't started until the process is ready.
+	Readiness *HealthCheck `json:"readiness,omitempty" toml:"readiness"`
+	// Check used to determine whether the process is still healthy
+	Liveness *HealthCheck `json:"liveness,omitempty" toml:"liveness"`
+	// Signal used to gracefully stop the process: "INT", "TERM" (default),
+	// "HUP", or "QUIT"
+	StopSignal string `json:"stopSignal,omitempty" toml:"stop-signal"`
+	// Time in seconds to wait for the process to exit after sending the stop
+	// signal before killing it
+	StopTimeout time.Duration `json:"stopTimeout,omitempty" toml:"stop-timeout"`
+	// Number of lines of output to keep in memory (default is 1000)
+	LogLines int `json:"logLines,omitempty" toml:"log-lines"`
+	// Size at which the output files are rotated (e.g., "10M"; no limit if
+	// empty)
+	MaxSize string `json:"maxSize,omitempty" toml:"max-size"`
+	// Time in seconds after which the output files are rotated (0 = never)
+	RotateInterval time.Duration `json:"rotateInterval,omitempty" toml:"rotate-interval"`
+	// Max number of rotated output files to keep (0 = keep all)
+	MaxFiles int `json:"maxFiles,omitempty" toml:"max-files"`
+	// Compress rotated output files with gzip
+	Compress bool `json:"compress,omitempty" toml:"compress"`
+	// Append to the output files when (re)starting rather than truncating them
+	AppendOutput bool `json:"appendOutput,omitempty" toml:"append-output"`
+	// Globs of the files (relative to dir) that cause the process to be
+	// restarted when changed. A "**" segment matches any number of
+	// directories (e.g., "**/*.go").
+	Watch []string `json:"watch,omitempty" toml:"watch"`
+	// Globs of the files and directories that aren't watched. Directories
+	// like .git, node_modules, vendor, and target are never watched unless a
+	// watch pattern names them.
+	Ignore []string `json:"ignore,omitempty" toml:"ignore"`
+	// Time in seconds (which may be fractional) to wait after a change for
+	// further changes before restarting (default is 0.5)
+	WatchDebounce float64 `json:"watchDebounce,omitempty" toml:"watch-debounce"`
+	// How the process is stopped when restarting after a change:
+	// "interrupt" (default), "kill", or "stop". The process is killed if it
+	// doesn't exit after the stop timeout when interrupted or stopped.
+	WatchRestart string `json:"watchRestart,omitempty" toml:"watch-restart"`
+	// Command (program and args) run before restarting after a change. The
+	// process isn't restarted if the command fails.
+	PreRestart []string `json:"preRestart,omitempty" toml:"pre-restart"`
+	// Max number of open files (0 = no limit)
+	LimitNofile uint64 `json:"limitNofile,omitempty" toml:"limit-nofile"`
+	// Max size of the address space (e.g., "1G"; no limit if empty)
+	LimitAS string `json:"limitAs,omitempty" toml:"limit-as"`
+	// Max CPU time in seconds (0 = no limit)
+	LimitCPU time.Duration `json:"limitCpu,omitempty" toml:"limit-cpu"`
+	// Nice value of the process, from -20 (highest priority) to 19 (lowest)
+	Nice int `json:"nice,omitempty" toml:"nice"`
+	// Cron expression (e.g., "*/15 * * * *"), descriptor (e.g., "@daily"), or
+	// interval (e.g., "@every 10m") the process is run on. Scheduled
+	// processes aren't started with the other processes.
+	Schedule string `json:"schedule,omitempty" toml:"schedule"`
+	// What is done when a scheduled run is due while the previous run is
+	// still running: "skip" (default), "queue", or "kill"
+	Overlap string `json:"overlap,omitempty" toml:"overlap"`
+	// Number of runs of a scheduled process kept in its history (default is
+	// 20)
+	RunHistory int `json:"runHistory,omitempty" toml:"run-history"`
+	// Rules evaluated on each line of output (e.g., restart the process when
+	// a line matches "panic:")
+	OnOutput []*OutputTrigger `json:"onOutput,omitempty" toml:"on-output"`
 
 	app              *App
 	cmd              *exec.Cmd
 	cancelFunc       context.CancelFunc
-	outFile, errFile *os.File
+	outFile, errFile *rotatingFile
+	startedAt        time.Time
+	// Whether the process was added while running (or restored from the state
+	// file) rather than from the config, in which case reloading the config
+	// never removes it
+	runtime bool
+	// Closed when the current run of the process exits
+	exited chan struct{}
+	// Closed when the current run of the process passes its readiness check,
+	// or fails it failure-threshold times in a row (unready)
+	ready, unready chan struct{}
+	// Last health check error (empty if it passed), time of the last health
+	// check, and total number of failed health checks
+	healthErr       string
+	lastHealthCheck time.Time
+	healthFailures  int
+	// Recent output and the writers capturing the current run's output
+	logs           *LogBuffer
+	outLog, errLog *logWriter
+	// Total bytes of stdout and stderr written by all runs
+	outBytes, errBytes atomic.Uint64
+	// Total number of restarts and number of consecutive restarts
+	restarts, retries int
+	nextRestart       time.Time
+	restartTimer      *time.Timer
+	// Whether the last run exited with an error on its own
+	crashed bool
+	// Exit code and error of the last run (nil and empty if it hasn't exited)
+	exitCode *int
+	exitErr  string
+	// Closed to stop watching the files
+	watchStop chan struct{}
+	// Last sampled resource usage (nil if not running)
+	usage *ResourceUsage
+	// Closed to stop running the process on its schedule
+	scheduleStop chan struct{}
+	// Time of the next scheduled run
+	nextRun time.Time
+	// Whether a scheduled run is waiting for the current run to exit and
+	// whether the current run was started by the schedule
+	queued, scheduledRun bool
+	// Recent runs of a scheduled process
+	runs []JobRun
+	// Last firing of an output trigger
+	lastTrigger *TriggerEvent
+	// Pseudo-terminal of the current run (nil if not interactive)
+	pty *processPTY
 	// Mutex for all from app to here
 	procMtx sync.RWMutex
 	status  atomic.Uint32
 }
 
+// Used to marshal the exported fields of Process without recursing
+type processJSON Process
+
 func (p *Process) MarshalJSON() ([]byte, error) {
-	name, _ := json.Marshal(p.Name)
-	prog, _ := json.Marshal(p.Program)
-	args, _ := json.Marshal(p.Args)
-	env, _ := json.Marshal(p.Env)
-	dir, _ := json.Marshal(p.Dir)
-	outFilename, _ := json.Marshal(p.OutFilename)
-	errFilename, _ := json.Marshal(p.ErrFilename)
-	num, _ := json.Marshal(p.Num)
-	status, _ := json.Marshal(statusString(p.status.Load()))
-	return []byte(fmt.Sprintf(
-		`{"name":%s,"program":%s,"args":%s,"env":%s,"dir":%s,"outFilename":%s,"errFilename":%s,"num":%s,"status":%s}`,
-		name, prog, args, env, dir, outFilename, errFilename, num, status,
-	)), nil
+	p.procMtx.RLock()
+	defer p.procMtx.RUnlock()
+	var nextRestart, nextRun *time.Time
+	if !p.nextRestart.IsZero() {
+		nextRestart = &p.nextRestart
+	}
+	if !p.nextRun.IsZero() {
+		nextRun = &p.nextRun
+	}
+	return json.Marshal(struct {
+		*processJSON
+		Status      string         `json:"status"`
+		Restarts    int            `json:"restarts"`
+		NextRestart *time.Time     `json:"nextRestart,omitempty"`
+		HealthErr   string         `json:"healthErr,omitempty"`
+		Usage       *ResourceUsage `json:"usage,omitempty"`
+		NextRun     *time.Time     `json:"nextRun,omitempty"`
+		LastTrigger *TriggerEvent  `json:"lastTrigger,omitempty"`
+	}{
+		processJSON: (*processJSON)(p),
+		Status:      statusString(p.status.Load()),
+		Restarts:    p.restarts,
+		NextRestart: nextRestart,
+		HealthErr:   p.healthErr,
+		Usage:       p.usage,
+		NextRun:     nextRun,
+		LastTrigger: p.lastTrigger,
+	})
+}
+
+// Returns an error if the process isn't valid
+func (p *Process) validate() error {
+	if p.Name == "" {
+		return fmt.Errorf("missing process name")
+	} else if p.Program == "" {
+		return fmt.Errorf("%s: missing program", p.Name)
+	}
+	for _, pair := range p.Env {
+		if pair != "" && !strings.Contains(pair, "=") {
+			return fmt.Errorf(
+				"%s: invalid environment variable key-value pair: %s",
+				p.Name, pair,
+			)
+		}
+	}
+	if !validRestartPolicy(p.Restart) {
+		return fmt.Errorf("%s: invalid restart policy: %s", p.Name, p.Restart)
+	} else if p.MaxRetries < 0 {
+		return fmt.Errorf("%s: max retries must be non-negative", p.Name)
+	} else if p.LogLines < 0 {
+		return fmt.Errorf("%s: log lines must be non-negative", p.Name)
+	} else if p.MaxFiles < 0 {
+		return fmt.Errorf("%s: max files must be non-negative", p.Name)
+	}
+	if _, err := parseSize(p.MaxSize); err != nil {
+		return fmt.Errorf("%s: %v", p.Name, err)
+	}
+	for _, glob := range append(p.Watch, p.Ignore...) {
+		if err := validateGlob(glob); err != nil {
+			return fmt.Errorf("%s: %v", p.Name, err)
+		}
+	}
+	if err := p.validateExec(); err != nil {
+		return err
+	}
+	if err := p.validateLimits(); err != nil {
+		return err
+	}
+	for _, tag := range p.Tags {
+		if strings.TrimSpace(tag) == "" {
+			return fmt.Errorf("%s: empty tag", p.Name)
+		}
+	}
+	if p.Schedule != "" {
+		if _, err := parseSchedule(p.Schedule); err != nil {
+			return fmt.Errorf("%s: %v", p.Name, err)
+		}
+	}
+	for _, t := range p.OnOutput {
+		if t == nil {
+			return fmt.Errorf("%s: empty output trigger", p.Name)
+		} else if err := t.validate(); err != nil {
+			return fmt.Errorf("%s: output trigger: %v", p.Name, err)
+		}
+	}
+	if !validOverlap(p.Overlap) {
+		return fmt.Errorf("%s: invalid overlap policy: %s", p.Name, p.Overlap)
+	}
+	if !validWatchRestart(p.WatchRestart) {
+		return fmt.Errorf(
+			"%s: invalid watch restart method: %s", p.Name, p.WatchRestart,
+		)
+	}
+	if p.StopSignal != "" {
+		if _, err := parseStopSignal(p.StopSignal); err != nil {
+			return fmt.Errorf("%s: %v", p.Name, err)
+		}
+	}
+	if p.Readiness != nil {
+		if err := p.Readiness.validate(); err != nil {
+			return fmt.Errorf("%s: readiness: %v", p.Name, err)
+		}
+	}
+	if p.Liveness != nil {
+		if err := p.Liveness.validate(); err != nil {
+			return fmt.Errorf("%s: liveness: %v", p.Name, err)
+		}
+	}
+	return nil
 }
 
 func (p *Process) populateCmd() {
-	if p.status.Load() == statusRunning {
+	if isRunningStatus(p.status.Load()) {
 		return
 	}
 	ctx, cancel := context.WithCancel(context.Background())
 	p.cmd = exec.CommandContext(ctx, p.Program, p.Args...)
 	p.cancelFunc, p.cmd.Env = cancel, p.Env
+	p.cmd.WaitDelay = outputWaitDelay
+	// Put the process in its own process group so that it and its children can
+	// be signalled together
+	p.cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
 }
 
 func (p *Process) kill() error {
-	if !p.status.CompareAndSwap(statusRunning, statusFinished) {
+	p.cancelRestart()
+	if !p.markFinished() {
 		return nil
 	}
 	if p.cmd != nil && p.cmd.Process != nil {
-		err := p.cmd.Process.Signal(os.Kill)
+		err := p.signal(syscall.SIGKILL)
 		notify(Message{Action: ActionKill, Content: p.Num})
 		return err
 	}
@@ -790,79 +1630,153 @@ func (p *Process) kill() error {
 }
 
 func (p *Process) interrupt() error {
-	if !p.status.CompareAndSwap(statusRunning, statusFinished) {
+	p.cancelRestart()
+	if !p.markFinished() {
 		return nil
 	}
 	if p.cmd != nil && p.cmd.Process != nil {
-		err := p.cmd.Process.Signal(os.Interrupt)
+		err := p.signal(syscall.SIGINT)
 		notify(Message{Action: ActionInterrupt, Content: p.Num})
 		return err
 	}
 	return nil
 }
 
+// Stops the process using the given stop function, waits for it to exit, and
+// starts it again
+func (p *Process) restart(stop func(*Process) error) error {
+	if err := stop(p); err != nil {
+		return err
+	}
+	p.waitExit()
+	return p.Start()
+}
+
+// Sets the status to finished if the process is running. Returns true if the
+// status was changed.
+func (p *Process) markFinished() bool {
+	for {
+		status := p.status.Load()
+		if !isRunningStatus(status) {
+			return false
+		} else if p.status.CompareAndSwap(status, statusFinished) {
+			return true
+		}
+	}
+}
+
 func (p *Process) Start() error {
-	if p.status.Load() == statusRunning {
+	if isRunningStatus(p.status.Load()) {
 		return errProcRunning
 	}
 	p.procMtx.Lock()
 	defer p.procMtx.Unlock()
+	// Started before a pending restart
+	p.stopRestartTimer()
 	p.populateCmd()
-	var err error
+	p.pty = nil
+	stdin, err := p.setupCmd()
+	if err != nil {
+		p.cancelFunc()
+		return err
+	}
+	if stdin != nil {
+		// The process has its own copy once started
+		defer stdin.Close()
+	}
+	p.startedAt = time.Now()
+	// Capture the output in the log buffer, as well as in the output files, if
+	// any
+	if p.logs == nil {
+		p.logs = NewLogBuffer(p.LogLines)
+	}
+	p.outLog = newLogWriter(p.logs, streamStdout, &p.outBytes)
+	p.errLog = newLogWriter(p.logs, streamStderr, &p.errBytes)
+	if onLine := p.outputTriggers(p.OnOutput); onLine != nil {
+		p.outLog.onLine, p.errLog.onLine = onLine, onLine
+	}
+	p.cmd.Stdout, p.cmd.Stderr = p.outLog, p.errLog
 	// Open the files for output
 	if p.OutFilename != "" {
-		if p.OutFilename == "-" {
-			p.OutFilename = fmt.Sprintf("process%d-stdout.txt", p.Num)
-		} else if p.OutFilename == "%" {
-			p.OutFilename = fmt.Sprintf("%s-stdout.txt", p.Name)
-		}
-		p.outFile, err = os.Create(filepath.Join(p.app.outDir, p.OutFilename))
+		p.OutFilename = p.expandFilename(p.OutFilename, streamStdout)
+		p.outFile, err = openRotatingFile(
+			filepath.Join(p.app.outDir, p.OutFilename),
+			p.AppendOutput, p.rotateOpts(),
+		)
 		if err != nil {
 			Printf(
 				"Error creating stdout output file for %s: %v\n",
 				p.Name, err,
 			)
+		} else {
+			p.cmd.Stdout = io.MultiWriter(p.outFile, p.outLog)
 		}
-		p.cmd.Stdout = p.outFile
 	}
 	if p.ErrFilename != "" {
-		if p.ErrFilename == "-" {
-			p.ErrFilename = fmt.Sprintf("process%d-stderr.txt", p.Num)
-		} else if p.ErrFilename == "%" {
-			p.ErrFilename = fmt.Sprintf("%s-stderr.txt", p.Name)
-		} else if p.ErrFilename == p.OutFilename {
+		p.ErrFilename = p.expandFilename(p.ErrFilename, streamStderr)
+		if p.ErrFilename == p.OutFilename {
 			// Same file
 			p.ErrFilename = p.OutFilename
+			if p.outFile != nil {
+				p.cmd.Stderr = io.MultiWriter(p.outFile, p.errLog)
+			}
 			goto StartProc
 		}
-		p.errFile, err = os.Create(filepath.Join(p.app.outDir, p.ErrFilename))
+		p.errFile, err = openRotatingFile(
+			filepath.Join(p.app.outDir, p.ErrFilename),
+			p.AppendOutput, p.rotateOpts(),
+		)
 		if err != nil {
 			Printf(
 				"Error creating stderr output file for %s: %v\n",
 				p.Name, err,
 			)
+		} else {
+			p.cmd.Stderr = io.MultiWriter(p.errFile, p.errLog)
 		}
-		p.cmd.Stderr = p.errFile
 	}
 StartProc:
+	if p.pty != nil {
+		// The output is read from the terminal (see processPTY.readLoop)
+		p.pty.out = p.cmd.Stdout
+		p.cmd.Stdout, p.cmd.Stderr = p.pty.tty, p.pty.tty
+	}
 	// Start the process
-	if err := p.cmd.Start(); err != nil {
+	if err := p.startCmd(); err != nil {
+		if p.pty != nil {
+			p.pty.close()
+			p.pty = nil
+		}
+		p.recordEvent(eventStartFailed, nil, err.Error())
 		p.status.Store(statusFinished)
-		// Delete the created files
+		// Delete the created files (unless they're being appended to)
 		if p.outFile != nil {
 			p.outFile.Close()
-			if err := os.Remove(p.outFile.Name()); err != nil {
-				Printf("Error removing stdout file for %s: %v\n", p.Name, err)
+			if !p.AppendOutput {
+				if err := os.Remove(p.outFile.Name()); err != nil {
+					Printf("Error removing stdout file for %s: %v\n", p.Name, err)
+				}
 			}
 		}
 		if p.errFile != nil {
 			p.errFile.Close()
-			if err := os.Remove(p.errFile.Name()); err != nil {
-				Printf("Error removing stderr file for %s: %v\n", p.Name, err)
+			if !p.AppendOutput {
+				if err := os.Remove(p.errFile.Name()); err != nil {
+					Printf("Error removing stderr file for %s: %v\n", p.Name, err)
+				}
 			}
 		}
 		return err
 	}
+	p.recordEvent(eventStart, nil, fmt.Sprintf("pid %d", p.cmd.Process.Pid))
+	if p.pty != nil {
+		go p.pty.readLoop()
+	}
+	p.exited, p.ready, p.unready = make(chan struct{}), nil, nil
+	if p.Readiness != nil || hasMarkReadyTrigger(p.OnOutput) {
+		p.ready, p.unready = make(chan struct{}), make(chan struct{})
+	}
+	p.healthErr, p.crashed = "", false
 	p.status.Store(statusRunning)
 	p.app.wg.Add(1)
 	// Wait for the process to finish
@@ -870,12 +1784,53 @@ StartProc:
 		notify(NewMessageProc(ActionStart, p))
 		p.Wait()
 	}()
+	if p.Readiness != nil || p.Liveness != nil {
+		go p.runHealthChecks(p.exited, p.ready, p.unready)
+	}
+	if limitsSupported {
+		p.app.startSampling()
+	}
 	return nil
 }
 
+// Expands the special output filenames: "-" is replaced with
+// process[num]-[stream].txt and "%" with [name]-[stream].txt. The special
+// values can also have a directory and extension, e.g., "logs/-.log" is
+// logs/process[num]-[stream].log.
+func (p *Process) expandFilename(filename, stream string) string {
+	dir, base := filepath.Split(filename)
+	ext := filepath.Ext(base)
+	if ext == base {
+		// No extension (e.g., ".log" is a name, not an extension)
+		ext = ""
+	}
+	if ext == "" {
+		ext = ".txt"
+	}
+	switch strings.TrimSuffix(base, ext) {
+	case "-":
+		return dir + fmt.Sprintf("process%d-%s%s", p.Num, stream, ext)
+	case "%":
+		return dir + fmt.Sprintf("%s-%s%s", p.Name, stream, ext)
+	}
+	return filename
+}
+
 func (p *Process) Wait() {
+	p.procMtx.RLock()
+	outLog, errLog, pty := p.outLog, p.errLog, p.pty
+	p.procMtx.RUnlock()
 	err := p.cmd.Wait()
-	alreadyDone := p.status.Swap(statusFinished) != statusRunning
+	if errors.Is(err, exec.ErrWaitDelay) {
+		// Exited successfully but its children still hold its output
+		err = nil
+	}
+	if pty != nil {
+		pty.wait()
+	}
+	outLog.Flush()
+	errLog.Flush()
+	alreadyDone := !isRunningStatus(p.status.Swap(statusFinished))
 	notify(Message{Action: ActionFinished, Content: p.Num})
 	// TODO: Handle error better to ignore when the user stops the program
 	if err != nil && !alreadyDone {
@@ -890,6 +1845,21 @@ func (p *Process) Wait() {
 	if p.errFile != nil {
 		p.errFile.Close()
 	}
+	exitCode, detail := p.cmd.ProcessState.ExitCode(), ""
+	if err != nil {
+		detail = err.Error()
+	}
+	p.procMtx.Lock()
+	p.crashed = err != nil && !alreadyDone
+	p.exitCode, p.exitErr = &exitCode, detail
+	p.usage = nil
+	close(p.exited)
+	p.procMtx.Unlock()
+	p.recordEvent(eventExit, &exitCode, detail)
+	p.finishRun(err)
+	if !alreadyDone {
+		p.scheduleRestart(err)
+	}
 	p.app.wg.Done()
 }
 
@@ -897,6 +1867,10 @@ const (
 	statusNotStarted uint32 = iota
 	statusRunning
 	statusFinished
+	// Running and passing its health checks
+	statusHealthy
+	// Running and failing its health checks
+	statusUnhealthy
 )
 
 func statusString(u uint32) string {
@@ -907,11 +1881,20 @@ func statusString(u uint32) string {
 		return "RUNNING"
 	case statusFinished:
 		return "FINISHED"
+	case statusHealthy:
+		return "HEALTHY"
+	case statusUnhealthy:
+		return "UNHEALTHY"
 	default:
 		return "UNKNOWN"
 	}
 }
 
+// Returns true if the status is one where the process is running
+func isRunningStatus(u uint32) bool {
+	return u == statusRunning || u == statusHealthy || u == statusUnhealthy
+}
+
 var stdinReader = bufio.NewReader(os.Stdin)
 
 func readline(prompt ...string) string {
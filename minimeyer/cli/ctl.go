@@ -0,0 +1,732 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+func NewCtlCmd() *cobra.Command {
+	ctlCmd := &cobra.Command{
+		Use:   "ctl",
+		Short: "Control a running minimeyer",
+		Long: `Control a running minimeyer (e.g., one started with "cli --daemon")
+through its control socket. Processes can be referred to by number or name,
+and groups of processes by group (group:NAME) or tag (tag:NAME).`,
+	}
+	ctlCmd.PersistentFlags().StringP(
+		"socket", "s", DefaultSocketPath(), "Path of the control socket",
+	)
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the processes",
+		Args:  cobra.ExactArgs(0),
+		Run:   ctlList,
+	}
+	listCmd.Flags().Bool("json", false, "Print the processes as JSON")
+
+	startCmd := &cobra.Command{
+		Use:   "start PROC...",
+		Short: "Start processes",
+		Args:  cobra.MinimumNArgs(1),
+		Run:   ctlStart,
+	}
+
+	stopCmd := &cobra.Command{
+		Use:   "stop PROC...",
+		Short: "Stop processes, waiting for them to exit",
+		Args:  cobra.MinimumNArgs(1),
+		Run:   ctlStop,
+	}
+	addStopFlags(stopCmd)
+
+	restartCmd := &cobra.Command{
+		Use:   "restart PROC...",
+		Short: "Stop processes (if running) and start them again",
+		Args:  cobra.MinimumNArgs(1),
+		Run:   ctlRestart,
+	}
+	addStopFlags(restartCmd)
+
+	addCmd := &cobra.Command{
+		Use:   "add [NAME PROGRAM [ARGS...]]",
+		Short: "Add and start a process",
+		Long: `Add and start a process. The process is either given on the command line
+or read from a JSON file (--file) containing a process or array of processes
+in the same format as the procs in a JSON config file.`,
+		Run: ctlAdd,
+	}
+	addFlags := addCmd.Flags()
+	addFlags.StringP(
+		"file", "f", "", `JSON file to read the process(es) from ("-" for stdin)`,
+	)
+	addFlags.String("out", "", "Path of the stdout output file")
+	addFlags.String("err", "", "Path of the stderr output file")
+	addFlags.StringArray("env", nil, "Environment variable (key=value)")
+	addFlags.StringSlice("depends-on", nil, "Names of the process's dependencies")
+	addFlags.String("restart", "", "Restart policy")
+	addFlags.String("group", "", "Group of the process")
+	addFlags.StringSlice("tags", nil, "Tags of the process")
+	addFlags.String("schedule", "", `Schedule to run the process on (e.g., "@every 10m")`)
+
+	delCmd := &cobra.Command{
+		Use:   "del PROC...",
+		Short: "Delete processes",
+		Args:  cobra.MinimumNArgs(1),
+		Run:   ctlDel,
+	}
+
+	logsCmd := &cobra.Command{
+		Use:   "logs PROC",
+		Short: "Print the recent output of a process",
+		Args:  cobra.ExactArgs(1),
+		Run:   ctlLogs,
+	}
+	logsFlags := logsCmd.Flags()
+	logsFlags.IntP("lines", "n", 0, "Number of lines to print (0 = all kept)")
+	logsFlags.BoolP("follow", "f", false, "Keep printing new output")
+	logsFlags.Bool("raw", false, "Print only the lines, without time and stream")
+
+	runsCmd := &cobra.Command{
+		Use:   "runs PROC",
+		Short: "Print the recent runs of a scheduled process",
+		Args:  cobra.ExactArgs(1),
+		Run:   ctlRuns,
+	}
+	runsCmd.Flags().Bool("json", false, "Print the runs as JSON")
+
+	historyCmd := &cobra.Command{
+		Use:   "history [PROC]",
+		Short: "Print the history of processes from the state file",
+		Args:  cobra.MaximumNArgs(1),
+		Run:   ctlHistory,
+	}
+	historyCmd.Flags().IntP(
+		"limit", "n", defaultHistoryLimit, "Max number of events",
+	)
+	historyCmd.Flags().Bool("json", false, "Print the events as JSON")
+
+	reloadCmd := &cobra.Command{
+		Use:   "reload",
+		Short: "Reload the config file, printing the changes made",
+		Args:  cobra.ExactArgs(0),
+		Run:   ctlReload,
+	}
+	reloadCmd.Flags().BoolP(
+		"dry-run", "n", false, "Only print the changes that would be made",
+	)
+
+	attachCmd := &cobra.Command{
+		Use:   "attach PROC",
+		Short: "Attach to the terminal of an interactive process (Ctrl-] detaches)",
+		Args:  cobra.ExactArgs(1),
+		Run:   ctlAttach,
+	}
+
+	ctlCmd.AddCommand(
+		listCmd, startCmd, stopCmd, restartCmd, addCmd, delCmd, logsCmd,
+		runsCmd, historyCmd, reloadCmd, attachCmd,
+	)
+	return ctlCmd
+}
+
+func addStopFlags(cmd *cobra.Command) {
+	cmd.Flags().Bool("kill", false, "Kill the process instead of stopping it")
+	cmd.Flags().Bool(
+		"interrupt", false, "Interrupt the process instead of stopping it",
+	)
+	cmd.MarkFlagsMutuallyExclusive("kill", "interrupt")
+}
+
+// A message received by the ctl client. The processes and content are kept
+// in their JSON form since processes are sent with additional info (e.g.,
+// status) and the content depends on the action.
+type ctlMessage struct {
+	Action    string            `json:"action"`
+	Processes []json.RawMessage `json:"processes,omitempty"`
+	Content   json.RawMessage   `json:"content,omitempty"`
+	Error     string            `json:"error,omitempty"`
+}
+
+// Returns the number in the content, or -1 if it isn't a number
+func (m ctlMessage) contentNum() int {
+	var num int
+	if err := json.Unmarshal(m.Content, &num); err != nil {
+		return -1
+	}
+	return num
+}
+
+// A process received by the ctl client
+type ctlProcess struct {
+	Num       int            `json:"num"`
+	Name      string         `json:"name"`
+	Program   string         `json:"program"`
+	Args      []string       `json:"args"`
+	Status    string         `json:"status"`
+	Restarts  int            `json:"restarts"`
+	HealthErr string         `json:"healthErr"`
+	Usage     *ResourceUsage `json:"usage,omitempty"`
+	Schedule  string         `json:"schedule,omitempty"`
+	NextRun   *time.Time     `json:"nextRun,omitempty"`
+	ProcGroup string         `json:"procGroup,omitempty"`
+	Tags      []string       `json:"tags,omitempty"`
+}
+
+func (p ctlProcess) running() bool {
+	switch p.Status {
+	case statusString(statusRunning),
+		statusString(statusHealthy),
+		statusString(statusUnhealthy):
+		return true
+	}
+	return false
+}
+
+type ctlClient struct {
+	conn net.Conn
+	d    *json.Decoder
+}
+
+// Connects to the control socket, exiting if it fails
+func dialCtl(cmd *cobra.Command) *ctlClient {
+	log.SetFlags(0)
+	path, _ := cmd.Flags().GetString("socket")
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		log.Fatal("error connecting to control socket: ", err)
+	}
+	c := &ctlClient{conn: conn, d: json.NewDecoder(conn)}
+	msg, err := c.recv()
+	if err != nil {
+		log.Fatal("error connecting to control socket: ", err)
+	} else if msg.Action != ActionConnected {
+		log.Fatal("unexpected message from control socket: ", msg.Action)
+	}
+	return c
+}
+
+func (c *ctlClient) send(msg Message) error {
+	return sendMsg(c.conn, msg)
+}
+
+func (c *ctlClient) recv() (ctlMessage, error) {
+	var msg ctlMessage
+	err := c.d.Decode(&msg)
+	if err == io.EOF {
+		err = fmt.Errorf("connection closed")
+	}
+	return msg, err
+}
+
+// Sends the messages and waits for them to be handled, returning all the
+// processes and the other messages received in the meantime. Returns the
+// first error sent by the server, if any.
+func (c *ctlClient) sync(msgs ...Message) ([]ctlProcess, []ctlMessage, error) {
+	for _, msg := range append(msgs, Message{Action: ActionRefresh}) {
+		if err := c.send(msg); err != nil {
+			return nil, nil, err
+		}
+	}
+	var (
+		others   []ctlMessage
+		firstErr error
+	)
+	for {
+		msg, err := c.recv()
+		if err != nil {
+			return nil, nil, err
+		}
+		if msg.Error != "" {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("%s", msg.Error)
+			}
+			continue
+		}
+		if msg.Action != ActionRefresh || string(msg.Content) != "[-1]" {
+			others = append(others, msg)
+			continue
+		}
+		procs := make([]ctlProcess, len(msg.Processes))
+		for i, raw := range msg.Processes {
+			if err := json.Unmarshal(raw, &procs[i]); err != nil {
+				return nil, nil, err
+			}
+		}
+		return procs, others, firstErr
+	}
+}
+
+// Returns the processes referred to by the args (numbers or names)
+func (c *ctlClient) resolve(args []string) ([]ctlProcess, error) {
+	procs, _, err := c.sync()
+	if err != nil {
+		return nil, err
+	}
+	var found []ctlProcess
+ArgsLoop:
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "group:") || strings.HasPrefix(arg, "tag:") {
+			sel, err := parseSelector(arg)
+			if err != nil {
+				return nil, err
+			}
+			n := len(found)
+			for _, proc := range procs {
+				if sel.matchesCtl(proc) {
+					found = append(found, proc)
+				}
+			}
+			if len(found) == n {
+				return nil, fmt.Errorf("no processes in %s", sel)
+			}
+			continue
+		}
+		num, numErr := strconv.Atoi(arg)
+		for _, proc := range procs {
+			if (numErr == nil && proc.Num == num) || proc.Name == arg {
+				found = append(found, proc)
+				continue ArgsLoop
+			}
+		}
+		return nil, fmt.Errorf("no process %s", arg)
+	}
+	return found, nil
+}
+
+// Stops the process (if it's running), waiting for it to exit
+func (c *ctlClient) stop(proc ctlProcess, action string) error {
+	if !proc.running() {
+		return nil
+	}
+	if err := c.send(Message{Action: action, Content: proc.Num}); err != nil {
+		return err
+	}
+	for {
+		msg, err := c.recv()
+		if err != nil {
+			return err
+		} else if msg.Error != "" {
+			return fmt.Errorf("%s", msg.Error)
+		}
+		switch msg.Action {
+		case ActionFinished, ActionDel:
+			if msg.contentNum() == proc.Num {
+				return nil
+			}
+		}
+	}
+}
+
+// Returns the action used to stop processes based on the flags
+func stopAction(cmd *cobra.Command) string {
+	if kill, _ := cmd.Flags().GetBool("kill"); kill {
+		return ActionKill
+	} else if interrupt, _ := cmd.Flags().GetBool("interrupt"); interrupt {
+		return ActionInterrupt
+	}
+	return ActionStop
+}
+
+func ctlList(cmd *cobra.Command, args []string) {
+	c := dialCtl(cmd)
+	procs, _, err := c.sync()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if asJSON, _ := cmd.Flags().GetBool("json"); asJSON {
+		e := json.NewEncoder(os.Stdout)
+		e.SetIndent("", "  ")
+		e.Encode(procs)
+		return
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NUM\tNAME\tGROUP\tSTATUS\tRESTARTS\tCPU\tRSS\tCOMMAND")
+	for _, proc := range procs {
+		cpu, rss, group := "-", "-", "-"
+		if proc.ProcGroup != "" {
+			group = proc.ProcGroup
+		}
+		if proc.Usage != nil {
+			cpu = fmt.Sprintf("%.1f%%", proc.Usage.CPUPercent)
+			rss = formatSize(proc.Usage.RSS)
+		}
+		fmt.Fprintf(
+			tw, "%d\t%s\t%s\t%s\t%d\t%s\t%s\t%s\n",
+			proc.Num, proc.Name, group, proc.Status, proc.Restarts, cpu, rss,
+			strings.Join(append([]string{proc.Program}, proc.Args...), " "),
+		)
+	}
+	tw.Flush()
+}
+
+func ctlStart(cmd *cobra.Command, args []string) {
+	c := dialCtl(cmd)
+	procs, err := c.resolve(args)
+	if err != nil {
+		log.Fatal(err)
+	}
+	failed := false
+	for _, proc := range procs {
+		_, _, err := c.sync(Message{Action: ActionStart, Content: proc.Num})
+		if err != nil {
+			Eprintf("Error starting %d (%s): %v\n", proc.Num, proc.Name, err)
+			failed = true
+		} else {
+			Printf("Started %d (%s)\n", proc.Num, proc.Name)
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func ctlStop(cmd *cobra.Command, args []string) {
+	c := dialCtl(cmd)
+	procs, err := c.resolve(args)
+	if err != nil {
+		log.Fatal(err)
+	}
+	action, failed := stopAction(cmd), false
+	for _, proc := range procs {
+		if err := c.stop(proc, action); err != nil {
+			Eprintf("Error stopping %d (%s): %v\n", proc.Num, proc.Name, err)
+			failed = true
+		} else {
+			Printf("Stopped %d (%s)\n", proc.Num, proc.Name)
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func ctlRestart(cmd *cobra.Command, args []string) {
+	c := dialCtl(cmd)
+	procs, err := c.resolve(args)
+	if err != nil {
+		log.Fatal(err)
+	}
+	action, failed := stopAction(cmd), false
+	for _, proc := range procs {
+		if err := c.stop(proc, action); err != nil {
+			Eprintf("Error stopping %d (%s): %v\n", proc.Num, proc.Name, err)
+			failed = true
+			continue
+		}
+		_, _, err := c.sync(Message{Action: ActionStart, Content: proc.Num})
+		if err != nil {
+			Eprintf("Error starting %d (%s): %v\n", proc.Num, proc.Name, err)
+			failed = true
+		} else {
+			Printf("Restarted %d (%s)\n", proc.Num, proc.Name)
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func ctlAdd(cmd *cobra.Command, args []string) {
+	flags := cmd.Flags()
+	var procs []*Process
+	if path, _ := flags.GetString("file"); path != "" {
+		if len(args) != 0 {
+			log.Fatal("can't pass process on command line with --file")
+		}
+		var data []byte
+		var err error
+		if path == "-" {
+			data, err = io.ReadAll(os.Stdin)
+		} else {
+			data, err = os.ReadFile(path)
+		}
+		if err != nil {
+			log.Fatal("error reading file: ", err)
+		}
+		if err := json.Unmarshal(data, &procs); err != nil {
+			proc := &Process{}
+			if json.Unmarshal(data, proc) != nil {
+				log.Fatal("error parsing file: ", err)
+			}
+			procs = []*Process{proc}
+		}
+	} else {
+		if len(args) < 2 {
+			log.Fatal("must provide name and program (or --file)")
+		}
+		proc := &Process{Name: args[0], Program: args[1], Args: args[2:]}
+		proc.OutFilename, _ = flags.GetString("out")
+		proc.ErrFilename, _ = flags.GetString("err")
+		proc.Env, _ = flags.GetStringArray("env")
+		proc.DependsOn, _ = flags.GetStringSlice("depends-on")
+		proc.Restart, _ = flags.GetString("restart")
+		proc.Schedule, _ = flags.GetString("schedule")
+		proc.ProcGroup, _ = flags.GetString("group")
+		proc.Tags, _ = flags.GetStringSlice("tags")
+		procs = []*Process{proc}
+	}
+
+	c := dialCtl(cmd)
+	_, msgs, err := c.sync(Message{Action: ActionAdd, Processes: procs})
+	for _, msg := range msgs {
+		if msg.Action != ActionAdd {
+			continue
+		}
+		for _, raw := range msg.Processes {
+			var proc ctlProcess
+			if json.Unmarshal(raw, &proc) == nil {
+				Printf("Added %d (%s)\n", proc.Num, proc.Name)
+			}
+		}
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func ctlDel(cmd *cobra.Command, args []string) {
+	c := dialCtl(cmd)
+	procs, err := c.resolve(args)
+	if err != nil {
+		log.Fatal(err)
+	}
+	failed := false
+	for _, proc := range procs {
+		_, _, err := c.sync(Message{Action: ActionDel, Content: proc.Num})
+		if err != nil {
+			Eprintf("Error deleting %d (%s): %v\n", proc.Num, proc.Name, err)
+			failed = true
+		} else {
+			Printf("Deleted %d (%s)\n", proc.Num, proc.Name)
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func ctlReload(cmd *cobra.Command, args []string) {
+	msg := Message{Action: ActionReload}
+	if dryRun, _ := cmd.Flags().GetBool("dry-run"); dryRun {
+		msg.Content = "plan"
+	}
+	c := dialCtl(cmd)
+	_, msgs, err := c.sync(msg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, msg := range msgs {
+		if msg.Action != ActionReload {
+			continue
+		}
+		plan := &ReloadPlan{}
+		if err := json.Unmarshal(msg.Content, plan); err != nil {
+			log.Fatal("error parsing plan: ", err)
+		}
+		fmt.Println(plan)
+		break
+	}
+}
+
+func ctlLogs(cmd *cobra.Command, args []string) {
+	flags := cmd.Flags()
+	n, _ := flags.GetInt("lines")
+	follow, _ := flags.GetBool("follow")
+	raw, _ := flags.GetBool("raw")
+
+	c := dialCtl(cmd)
+	procs, err := c.resolve(args)
+	if err != nil {
+		log.Fatal(err)
+	}
+	num := procs[0].Num
+	if err := c.send(Message{Action: ActionTail, Content: num}); err != nil {
+		log.Fatal(err)
+	}
+	for first := true; first || follow; {
+		msg, err := c.recv()
+		if err != nil {
+			log.Fatal(err)
+		} else if msg.Error != "" {
+			log.Fatal(msg.Error)
+		}
+		if msg.Action == ActionDel && msg.contentNum() == num {
+			return
+		} else if msg.Action != ActionLog {
+			continue
+		}
+		var logs LogsContent
+		if err := json.Unmarshal(msg.Content, &logs); err != nil {
+			log.Fatal("error parsing logs: ", err)
+		} else if logs.Num != num {
+			continue
+		}
+		lines := logs.Lines
+		if first && n > 0 && len(lines) > n {
+			lines = lines[len(lines)-n:]
+		}
+		for _, line := range lines {
+			if raw {
+				fmt.Println(line.Line)
+			} else {
+				fmt.Println(line)
+			}
+		}
+		first = false
+	}
+}
+
+func ctlAttach(cmd *cobra.Command, args []string) {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		log.Fatal("stdin must be a terminal to attach")
+	}
+	c := dialCtl(cmd)
+	procs, err := c.resolve(args)
+	if err != nil {
+		log.Fatal(err)
+	}
+	proc := procs[0]
+	if err := c.send(Message{Action: ActionAttach, Content: proc.Num}); err != nil {
+		log.Fatal(err)
+	}
+	for {
+		msg, err := c.recv()
+		if err != nil {
+			log.Fatal(err)
+		} else if msg.Error != "" {
+			log.Fatal(msg.Error)
+		}
+		if msg.Action == ActionAttach && msg.contentNum() == proc.Num {
+			break
+		}
+	}
+
+	// The rest of the connection is the process's output
+	output := make(chan []byte)
+	go func() {
+		r := io.MultiReader(c.d.Buffered(), c.conn)
+		for {
+			buf := make([]byte, 32<<10)
+			n, err := r.Read(buf)
+			if n != 0 {
+				output <- buf[:n]
+			}
+			if err != nil {
+				close(output)
+				return
+			}
+		}
+	}()
+	input := make(chan []byte)
+	go func() {
+		for {
+			buf := make([]byte, 1024)
+			n, err := os.Stdin.Read(buf)
+			if err != nil {
+				close(input)
+				return
+			}
+			input <- buf[:n]
+		}
+	}()
+	oldState, err := term.MakeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		log.Fatal("error setting up terminal: ", err)
+	}
+	fmt.Fprintf(os.Stderr, "Attached to %s (Ctrl-] to detach)\r\n", proc.Name)
+	detached := runAttached(input, output, func(in AttachInput) error {
+		return sendMsg(c.conn, in)
+	})
+	term.Restore(int(os.Stdin.Fd()), oldState)
+	if detached {
+		fmt.Fprintln(os.Stderr, "\nDetached from", proc.Name)
+	} else {
+		fmt.Fprintln(os.Stderr, "\n"+proc.Name, "exited")
+	}
+}
+
+func ctlRuns(cmd *cobra.Command, args []string) {
+	c := dialCtl(cmd)
+	procs, err := c.resolve(args)
+	if err != nil {
+		log.Fatal(err)
+	}
+	num := procs[0].Num
+	_, msgs, err := c.sync(Message{Action: ActionRuns, Content: num})
+	if err != nil {
+		log.Fatal(err)
+	}
+	// A run finishing may be sent along with the response, so the response is
+	// the longest history received
+	var runs []JobRun
+	for _, msg := range msgs {
+		if msg.Action != ActionRuns {
+			continue
+		}
+		var content RunsContent
+		if err := json.Unmarshal(msg.Content, &content); err != nil {
+			log.Fatal("error parsing runs: ", err)
+		}
+		if content.Num == num && len(content.Runs) >= len(runs) {
+			runs = content.Runs
+		}
+	}
+	if asJSON, _ := cmd.Flags().GetBool("json"); asJSON {
+		e := json.NewEncoder(os.Stdout)
+		e.SetIndent("", "  ")
+		e.Encode(runs)
+		return
+	}
+	for _, run := range runs {
+		fmt.Println(run)
+	}
+}
+
+func ctlHistory(cmd *cobra.Command, args []string) {
+	limit, _ := cmd.Flags().GetInt("limit")
+	req := HistoryRequest{Limit: limit}
+	c := dialCtl(cmd)
+	if len(args) != 0 {
+		procs, err := c.resolve(args)
+		if err != nil {
+			// The process may have been removed
+			req.Proc = args[0]
+		} else {
+			req.Proc = procs[0].Name
+		}
+	}
+	_, msgs, err := c.sync(Message{Action: ActionHistory, Content: req})
+	if err != nil {
+		log.Fatal(err)
+	}
+	var events []Event
+	for _, msg := range msgs {
+		if msg.Action != ActionHistory {
+			continue
+		}
+		if err := json.Unmarshal(msg.Content, &events); err != nil {
+			log.Fatal("error parsing history: ", err)
+		}
+	}
+	if asJSON, _ := cmd.Flags().GetBool("json"); asJSON {
+		e := json.NewEncoder(os.Stdout)
+		e.SetIndent("", "  ")
+		e.Encode(events)
+		return
+	}
+	for _, event := range events {
+		fmt.Println(event)
+	}
+}
@@ -0,0 +1,159 @@
+package cli
+
+// The control socket protocol
+//
+// The control socket is a Unix domain socket over which the same messages
+// used by the web UI (see the Action constants in web.go) are exchanged as
+// newline-delimited JSON objects. Once connected, the server sends an
+// ActionConnected message, after which the client may send any of the
+// client actions. Like websocket connections, control socket connections
+// receive notifications (e.g., ActionStart and ActionFinished) for all
+// processes, not just responses to their own messages. Messages are handled
+// in the order they are received, so a client can tell that all its
+// previous messages have been handled once it receives the response to an
+// ActionRefresh message with no content (which has a content of [-1]).
+//
+// Example (using socat):
+//   $ echo '{"action":"refresh"}' | socat - UNIX-CONNECT:/tmp/minimeyer-1000.sock
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+)
+
+// Hidden flag passed to the daemon process started by --daemon
+const daemonChildFlag = "daemon-child"
+
+var (
+	ctlLn      net.Listener
+	ctlPath    string
+	ctlRunning atomic.Bool
+	// Used to generate the keys for control socket connections in conns
+	ctlConnNum atomic.Uint64
+
+	errCtlRunning = fmt.Errorf("Control socket running already")
+)
+
+// Returns the default path of the control socket. It's in $XDG_RUNTIME_DIR,
+// if set, or the temp directory otherwise.
+func DefaultSocketPath() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "minimeyer.sock")
+	}
+	return filepath.Join(
+		os.TempDir(), fmt.Sprintf("minimeyer-%d.sock", os.Getuid()),
+	)
+}
+
+// Starts listening for control connections on the Unix socket at path
+func RunCtl(path string) error {
+	if ctlRunning.Swap(true) {
+		return errCtlRunning
+	}
+	if _, err := os.Stat(path); err == nil {
+		// Make sure the socket isn't being used before removing it
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			ctlRunning.Store(false)
+			return fmt.Errorf("control socket %s in use", path)
+		}
+		os.Remove(path)
+	}
+	ln, err := listenCtl(path)
+	if err != nil {
+		ctlRunning.Store(false)
+		return err
+	}
+	ctlLn, ctlPath = ln, path
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				break
+			}
+			go ctlHandler(conn)
+		}
+		ctlRunning.Store(false)
+	}()
+	return nil
+}
+
+// Listens on a socket only the user can connect to. The socket is created
+// with the umask's permissions, so it's created in a private directory and
+// moved to path once its permissions are set.
+func listenCtl(path string) (*net.UnixListener, error) {
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".minimeyer-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	tmpPath := filepath.Join(dir, "ctl.sock")
+	ln, err := net.ListenUnix("unix", &net.UnixAddr{Name: tmpPath, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	// Removed by CloseCtl from its new path instead
+	ln.SetUnlinkOnClose(false)
+	if err := os.Chmod(tmpPath, 0600); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// Stops listening on the control socket, removing the socket file
+func CloseCtl() error {
+	if !ctlRunning.Load() {
+		return nil
+	}
+	err := ctlLn.Close()
+	os.Remove(ctlPath)
+	return err
+}
+
+func ctlHandler(conn net.Conn) {
+	defer conn.Close()
+	sendMsg(conn, Message{
+		Action:  ActionConnected,
+		Content: srvrName,
+	})
+	key := fmt.Sprintf("unix:%d", ctlConnNum.Add(1))
+	ctlConns.Add(1)
+	defer ctlConns.Add(-1)
+	handleMsgs(conn, key, &ctlRunning)
+}
+
+// Starts the daemon process (this program with the same arguments) in its
+// own session with its output going to logPath. Returns the pid of the
+// daemon.
+func daemonize(logPath string) (int, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return 0, err
+	}
+	logFile, err := os.OpenFile(
+		logPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666,
+	)
+	if err != nil {
+		return 0, err
+	}
+	defer logFile.Close()
+	cmd := exec.Command(exe, append(os.Args[1:], "--"+daemonChildFlag)...)
+	cmd.Stdout, cmd.Stderr = logFile, logFile
+	// Detach from the terminal
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		return 0, err
+	}
+	pid := cmd.Process.Pid
+	return pid, cmd.Process.Release()
+}
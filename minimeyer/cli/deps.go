@@ -0,0 +1,242 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Returns the processes sorted so that each process comes after its
+// dependencies. Returns an error if a dependency doesn't exist or if there is
+// a dependency cycle.
+func sortByDeps(procs []*Process) ([]*Process, error) {
+	byName := procsByName(procs)
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	states := make(map[*Process]int, len(procs))
+	sorted := make([]*Process, 0, len(procs))
+	var path []string
+	var visit func(proc *Process) error
+	visit = func(proc *Process) error {
+		switch states[proc] {
+		case visiting:
+			i := 0
+			for path[i] != proc.Name {
+				i++
+			}
+			return fmt.Errorf(
+				"dependency cycle: %s",
+				strings.Join(append(path[i:], proc.Name), " -> "),
+			)
+		case visited:
+			return nil
+		}
+		states[proc] = visiting
+		path = append(path, proc.Name)
+		for _, name := range proc.DependsOn {
+			dep := byName[name]
+			if dep == nil {
+				return fmt.Errorf("%s: unknown dependency: %s", proc.Name, name)
+			}
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		states[proc] = visited
+		sorted = append(sorted, proc)
+		return nil
+	}
+	for _, proc := range procs {
+		if err := visit(proc); err != nil {
+			return nil, err
+		}
+	}
+	return sorted, nil
+}
+
+// Maps the process names to the processes. If multiple processes have the
+// same name, the first one is used.
+func procsByName(procs []*Process) map[string]*Process {
+	byName := make(map[string]*Process, len(procs))
+	for _, proc := range procs {
+		if _, ok := byName[proc.Name]; !ok {
+			byName[proc.Name] = proc
+		}
+	}
+	return byName
+}
+
+// Returns an error if any of the dependencies of the process don't exist,
+// either as existing processes or in batch (the processes being added along
+// with it)
+func (a *App) checkDeps(p *Process, batch ...*Process) error {
+	byName := procsByName(batch)
+	for _, name := range p.DependsOn {
+		if name == p.Name {
+			return fmt.Errorf("%s: process can't depend on itself", p.Name)
+		} else if byName[name] == nil && a.GetProcByName(name) == nil {
+			return fmt.Errorf("%s: unknown dependency: %s", p.Name, name)
+		}
+	}
+	return nil
+}
+
+// Returns the processes being added sorted so that each process comes after
+// its dependencies. Returns an error if, together with the existing
+// processes, they have a dependency cycle.
+func (a *App) sortBatchByDeps(batch []*Process) ([]*Process, error) {
+	all, err := sortByDeps(append(a.procsSnapshot(), batch...))
+	if err != nil {
+		return nil, err
+	}
+	inBatch := make(map[*Process]bool, len(batch))
+	for _, proc := range batch {
+		inBatch[proc] = true
+	}
+	sorted := make([]*Process, 0, len(batch))
+	for _, proc := range all {
+		if inBatch[proc] {
+			sorted = append(sorted, proc)
+		}
+	}
+	return sorted, nil
+}
+
+// Starts all the processes, starting each process once its dependencies are
+// running (and ready, if they have readiness checks). Processes that don't
+// depend on each other are started in parallel. Scheduled processes aren't
+// started. Returns once all processes
+// have been started (or failed to start).
+func (a *App) StartProcs() {
+	a.startProcs(a.procsSnapshot())
+}
+
+// Starts the given processes like StartProcs. Dependencies that aren't in
+// procs aren't waited for.
+func (a *App) startProcs(procs []*Process) {
+	all := a.procsSnapshot()
+	if _, err := sortByDeps(all); err != nil {
+		Println("error starting processes:", err)
+		return
+	}
+	byName := procsByName(all)
+
+	type startState struct {
+		done chan struct{}
+		ok   bool
+	}
+	states := make(map[*Process]*startState, len(procs))
+	for _, proc := range procs {
+		states[proc] = &startState{done: make(chan struct{})}
+	}
+	var wg sync.WaitGroup
+	for _, proc := range procs {
+		wg.Add(1)
+		go func(proc *Process) {
+			defer wg.Done()
+			state := states[proc]
+			defer close(state.done)
+			for _, name := range proc.DependsOn {
+				dep, ok := states[byName[name]]
+				if !ok {
+					continue
+				}
+				<-dep.done
+				if !dep.ok {
+					Printf(
+						"Not starting process %d (%s): dependency %s failed to start\n",
+						proc.Num, proc.Name, name,
+					)
+					return
+				}
+			}
+			if proc.Schedule != "" {
+				// Started by its schedule
+				state.ok = true
+				return
+			}
+			if proc.Delay != 0 {
+				time.Sleep(time.Second * proc.Delay)
+			}
+			if err := proc.Start(); err != nil && err != errProcRunning {
+				Printf(
+					"error starting process %d (%s): %v\n", proc.Num, proc.Name, err,
+				)
+				return
+			}
+			if !proc.waitReady() {
+				Printf(
+					"Process %d (%s) didn't become ready\n",
+					proc.Num, proc.Name,
+				)
+				return
+			}
+			state.ok = true
+		}(proc)
+	}
+	wg.Wait()
+}
+
+// Stops all the processes using the given stop function, stopping each
+// process only once all the processes that depend on it have exited.
+// Returns once all processes have exited.
+func (a *App) StopProcs(stop func(*Process) error) {
+	a.stopProcs(a.procsSnapshot(), stop)
+}
+
+// Stops the given processes like StopProcs. Dependents that aren't in procs
+// aren't waited for.
+func (a *App) stopProcs(procs []*Process, stop func(*Process) error) {
+	byName := procsByName(procs)
+	dependents := make(map[*Process][]*Process, len(procs))
+	if _, err := sortByDeps(a.procsSnapshot()); err != nil {
+		// Can't order them, so stop them all at once
+		Println("error ordering processes:", err)
+	} else {
+		for _, proc := range procs {
+			for _, name := range proc.DependsOn {
+				if dep := byName[name]; dep != nil {
+					dependents[dep] = append(dependents[dep], proc)
+				}
+			}
+		}
+	}
+
+	exited := make(map[*Process]chan struct{}, len(procs))
+	for _, proc := range procs {
+		exited[proc] = make(chan struct{})
+	}
+	var wg sync.WaitGroup
+	for _, proc := range procs {
+		wg.Add(1)
+		go func(proc *Process) {
+			defer wg.Done()
+			defer close(exited[proc])
+			for _, dependent := range dependents[proc] {
+				<-exited[dependent]
+			}
+			if err := stop(proc); err != nil {
+				Printf(
+					"error stopping process %d (%s): %v\n", proc.Num, proc.Name, err,
+				)
+			}
+			proc.waitExit()
+		}(proc)
+	}
+	wg.Wait()
+}
+
+// Waits for the current run of the process to exit, if it is running
+func (p *Process) waitExit() {
+	p.procMtx.RLock()
+	exited := p.exited
+	p.procMtx.RUnlock()
+	if exited != nil {
+		<-exited
+	}
+}
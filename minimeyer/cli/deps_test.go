@@ -0,0 +1,88 @@
+package cli
+
+import (
+	"strings"
+	"testing"
+)
+
+func procNames(procs []*Process) string {
+	names := make([]string, len(procs))
+	for i, proc := range procs {
+		names[i] = proc.Name
+	}
+	return strings.Join(names, ",")
+}
+
+func TestSortByDeps(t *testing.T) {
+	newProcs := func() []*Process {
+		return []*Process{
+			{Name: "web", DependsOn: []string{"api", "cache"}},
+			{Name: "api", DependsOn: []string{"db"}},
+			{Name: "worker", DependsOn: []string{"db", "cache"}},
+			{Name: "db"},
+			{Name: "cache"},
+		}
+	}
+	sorted, err := sortByDeps(newProcs())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, want := procNames(sorted), "db,api,cache,web,worker"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+
+	procs := newProcs()
+	procs[3].DependsOn = []string{"web"}
+	_, err = sortByDeps(procs)
+	if err == nil || !strings.Contains(err.Error(), "web -> api -> db -> web") {
+		t.Errorf("expected a dependency cycle error, got %v", err)
+	}
+
+	procs = newProcs()
+	procs[4].DependsOn = []string{"redis"}
+	_, err = sortByDeps(procs)
+	if err == nil || err.Error() != "cache: unknown dependency: redis" {
+		t.Errorf("expected an unknown dependency error, got %v", err)
+	}
+}
+
+func TestSortBatchByDeps(t *testing.T) {
+	app := &App{procs: []*Process{
+		{Name: "db"},
+		{Name: "api", DependsOn: []string{"db"}},
+	}}
+	batch := []*Process{
+		{Name: "web", DependsOn: []string{"api", "cache"}},
+		{Name: "cache", DependsOn: []string{"db"}},
+	}
+	for _, proc := range batch {
+		if err := app.checkDeps(proc, batch...); err != nil {
+			t.Fatalf("unexpected error checking %s: %v", proc.Name, err)
+		}
+	}
+	sorted, err := app.sortBatchByDeps(batch)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, want := procNames(sorted), "cache,web"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+
+	if err := app.checkDeps(batch[0]); err == nil {
+		t.Errorf("expected an error for a dependency only in the batch")
+	}
+	self := &Process{Name: "self", DependsOn: []string{"self"}}
+	if err := app.checkDeps(self, self); err == nil {
+		t.Errorf("expected an error for a process depending on itself")
+	}
+
+	// Existing processes can't depend on new ones, so only new processes
+	// can form cycles
+	cycle := []*Process{
+		{Name: "a", DependsOn: []string{"b"}},
+		{Name: "b", DependsOn: []string{"api", "a"}},
+	}
+	if _, err := app.sortBatchByDeps(cycle); err == nil {
+		t.Errorf("expected a dependency cycle error")
+	}
+}
@@ -0,0 +1,321 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/spf13/cobra"
+)
+
+// Name of the hidden command that processes with a umask, resource limits,
+// or nice value are started as
+const childExecCmd = "child-exec"
+
+// Returns the hidden command which applies a process's umask, resource
+// limits, and nice value to itself and then replaces itself with the program
+// (keeping the same pid). None of them can be set for just a child process
+// before it starts: changing minimeyer's own umask would affect the files it
+// (and any processes started at the same time) creates, and setting limits
+// after starting the process would let it run without them for a moment.
+func NewChildExecCmd() *cobra.Command {
+	p := &Process{}
+	cmd := &cobra.Command{
+		Use:    childExecCmd + " [flags] -- PATH ARGV0 [ARGS...]",
+		Hidden: true,
+		Args:   cobra.MinimumNArgs(2),
+		Run: func(_ *cobra.Command, args []string) {
+			log.SetFlags(0)
+			if err := p.applyChildSettings(); err != nil {
+				log.Fatal(err)
+			}
+			err := syscall.Exec(args[0], args[1:], os.Environ())
+			log.Fatalf("error executing %s: %v", args[0], err)
+		},
+	}
+	flags := cmd.Flags()
+	flags.StringVar(&p.Umask, "umask", "", "Umask")
+	flags.Uint64Var(&p.LimitNofile, "limit-nofile", 0, "Open files limit")
+	flags.StringVar(&p.LimitAS, "limit-as", "", "Address space limit")
+	flags.Int64Var(
+		(*int64)(&p.LimitCPU), "limit-cpu", 0, "CPU time limit in seconds",
+	)
+	flags.IntVar(&p.Nice, "nice", 0, "Nice value")
+	return cmd
+}
+
+// Returns the flags of the child-exec command for the process's umask,
+// resource limits, and nice value. Returns nil if it has none, in which case
+// it's started directly.
+func (p *Process) childExecFlags() []string {
+	var flags []string
+	if p.Umask != "" {
+		flags = append(flags, "--umask="+p.Umask)
+	}
+	if p.LimitNofile != 0 {
+		flags = append(
+			flags, "--limit-nofile="+strconv.FormatUint(p.LimitNofile, 10),
+		)
+	}
+	if p.LimitAS != "" {
+		flags = append(flags, "--limit-as="+p.LimitAS)
+	}
+	if p.LimitCPU != 0 {
+		flags = append(
+			flags, "--limit-cpu="+strconv.FormatInt(int64(p.LimitCPU), 10),
+		)
+	}
+	if p.Nice != 0 {
+		flags = append(flags, "--nice="+strconv.Itoa(p.Nice))
+	}
+	return flags
+}
+
+// Applies the process's umask, resource limits, and nice value to the
+// current process (the child-exec command)
+func (p *Process) applyChildSettings() error {
+	if p.Umask != "" {
+		mask, err := parseUmask(p.Umask)
+		if err != nil {
+			return err
+		}
+		syscall.Umask(mask)
+	}
+	return p.applyLimits()
+}
+
+// Returns an error if any of the process's execution settings (dir, user,
+// group, umask, env file, stdin) are invalid
+func (p *Process) validateExec() error {
+	if p.Dir != "" {
+		info, err := os.Stat(p.Dir)
+		if err != nil {
+			return fmt.Errorf("%s: invalid dir: %v", p.Name, err)
+		} else if !info.IsDir() {
+			return fmt.Errorf("%s: invalid dir: %s is not a directory", p.Name, p.Dir)
+		}
+	}
+	if p.User != "" || p.Group != "" {
+		cred, err := p.credential()
+		if err != nil {
+			return fmt.Errorf("%s: %v", p.Name, err)
+		}
+		if os.Geteuid() != 0 &&
+			(int(cred.Uid) != os.Getuid() || int(cred.Gid) != os.Getgid()) {
+			return fmt.Errorf("%s: must run as root to set user or group", p.Name)
+		}
+	}
+	if p.Umask != "" {
+		if _, err := parseUmask(p.Umask); err != nil {
+			return fmt.Errorf("%s: %v", p.Name, err)
+		}
+	}
+	if p.EnvFile != "" {
+		if _, err := readEnvFile(p.EnvFile); err != nil {
+			return fmt.Errorf("%s: invalid env file: %v", p.Name, err)
+		}
+	}
+	if p.Stdin != "" {
+		f, err := os.Open(p.Stdin)
+		if err != nil {
+			return fmt.Errorf("%s: invalid stdin: %v", p.Name, err)
+		}
+		f.Close()
+	}
+	if p.Interactive {
+		if !ptySupported {
+			return fmt.Errorf("%s: interactive processes not supported on this OS", p.Name)
+		} else if p.Stdin != "" {
+			return fmt.Errorf("%s: interactive processes can't have a stdin file", p.Name)
+		}
+	}
+	return nil
+}
+
+// Looks up the user and group (names or IDs) to run the process as. If only
+// the user is set, the user's primary group is used. If only the group is
+// set, the current user is used.
+func (p *Process) credential() (*syscall.Credential, error) {
+	cred := &syscall.Credential{
+		Uid: uint32(os.Getuid()),
+		Gid: uint32(os.Getgid()),
+	}
+	if p.User != "" {
+		u, err := user.Lookup(p.User)
+		if err != nil {
+			if u, err = user.LookupId(p.User); err != nil {
+				return nil, fmt.Errorf("unknown user: %s", p.User)
+			}
+		}
+		uid, err := strconv.ParseUint(u.Uid, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid uid for %s: %s", p.User, u.Uid)
+		}
+		gid, err := strconv.ParseUint(u.Gid, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gid for %s: %s", p.User, u.Gid)
+		}
+		cred.Uid, cred.Gid = uint32(uid), uint32(gid)
+	}
+	if p.Group != "" {
+		g, err := user.LookupGroup(p.Group)
+		if err != nil {
+			if g, err = user.LookupGroupId(p.Group); err != nil {
+				return nil, fmt.Errorf("unknown group: %s", p.Group)
+			}
+		}
+		gid, err := strconv.ParseUint(g.Gid, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gid for %s: %s", p.Group, g.Gid)
+		}
+		cred.Gid = uint32(gid)
+	}
+	return cred, nil
+}
+
+// Parses an octal umask (e.g., "022" or "0077")
+func parseUmask(s string) (int, error) {
+	mask, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || mask > 0777 {
+		return 0, fmt.Errorf("invalid umask: %s", s)
+	}
+	return int(mask), nil
+}
+
+// Reads the environment variables from a dotenv file: KEY=VALUE lines, with
+// optional "export " prefixes and quoted values. Blank lines and lines
+// starting with # are ignored.
+func readEnvFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var env []string
+	scanner := bufio.NewScanner(f)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" || strings.ContainsAny(key, " \t") {
+			return nil, fmt.Errorf("line %d: expected KEY=VALUE", lineNum)
+		}
+		value, err := parseEnvValue(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNum, err)
+		}
+		env = append(env, key+"="+value)
+	}
+	return env, scanner.Err()
+}
+
+// Parses a dotenv value. Single-quoted values are taken literally,
+// double-quoted values may contain escapes (e.g., \n), and unquoted values
+// end at a " #" comment.
+func parseEnvValue(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	switch quote := value[0]; quote {
+	case '\'', '"':
+		end := strings.LastIndexByte(value, quote)
+		if end == 0 {
+			return "", fmt.Errorf("unterminated quote")
+		}
+		value = value[1:end]
+		if quote == '"' {
+			value = strings.NewReplacer(
+				`\n`, "\n", `\t`, "\t", `\"`, `"`, `\\`, `\`,
+			).Replace(value)
+		}
+		return value, nil
+	}
+	if i := strings.Index(value, " #"); i != -1 {
+		value = strings.TrimSpace(value[:i])
+	}
+	return value, nil
+}
+
+// Returns the environment for the process: the global environment followed
+// by the variables from the process's env file and then the process's own
+// variables (later variables take precedence)
+func processEnv(global []string, p *Process) []string {
+	var fileEnv []string
+	if p.EnvFile != "" {
+		var err error
+		if fileEnv, err = readEnvFile(p.EnvFile); err != nil {
+			Printf("Error reading env file for %s: %v\n", p.Name, err)
+		}
+	}
+	env := make([]string, 0, len(global)+len(fileEnv)+len(p.Env))
+	env = append(env, global...)
+	env = append(env, fileEnv...)
+	return append(env, p.Env...)
+}
+
+// Sets the process's dir, credentials, and stdin (or pseudo-terminal) on its
+// cmd. Returns the opened stdin file or terminal (if any), which should be
+// closed once the process is started. Must be called with the proc mutex
+// held.
+func (p *Process) setupCmd() (*os.File, error) {
+	p.cmd.Dir = p.Dir
+	if p.User != "" || p.Group != "" {
+		cred, err := p.credential()
+		if err != nil {
+			return nil, err
+		}
+		if int(cred.Uid) != os.Getuid() || int(cred.Gid) != os.Getgid() {
+			p.cmd.SysProcAttr.Credential = cred
+		}
+	}
+	if p.Interactive {
+		pty, err := newProcessPTY()
+		if err != nil {
+			return nil, fmt.Errorf("error opening pseudo-terminal: %v", err)
+		}
+		p.pty = pty
+		// The terminal is the process's controlling terminal, which requires
+		// it to be in its own session (and so its own process group)
+		p.cmd.Stdin = pty.tty
+		p.cmd.SysProcAttr.Setpgid = false
+		p.cmd.SysProcAttr.Setsid, p.cmd.SysProcAttr.Setctty = true, true
+		return pty.tty, nil
+	}
+	if p.Stdin == "" {
+		return nil, nil
+	}
+	f, err := os.Open(p.Stdin)
+	if err != nil {
+		return nil, fmt.Errorf("error opening stdin: %v", err)
+	}
+	p.cmd.Stdin = f
+	return f, nil
+}
+
+// Starts the process's cmd with its umask, resource limits, and nice value,
+// if set. Must be called with the proc mutex held.
+func (p *Process) startCmd() error {
+	flags := p.childExecFlags()
+	if len(flags) == 0 || p.cmd.Err != nil {
+		return p.cmd.Start()
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("error finding %s command: %v", childExecCmd, err)
+	}
+	// Started as the child-exec command, which execs the program once the
+	// settings are applied
+	args := append([]string{exe, childExecCmd}, flags...)
+	args = append(args, "--", p.cmd.Path)
+	p.cmd.Path, p.cmd.Args = exe, append(args, p.cmd.Args...)
+	return p.cmd.Start()
+}
@@ -0,0 +1,85 @@
+package cli
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReadEnvFile(t *testing.T) {
+	path := writeTempFile(t, ".env", `
+# comment
+PLAIN=value
+export EXPORTED=1
+  SPACED = spaced value
+EMPTY=
+COMMENTED=value # comment
+HASH=a#b
+SINGLE='literal \n # not a comment'
+DOUBLE="line 1\nline 2\t\"quoted\" \\n"
+EQUALS=a=b=c
+QUOTED_COMMENT="x" # comment
+`)
+	env, err := readEnvFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{
+		"PLAIN=value",
+		"EXPORTED=1",
+		"SPACED=spaced value",
+		"EMPTY=",
+		"COMMENTED=value",
+		"HASH=a#b",
+		`SINGLE=literal \n # not a comment`,
+		"DOUBLE=line 1\nline 2\t\"quoted\" \\n",
+		"EQUALS=a=b=c",
+		"QUOTED_COMMENT=x",
+	}
+	if !reflect.DeepEqual(env, want) {
+		t.Errorf("got %q, want %q", env, want)
+	}
+}
+
+func TestReadEnvFileErrors(t *testing.T) {
+	tests := map[string]string{
+		"no equals":         "A=1\nNOVALUE\n",
+		"no key":            "=1\n",
+		"space in key":      "A B=1\n",
+		"unterminated":      "A=\"value\n",
+		"unterminated ('')": "A='value\n",
+	}
+	for name, contents := range tests {
+		path := writeTempFile(t, ".env", contents)
+		if _, err := readEnvFile(path); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	if _, err := readEnvFile(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Errorf("expected an error for a missing file")
+	}
+}
+
+func TestProcessEnv(t *testing.T) {
+	path := writeTempFile(t, ".env", "A=file\nB=file\n")
+	p := &Process{EnvFile: path, Env: []string{"B=proc", "C=proc"}}
+	env := processEnv([]string{"A=global", "D=global"}, p)
+	// Later variables take precedence when the process is run
+	want := []string{"A=global", "D=global", "A=file", "B=file", "B=proc", "C=proc"}
+	if !reflect.DeepEqual(env, want) {
+		t.Errorf("got %q, want %q", env, want)
+	}
+}
+
+func TestParseUmask(t *testing.T) {
+	for s, want := range map[string]int{"022": 0o22, "0077": 0o77, "0": 0, "777": 0o777} {
+		if got, err := parseUmask(s); err != nil || got != want {
+			t.Errorf("%s: got %o (error: %v), want %o", s, got, err, want)
+		}
+	}
+	for _, s := range []string{"", "8", "1000", "abc", "-1"} {
+		if _, err := parseUmask(s); err == nil {
+			t.Errorf("%q: expected an error", s)
+		}
+	}
+}
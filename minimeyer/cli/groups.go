@@ -0,0 +1,127 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Action that restarts processes by gracefully stopping them (with their
+// stop signal) and starting them again. Only used for bulk actions.
+const bulkRestart = "restart"
+
+// Selects the processes in a group or with a tag
+type ProcSelector struct {
+	Group string `json:"group,omitempty"`
+	Tag   string `json:"tag,omitempty"`
+}
+
+// Parses a selector of the form "group:NAME" or "tag:NAME"
+func parseSelector(s string) (ProcSelector, error) {
+	kind, name, _ := strings.Cut(strings.TrimSpace(s), ":")
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return ProcSelector{}, fmt.Errorf("invalid selector: %s", s)
+	}
+	switch kind {
+	case "group":
+		return ProcSelector{Group: name}, nil
+	case "tag":
+		return ProcSelector{Tag: name}, nil
+	}
+	return ProcSelector{}, fmt.Errorf(
+		"invalid selector, expected group:NAME or tag:NAME: %s", s,
+	)
+}
+
+func (s ProcSelector) String() string {
+	if s.Group != "" {
+		return "group:" + s.Group
+	}
+	return "tag:" + s.Tag
+}
+
+// Reports whether the process is in the selected group and has the selected
+// tag (the ones that are set)
+func (s ProcSelector) matches(p *Process) bool {
+	if s.Group != "" && p.ProcGroup != s.Group {
+		return false
+	}
+	return s.Tag == "" || containsString(p.Tags, s.Tag)
+}
+
+// Like matches but for the processes received by the ctl client
+func (s ProcSelector) matchesCtl(p ctlProcess) bool {
+	if s.Group != "" && p.ProcGroup != s.Group {
+		return false
+	}
+	return s.Tag == "" || containsString(p.Tags, s.Tag)
+}
+
+func containsString(strs []string, s string) bool {
+	for _, str := range strs {
+		if str == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the processes matched by the selector
+func (a *App) SelectProcs(sel ProcSelector) []*Process {
+	var procs []*Process
+	for _, proc := range a.procsSnapshot() {
+		if sel.matches(proc) {
+			procs = append(procs, proc)
+		}
+	}
+	return procs
+}
+
+// Returns true if the action can be used as a bulk action
+func validBulkAction(action string) bool {
+	switch action {
+	case ActionStart, ActionStop, ActionKill, ActionInterrupt, bulkRestart,
+		ActionKillRestart, ActionInterruptRestart, ActionDel:
+		return true
+	}
+	return false
+}
+
+// Performs the action (e.g., ActionStop or ActionDel) on the processes,
+// respecting their dependencies. Returns once the action is done (e.g., the
+// processes have exited).
+func (a *App) BulkAction(action string, procs []*Process) error {
+	switch action {
+	case ActionStart:
+		a.startProcs(procs)
+	case ActionStop:
+		a.stopProcs(procs, (*Process).stop)
+	case ActionKill:
+		a.stopProcs(procs, (*Process).kill)
+	case ActionInterrupt:
+		a.stopProcs(procs, (*Process).interrupt)
+	case bulkRestart:
+		a.stopProcs(procs, (*Process).stop)
+		a.startProcs(procs)
+	case ActionKillRestart:
+		a.stopProcs(procs, (*Process).kill)
+		a.startProcs(procs)
+	case ActionInterruptRestart:
+		a.stopProcs(procs, (*Process).interrupt)
+		a.startProcs(procs)
+	case ActionDel:
+		a.stopProcs(procs, (*Process).kill)
+		for _, proc := range procs {
+			a.RemoveProcByNum(proc.Num)
+		}
+	default:
+		return fmt.Errorf("invalid bulk action: %s", action)
+	}
+	return nil
+}
+
+// Content of ActionBulk messages
+type BulkContent struct {
+	ProcSelector
+	Action string `json:"action"`
+}
@@ -0,0 +1,291 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os/exec"
+	"time"
+)
+
+// Health check types
+const (
+	checkTCP  = "tcp"
+	checkHTTP = "http"
+	checkExec = "exec"
+)
+
+type HealthCheck struct {
+	// The type of check: "tcp", "http", or "exec"
+	Type string `json:"type" toml:"type"`
+	// The address to connect to for tcp checks (e.g., "127.0.0.1:8000")
+	Addr string `json:"addr,omitempty" toml:"addr"`
+	// The URL to GET for http checks
+	URL string `json:"url,omitempty" toml:"url"`
+	// The expected status code for http checks (any 2xx if not set)
+	Status int `json:"status,omitempty" toml:"status"`
+	// The program and args to run for exec checks (exit code 0 is healthy)
+	Command []string `json:"command,omitempty" toml:"command"`
+	// Time in seconds to wait after the process starts before checking
+	InitialDelay time.Duration `json:"initialDelay,omitempty" toml:"initial-delay"`
+	// Time in seconds between checks (default is 10)
+	Interval time.Duration `json:"interval,omitempty" toml:"interval"`
+	// Time in seconds before a check fails (default is 5)
+	Timeout time.Duration `json:"timeout,omitempty" toml:"timeout"`
+	// Number of consecutive failed checks before the process is unhealthy
+	// (default is 3). For readiness checks, the process's dependents are then
+	// no longer waited for.
+	FailureThreshold int `json:"failureThreshold,omitempty" toml:"failure-threshold"`
+	// Restart the process when it becomes unhealthy
+	Restart bool `json:"restart,omitempty" toml:"restart"`
+}
+
+func (hc *HealthCheck) validate() error {
+	switch hc.Type {
+	case checkTCP:
+		if hc.Addr == "" {
+			return fmt.Errorf("missing addr for tcp check")
+		}
+	case checkHTTP:
+		if hc.URL == "" {
+			return fmt.Errorf("missing url for http check")
+		}
+	case checkExec:
+		if len(hc.Command) == 0 {
+			return fmt.Errorf("missing command for exec check")
+		}
+	default:
+		return fmt.Errorf("invalid check type: %q", hc.Type)
+	}
+	if hc.FailureThreshold < 0 {
+		return fmt.Errorf("failure threshold must be non-negative")
+	}
+	return nil
+}
+
+func (hc *HealthCheck) interval() time.Duration {
+	if hc.Interval <= 0 {
+		return 10 * time.Second
+	}
+	return time.Second * hc.Interval
+}
+
+func (hc *HealthCheck) timeout() time.Duration {
+	if hc.Timeout <= 0 {
+		return 5 * time.Second
+	}
+	return time.Second * hc.Timeout
+}
+
+func (hc *HealthCheck) failureThreshold() int {
+	if hc.FailureThreshold <= 0 {
+		return 3
+	}
+	return hc.FailureThreshold
+}
+
+// Runs the check once, returning nil if it passed
+func (hc *HealthCheck) check(p *Process) error {
+	ctx, cancel := context.WithTimeout(context.Background(), hc.timeout())
+	defer cancel()
+	switch hc.Type {
+	case checkTCP:
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", hc.Addr)
+		if err != nil {
+			return err
+		}
+		conn.Close()
+	case checkHTTP:
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, hc.URL, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if hc.Status != 0 {
+			if resp.StatusCode != hc.Status {
+				return fmt.Errorf("unexpected status: %s", resp.Status)
+			}
+		} else if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return fmt.Errorf("unexpected status: %s", resp.Status)
+		}
+	case checkExec:
+		cmd := exec.CommandContext(ctx, hc.Command[0], hc.Command[1:]...)
+		cmd.Env, cmd.Dir = p.Env, p.Dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			if len(out) != 0 {
+				return fmt.Errorf("%v: %s", err, out)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// Runs the health checks for the current run of the process until it exits.
+// Called once the process has been started.
+func (p *Process) runHealthChecks(exited, ready, unready chan struct{}) {
+	sleep := func(d time.Duration) bool {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		select {
+		case <-exited:
+			return false
+		case <-timer.C:
+			return true
+		}
+	}
+
+	// The checks may be changed when the config is reloaded
+	p.procMtx.RLock()
+	readiness, liveness := p.Readiness, p.Liveness
+	p.procMtx.RUnlock()
+
+	if hc := readiness; hc != nil {
+		if !sleep(time.Second * hc.InitialDelay) {
+			return
+		}
+		for failures := 0; ; {
+			err := hc.check(p)
+			p.setHealthErr(err)
+			if err == nil {
+				break
+			} else if failures++; failures == hc.failureThreshold() {
+				// Keeps checking in case it becomes ready later, but its
+				// dependents aren't started
+				Printf("%s failed to become ready: %v\n", p.Name, err)
+				close(unready)
+				if p.setHealthy(false) && hc.Restart {
+					go p.restartUnhealthy()
+					return
+				}
+			}
+			if !sleep(hc.interval()) {
+				return
+			}
+		}
+		p.markReady(ready)
+	}
+
+	hc := liveness
+	if hc == nil {
+		return
+	}
+	if !sleep(time.Second * hc.InitialDelay) {
+		return
+	}
+	for failures := 0; ; {
+		err := hc.check(p)
+		p.setHealthErr(err)
+		if err == nil {
+			failures = 0
+			p.setHealthy(true)
+		} else if failures++; failures == hc.failureThreshold() {
+			Printf("%s is unhealthy: %v\n", p.Name, err)
+			if p.setHealthy(false) && hc.Restart {
+				go p.restartUnhealthy()
+				return
+			}
+		}
+		if !sleep(hc.interval()) {
+			return
+		}
+	}
+}
+
+// Sets the status of the process to healthy or unhealthy, if it's still
+// running. Returns true if the status was changed.
+func (p *Process) setHealthy(healthy bool) bool {
+	status := statusHealthy
+	if !healthy {
+		status = statusUnhealthy
+	}
+	for {
+		old := p.status.Load()
+		if !isRunningStatus(old) {
+			return false
+		} else if old == status {
+			return false
+		}
+		if p.status.CompareAndSwap(old, status) {
+			break
+		}
+	}
+	p.procMtx.RLock()
+	msg := p.healthErr
+	p.procMtx.RUnlock()
+	if msg != "" {
+		notify(Message{Action: ActionHealth, Processes: []*Process{p}, Content: msg})
+	} else {
+		notify(NewMessageProc(ActionHealth, p))
+	}
+	return true
+}
+
+func (p *Process) setHealthErr(err error) {
+	p.procMtx.Lock()
+	p.lastHealthCheck = time.Now()
+	if err != nil {
+		p.healthErr = err.Error()
+		p.healthFailures++
+	} else {
+		p.healthErr = ""
+	}
+	p.procMtx.Unlock()
+}
+
+// Restarts a process that failed its readiness or liveness check
+func (p *Process) restartUnhealthy() {
+	Printf("Restarting %s since it's unhealthy\n", p.Name)
+	p.procMtx.Lock()
+	p.restarts++
+	p.procMtx.Unlock()
+	if err := p.restart((*Process).stop); err != nil {
+		Printf("Error restarting %s: %v\n", p.Name, err)
+	}
+}
+
+// Marks the run with the given ready channel as ready (and healthy), if it
+// isn't already
+func (p *Process) markReady(ready chan struct{}) {
+	p.procMtx.Lock()
+	select {
+	case <-ready:
+		p.procMtx.Unlock()
+		return
+	default:
+		close(ready)
+	}
+	p.procMtx.Unlock()
+	p.setHealthy(true)
+}
+
+// Waits for the current run of the process to become ready (pass its
+// readiness check). Returns false if the process exited or failed its
+// readiness check before becoming ready.
+func (p *Process) waitReady() bool {
+	p.procMtx.RLock()
+	ready, unready, exited := p.ready, p.unready, p.exited
+	p.procMtx.RUnlock()
+	if ready == nil {
+		return exited != nil
+	}
+	select {
+	case <-ready:
+		return true
+	case <-unready:
+	case <-exited:
+	}
+	// It may have become ready since
+	select {
+	case <-ready:
+		return true
+	default:
+		return false
+	}
+}
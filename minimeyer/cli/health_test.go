@@ -0,0 +1,200 @@
+package cli
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// Returns the address of a port nothing is listening on
+func closedAddr(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	return addr
+}
+
+func TestHealthCheck(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/created" {
+			w.WriteHeader(http.StatusCreated)
+		} else if r.URL.Path != "/ok" {
+			http.NotFound(w, r)
+		}
+	}
+	srv := httptest.NewServer(http.HandlerFunc(handler))
+	defer srv.Close()
+
+	tests := []struct {
+		hc   HealthCheck
+		pass bool
+	}{
+		{HealthCheck{Type: checkTCP, Addr: ln.Addr().String()}, true},
+		{HealthCheck{Type: checkTCP, Addr: closedAddr(t)}, false},
+		{HealthCheck{Type: checkHTTP, URL: srv.URL + "/ok"}, true},
+		{HealthCheck{Type: checkHTTP, URL: srv.URL + "/created"}, true},
+		{HealthCheck{Type: checkHTTP, URL: srv.URL + "/other"}, false},
+		{HealthCheck{Type: checkHTTP, URL: srv.URL + "/ok", Status: 201}, false},
+		{HealthCheck{Type: checkHTTP, URL: srv.URL + "/created", Status: 201}, true},
+		{HealthCheck{Type: checkExec, Command: []string{"true"}}, true},
+		{HealthCheck{Type: checkExec, Command: []string{"false"}}, false},
+		// Timed out
+		{HealthCheck{
+			Type: checkExec, Command: []string{"sleep", "5"}, Timeout: 1,
+		}, false},
+	}
+	for _, test := range tests {
+		if err := test.hc.validate(); err != nil {
+			t.Errorf("%+v: unexpected validation error: %v", test.hc, err)
+			continue
+		}
+		err := test.hc.check(&Process{})
+		if test.pass && err != nil {
+			t.Errorf("%+v: unexpected error: %v", test.hc, err)
+		} else if !test.pass && err == nil {
+			t.Errorf("%+v: expected the check to fail", test.hc)
+		}
+	}
+
+	for _, hc := range []HealthCheck{
+		{},
+		{Type: "udp", Addr: "x"},
+		{Type: checkTCP},
+		{Type: checkHTTP},
+		{Type: checkExec},
+		{Type: checkTCP, Addr: "x", FailureThreshold: -1},
+	} {
+		if err := hc.validate(); err == nil {
+			t.Errorf("%+v: expected an error", hc)
+		}
+	}
+}
+
+// Starts a long-running process with the checks
+func startCheckedProc(t *testing.T, readiness, liveness *HealthCheck) *Process {
+	t.Helper()
+	p := &Process{
+		Name:      "checked",
+		Program:   "sleep",
+		Args:      []string{"30"},
+		Readiness: readiness,
+		Liveness:  liveness,
+	}
+	a := NewApp()
+	a.AddProc(p)
+	if err := p.Start(); err != nil {
+		t.Fatalf("error starting process: %v", err)
+	}
+	t.Cleanup(func() {
+		// Stops restarts by the checks, letting any in progress finish
+		p.procMtx.Lock()
+		p.Readiness, p.Liveness = nil, nil
+		p.procMtx.Unlock()
+		time.Sleep(100 * time.Millisecond)
+		p.kill()
+		p.waitExit()
+	})
+	return p
+}
+
+// Waits for the process to have been restarted by its health checks
+func waitRestarts(t *testing.T, p *Process, want int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		p.procMtx.RLock()
+		restarts := p.restarts
+		p.procMtx.RUnlock()
+		if restarts >= want && isRunningStatus(p.status.Load()) {
+			return
+		} else if time.Now().After(deadline) {
+			t.Fatalf("expected %d restarts, got %d", want, restarts)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestReadinessCheck(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	p := startCheckedProc(t, &HealthCheck{
+		Type: checkTCP, Addr: ln.Addr().String(),
+	}, nil)
+	if !p.waitReady() {
+		t.Errorf("expected the process to become ready")
+	} else if status := p.status.Load(); status != statusHealthy {
+		t.Errorf("expected the process to be healthy, got %s",
+			statusString(status))
+	}
+
+	// Its dependents aren't waited for once it fails its check
+	// failure-threshold times
+	hc := &HealthCheck{Type: checkTCP, Addr: closedAddr(t), FailureThreshold: 1}
+	p = startCheckedProc(t, hc, nil)
+	done := make(chan bool, 1)
+	go func() { done <- p.waitReady() }()
+	select {
+	case ready := <-done:
+		if ready {
+			t.Errorf("expected the process not to become ready")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for the readiness check to fail")
+	}
+	if status := p.status.Load(); status != statusUnhealthy {
+		t.Errorf("expected the process to be unhealthy, got %s",
+			statusString(status))
+	}
+
+	hc = &HealthCheck{
+		Type: checkTCP, Addr: closedAddr(t), FailureThreshold: 1, Restart: true,
+	}
+	p = startCheckedProc(t, hc, nil)
+	waitRestarts(t, p, 1)
+}
+
+func TestLivenessCheckRestart(t *testing.T) {
+	hc := &HealthCheck{
+		Type: checkTCP, Addr: closedAddr(t), Interval: 1, FailureThreshold: 2,
+		Restart: true,
+	}
+	p := startCheckedProc(t, nil, hc)
+	start := time.Now()
+	// Restarted after the second failed check, an interval after the first
+	waitRestarts(t, p, 1)
+	if d := time.Since(start); d < time.Second {
+		t.Errorf("expected the process to restart after 1s, took %s", d)
+	}
+
+	// Not restarted without restart, just marked unhealthy
+	hc = &HealthCheck{Type: checkTCP, Addr: closedAddr(t), FailureThreshold: 1}
+	p = startCheckedProc(t, nil, hc)
+	deadline := time.Now().Add(5 * time.Second)
+	for p.status.Load() != statusUnhealthy {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the process to become unhealthy")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(100 * time.Millisecond)
+	p.procMtx.RLock()
+	restarts := p.restarts
+	p.procMtx.RUnlock()
+	if restarts != 0 {
+		t.Errorf("expected the process not to be restarted")
+	}
+}
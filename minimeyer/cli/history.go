@@ -0,0 +1,59 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+func NewHistoryCmd() *cobra.Command {
+	historyCmd := &cobra.Command{
+		Use:   "history STATE_FILE",
+		Short: "Print the history from a state file",
+		Long: `Print the process lifecycle events (e.g., starts and exits) recorded in a
+state file (see "cli --state"), oldest first. The state file can be read
+while minimeyer is running.`,
+		Args: cobra.ExactArgs(1),
+		Run:  runHistory,
+	}
+	flags := historyCmd.Flags()
+	flags.StringP("proc", "p", "", "Name of the process to print the history of")
+	flags.IntP(
+		"limit", "n", defaultHistoryLimit, "Max number of events (0 = all)",
+	)
+	flags.Bool("json", false, "Print the events as JSON")
+	return historyCmd
+}
+
+func runHistory(cmd *cobra.Command, args []string) {
+	flags := cmd.Flags()
+	proc, _ := flags.GetString("proc")
+	limit, _ := flags.GetInt("limit")
+	asJSON, _ := flags.GetBool("json")
+
+	// Don't create a new state file
+	if _, err := os.Stat(args[0]); err != nil {
+		log.Fatal("error opening state file: ", err)
+	}
+	state, err := openState(args[0])
+	if err != nil {
+		log.Fatal("error opening state file: ", err)
+	}
+	defer state.close()
+	events, err := state.history(proc, limit)
+	if err != nil {
+		log.Fatal("error reading history: ", err)
+	}
+	if asJSON {
+		e := json.NewEncoder(os.Stdout)
+		e.SetIndent("", "  ")
+		e.Encode(events)
+		return
+	}
+	for _, event := range events {
+		fmt.Println(event)
+	}
+}
@@ -0,0 +1,604 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Importing processes from Procfiles and docker-compose files
+//
+// Procfile processes are run with "sh -c" in the Procfile's directory, like
+// foreman does. Processes whose commands use $PORT are given a PORT (5000 for
+// the first process, 5100 for the second, and so on).
+//
+// Compose services are run directly (not in containers), mapping their
+// command, entrypoint, environment, env_file, working_dir, depends_on,
+// restart, stop_signal, stop_grace_period, user, and tty. Fields that can't
+// be mapped (e.g., image, ports, and volumes) are ignored with a warning, as
+// are services without a command.
+
+// Imports the processes from a Procfile or a docker-compose file (.yml or
+// .yaml), returning the config and warnings about anything that couldn't be
+// mapped. The processes aren't validated.
+func importConfig(path string) (*Config, []string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading import file: %v", err)
+	}
+	dir := filepath.Dir(path)
+	var config *Config
+	var warnings []string
+	switch filepath.Ext(path) {
+	case ".yml", ".yaml":
+		config, warnings, err = importCompose(data, dir)
+	default:
+		config, warnings, err = importProcfile(data, dir)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("error importing %s: %v", path, err)
+	} else if len(config.Procs) == 0 {
+		return nil, nil, fmt.Errorf("error importing %s: no processes found", path)
+	}
+	return config, warnings, nil
+}
+
+// Matches Procfile lines (name: command)
+var procfileLineRegex = regexp.MustCompile(`^([A-Za-z0-9_-]+):\s*(.+)$`)
+
+// Matches references to $PORT in commands
+var portVarRegex = regexp.MustCompile(`\$(PORT\b|\{PORT[}:])`)
+
+func importProcfile(data []byte, dir string) (*Config, []string, error) {
+	config, warnings := &Config{}, []string(nil)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		match := procfileLineRegex.FindStringSubmatch(line)
+		if match == nil {
+			warnings = append(
+				warnings, fmt.Sprintf("line %d: expected name: command, skipped", lineNum),
+			)
+			continue
+		}
+		proc := &Process{
+			Name:    match[1],
+			Program: "sh",
+			Args:    []string{"-c", match[2]},
+			Dir:     importDir(dir, ""),
+		}
+		if portVarRegex.MatchString(match[2]) {
+			port := 5000 + 100*len(config.Procs)
+			proc.Env = []string{"PORT=" + strconv.Itoa(port)}
+		}
+		config.Procs = append(config.Procs, proc)
+	}
+	return config, warnings, scanner.Err()
+}
+
+// Matches variable references in compose files
+var composeVarRegex = regexp.MustCompile(`\$(\{|[A-Za-z_])`)
+
+// Compose top-level keys that are ignored without a warning
+var composeIgnoredKeys = map[string]bool{"version": true, "name": true}
+
+func importCompose(data []byte, dir string) (*Config, []string, error) {
+	doc, err := parseYAML(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	top, ok := doc.(*yamlMap)
+	if !ok {
+		return nil, nil, fmt.Errorf("expected a mapping")
+	}
+	var warnings []string
+	for _, key := range top.keys {
+		if key != "services" && !composeIgnoredKeys[key] && !strings.HasPrefix(key, "x-") {
+			warnings = append(warnings, "ignoring top-level key: "+key)
+		}
+	}
+	v, _ := top.get("services")
+	services, ok := v.(*yamlMap)
+	if !ok {
+		return nil, nil, fmt.Errorf("expected services to be a mapping")
+	}
+
+	config := &Config{}
+	for _, name := range services.keys {
+		v, _ := services.get(name)
+		svc, ok := v.(*yamlMap)
+		if !ok {
+			return nil, nil, fmt.Errorf("%s: expected a mapping", name)
+		}
+		proc, svcWarnings, err := importService(name, svc, dir)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %v", name, err)
+		}
+		for _, w := range svcWarnings {
+			warnings = append(warnings, name+": "+w)
+		}
+		if proc != nil {
+			config.Procs = append(config.Procs, proc)
+		}
+	}
+
+	// Dependencies on skipped services are dropped
+	imported := make(map[string]bool, len(config.Procs))
+	for _, proc := range config.Procs {
+		imported[proc.Name] = true
+	}
+	for _, proc := range config.Procs {
+		deps := proc.DependsOn[:0]
+		for _, dep := range proc.DependsOn {
+			if imported[dep] {
+				deps = append(deps, dep)
+			} else {
+				warnings = append(warnings, fmt.Sprintf(
+					"%s: ignoring dependency on skipped service: %s", proc.Name, dep,
+				))
+			}
+		}
+		if proc.DependsOn = deps; len(deps) == 0 {
+			proc.DependsOn = nil
+		}
+	}
+	return config, warnings, nil
+}
+
+// Imports a compose service, returning nil if it has no command
+func importService(
+	name string, svc *yamlMap, dir string,
+) (*Process, []string, error) {
+	proc := &Process{Name: name}
+	var warnings, unsupported []string
+	var command, entrypoint []string
+	for _, key := range svc.keys {
+		v, _ := svc.get(key)
+		if v == nil {
+			continue
+		}
+		var err error
+		switch key {
+		case "command":
+			command, err = composeCommand(v)
+		case "entrypoint":
+			entrypoint, err = composeCommand(v)
+		case "environment":
+			proc.Env, err = composeEnv(v)
+		case "env_file":
+			var files []string
+			if files, err = composeStrings(v); err == nil && len(files) != 0 {
+				proc.EnvFile = importPath(dir, files[0])
+				if len(files) > 1 {
+					warnings = append(warnings, "only the first env_file is used")
+				}
+			}
+		case "working_dir":
+			var wd string
+			if wd, err = composeString(v); err == nil {
+				proc.Dir = importDir(dir, wd)
+			}
+		case "depends_on":
+			if m, ok := v.(*yamlMap); ok {
+				proc.DependsOn = append([]string(nil), m.keys...)
+			} else {
+				proc.DependsOn, err = composeStrings(v)
+			}
+		case "restart":
+			var restart string
+			if restart, err = composeString(v); err == nil {
+				proc.Restart, proc.MaxRetries, err = composeRestart(restart)
+			}
+		case "stop_signal":
+			var sig string
+			if sig, err = composeString(v); err != nil {
+				break
+			} else if _, err := parseStopSignal(sig); err != nil {
+				warnings = append(warnings, "unsupported stop_signal: "+sig)
+			} else {
+				proc.StopSignal = strings.TrimPrefix(strings.ToUpper(sig), "SIG")
+			}
+		case "stop_grace_period":
+			var period string
+			if period, err = composeString(v); err == nil {
+				proc.StopTimeout, err = composeDuration(period)
+			}
+		case "user":
+			var user string
+			if user, err = composeString(v); err == nil {
+				proc.User, proc.Group, _ = strings.Cut(user, ":")
+			}
+		case "tty":
+			proc.Interactive = v == "true"
+			if proc.Interactive && !ptySupported {
+				proc.Interactive = false
+				warnings = append(warnings, "tty not supported on this OS")
+			}
+		case "stdin_open", "container_name":
+		default:
+			if !strings.HasPrefix(key, "x-") {
+				unsupported = append(unsupported, key)
+			}
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %v", key, err)
+		}
+	}
+	if len(unsupported) != 0 {
+		warnings = append(
+			warnings, "ignoring unsupported fields: "+strings.Join(unsupported, ", "),
+		)
+	}
+
+	args := append(entrypoint, command...)
+	if len(args) == 0 {
+		return nil, append(
+			warnings,
+			"no command or entrypoint (the image's default command can't be run), skipped",
+		), nil
+	}
+	// Compose interpolates variables from the host's environment, with $$ for
+	// a literal $
+	interpolated := false
+	for i, arg := range args {
+		if composeVarRegex.MatchString(strings.ReplaceAll(arg, "$$", "")) {
+			interpolated = true
+		}
+		args[i] = strings.ReplaceAll(arg, "$$", "$")
+	}
+	if interpolated {
+		warnings = append(
+			warnings,
+			"variables in the command aren't interpolated (they're only expanded by a shell the command runs)",
+		)
+	}
+	proc.Program, proc.Args = args[0], args[1:]
+	if len(proc.Args) == 0 {
+		proc.Args = nil
+	}
+	if proc.Dir == "" {
+		proc.Dir = importDir(dir, "")
+	}
+	return proc, warnings, nil
+}
+
+// Returns the directory (relative to the imported file's directory) to run a
+// process in, or "" for the current directory
+func importDir(dir, wd string) string {
+	if wd = importPath(dir, wd); wd == "." {
+		return ""
+	}
+	return wd
+}
+
+// Returns the path relative to the imported file's directory
+func importPath(dir, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+func composeString(v any) (string, error) {
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("expected a string")
+	}
+	return s, nil
+}
+
+// Parses a string or a list of strings
+func composeStrings(v any) ([]string, error) {
+	if s, ok := v.(string); ok {
+		return []string{s}, nil
+	}
+	list, ok := v.([]any)
+	if !ok {
+		return nil, fmt.Errorf("expected a string or list of strings")
+	}
+	strs := make([]string, 0, len(list))
+	for _, item := range list {
+		s, ok := item.(string)
+		if !ok {
+			return nil, fmt.Errorf("expected a string or list of strings")
+		}
+		strs = append(strs, s)
+	}
+	return strs, nil
+}
+
+// Parses a command given as a list or as a string (split like a shell would,
+// without any expansions)
+func composeCommand(v any) ([]string, error) {
+	if s, ok := v.(string); ok {
+		return splitCommand(s)
+	}
+	return composeStrings(v)
+}
+
+// Parses an environment given as a mapping or a list of KEY=VALUE pairs.
+// Variables without values (taken from the host's environment in compose)
+// are left out since processes inherit the environment anyway.
+func composeEnv(v any) ([]string, error) {
+	var env []string
+	if m, ok := v.(*yamlMap); ok {
+		for _, key := range m.keys {
+			value, _ := m.get(key)
+			if value == nil {
+				continue
+			}
+			s, ok := value.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s: expected a string", key)
+			}
+			env = append(env, key+"="+s)
+		}
+		return env, nil
+	}
+	pairs, err := composeStrings(v)
+	if err != nil {
+		return nil, err
+	}
+	for _, pair := range pairs {
+		if strings.Contains(pair, "=") {
+			env = append(env, pair)
+		}
+	}
+	return env, nil
+}
+
+// Maps a compose restart policy to a restart policy and max retries
+func composeRestart(restart string) (string, int, error) {
+	policy, retries, _ := strings.Cut(restart, ":")
+	switch policy {
+	case "no":
+		return "", 0, nil
+	case "always", "unless-stopped":
+		return restartAlways, 0, nil
+	case "on-failure":
+		if retries == "" {
+			return restartOnFailure, 0, nil
+		}
+		n, err := strconv.Atoi(retries)
+		if err != nil || n < 0 {
+			return "", 0, fmt.Errorf("invalid max retries: %s", retries)
+		}
+		return restartOnFailure, n, nil
+	}
+	return "", 0, fmt.Errorf("invalid restart policy: %s", restart)
+}
+
+// Parses a compose duration (e.g., "1m30s") into seconds (rounded up)
+func composeDuration(s string) (time.Duration, error) {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		// Plain numbers are seconds
+		secs, err := strconv.ParseFloat(s, 64)
+		if err != nil || secs < 0 {
+			return 0, fmt.Errorf("invalid duration: %s", s)
+		}
+		d = time.Duration(secs * float64(time.Second))
+	}
+	return (d + time.Second - 1) / time.Second, nil
+}
+
+// Splits a command into arguments like a shell would (handling quotes and
+// backslashes), without any expansions
+func splitCommand(s string) ([]string, error) {
+	var args []string
+	var arg strings.Builder
+	inArg := false
+	var quote rune
+	escaped := false
+	for _, c := range s {
+		switch {
+		case escaped:
+			if quote == '"' && !strings.ContainsRune(`"\$`+"`", c) {
+				arg.WriteByte('\\')
+			}
+			arg.WriteRune(c)
+			escaped = false
+		case c == '\\' && quote != '\'':
+			escaped, inArg = true, true
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				arg.WriteRune(c)
+			}
+		case c == '"' || c == '\'':
+			quote, inArg = c, true
+		case c == ' ' || c == '\t' || c == '\n':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(c)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote in command: %s", s)
+	} else if escaped {
+		return nil, fmt.Errorf("trailing backslash in command: %s", s)
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
+
+// Writes the config to path as TOML, with the warnings as comments at the top
+func writeConfigTOML(path string, config *Config, warnings []string) error {
+	var buf bytes.Buffer
+	if len(warnings) != 0 {
+		buf.WriteString("# Warnings from importing:\n")
+		for _, w := range warnings {
+			buf.WriteString("#   " + w + "\n")
+		}
+		buf.WriteString("\n")
+	}
+	if err := encodeConfigTOML(&buf, config); err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0666)
+}
+
+// Writes the config as TOML. This is used rather than a toml.Encoder since
+// that writes durations as strings (e.g., "10s") while config durations are
+// numbers (of seconds).
+func encodeConfigTOML(w io.Writer, config *Config) error {
+	var buf bytes.Buffer
+	err := encodeTOMLTable(&buf, "", false, reflect.ValueOf(config).Elem())
+	if err != nil {
+		return err
+	}
+	// Tables are written with a blank line before them
+	_, err = w.Write(bytes.TrimPrefix(buf.Bytes(), []byte{'\n'}))
+	return err
+}
+
+// A table (or array of tables) nested in a struct being encoded as TOML
+type tomlTable struct {
+	key   string
+	array bool
+	// The structs (one unless array)
+	values []reflect.Value
+}
+
+// Writes the struct as the table with the given name (the top-level table if
+// the name is empty), followed by its nested tables
+func encodeTOMLTable(
+	w io.Writer, name string, array bool, v reflect.Value,
+) error {
+	fields, tables, err := tomlFields(v)
+	if err != nil {
+		return err
+	}
+	if array {
+		fmt.Fprintf(w, "\n[[%s]]\n", name)
+	} else if name != "" {
+		fmt.Fprintf(w, "\n[%s]\n", name)
+	}
+	for _, field := range fields {
+		fmt.Fprintln(w, field)
+	}
+	for _, table := range tables {
+		tableName := table.key
+		if name != "" {
+			tableName = name + "." + table.key
+		}
+		for _, tv := range table.values {
+			err := encodeTOMLTable(w, tableName, table.array, tv)
+			if err != nil {
+				return fmt.Errorf("%s: %v", table.key, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Returns the "key = value" lines of the struct's non-zero fields along with
+// the fields that are tables (structs) or arrays of tables (slices of
+// structs)
+func tomlFields(v reflect.Value) ([]string, []tomlTable, error) {
+	var fields []string
+	var tables []tomlTable
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f, fv := t.Field(i), v.Field(i)
+		key := strings.Split(f.Tag.Get("toml"), ",")[0]
+		if !f.IsExported() || key == "" || key == "-" || fv.IsZero() {
+			continue
+		}
+		if fv.Kind() == reflect.Ptr {
+			fv = fv.Elem()
+		}
+		var value string
+		switch fv.Kind() {
+		case reflect.String:
+			value = tomlString(fv.String())
+		case reflect.Bool:
+			value = strconv.FormatBool(fv.Bool())
+		case reflect.Int, reflect.Int32, reflect.Int64:
+			// Durations are also written as numbers
+			value = strconv.FormatInt(fv.Int(), 10)
+		case reflect.Uint, reflect.Uint32, reflect.Uint64:
+			value = strconv.FormatUint(fv.Uint(), 10)
+		case reflect.Float32, reflect.Float64:
+			value = strconv.FormatFloat(fv.Float(), 'g', -1, 64)
+		case reflect.Struct:
+			tables = append(tables, tomlTable{
+				key: key, values: []reflect.Value{fv},
+			})
+			continue
+		case reflect.Slice:
+			elemType := fv.Type().Elem()
+			if elemType.Kind() == reflect.Ptr {
+				elemType = elemType.Elem()
+			}
+			switch {
+			case fv.Type().Elem().Kind() == reflect.String:
+			case elemType.Kind() == reflect.Struct:
+				table := tomlTable{key: key, array: true}
+				for j := 0; j < fv.Len(); j++ {
+					if ev := reflect.Indirect(fv.Index(j)); ev.IsValid() {
+						table.values = append(table.values, ev)
+					}
+				}
+				tables = append(tables, table)
+				continue
+			default:
+				return nil, nil, fmt.Errorf("%s: unsupported type", key)
+			}
+			strs := make([]string, fv.Len())
+			for j := range strs {
+				strs[j] = tomlString(fv.Index(j).String())
+			}
+			value = "[" + strings.Join(strs, ", ") + "]"
+		default:
+			return nil, nil, fmt.Errorf("%s: unsupported type", key)
+		}
+		fields = append(fields, key+" = "+value)
+	}
+	return fields, tables, nil
+}
+
+// Quotes the string as a TOML basic string
+func tomlString(s string) string {
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for _, c := range s {
+		switch {
+		case c == '"' || c == '\\':
+			sb.WriteByte('\\')
+			sb.WriteRune(c)
+		case c == '\n':
+			sb.WriteString(`\n`)
+		case c == '\t':
+			sb.WriteString(`\t`)
+		case c == '\r':
+			sb.WriteString(`\r`)
+		case c < 0x20 || c == 0x7f || c == utf8.RuneError:
+			fmt.Fprintf(&sb, `\u%04X`, c)
+		default:
+			sb.WriteRune(c)
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
@@ -0,0 +1,200 @@
+package cli
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/BurntSushi/toml"
+)
+
+func TestImportProcfile(t *testing.T) {
+	data := "# comment\n" +
+		"web: bundle exec rails s -p $PORT\n" +
+		"\n" +
+		"worker:   ./worker --queue=default\n" +
+		"not a process\n" +
+		"api: node api.js --port ${PORT:-3000}\n"
+	config, warnings, err := importProcfile([]byte(data), "app")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []*Process{
+		{
+			Name: "web", Program: "sh", Dir: "app",
+			Args: []string{"-c", "bundle exec rails s -p $PORT"},
+			Env:  []string{"PORT=5000"},
+		},
+		{
+			Name: "worker", Program: "sh", Dir: "app",
+			Args: []string{"-c", "./worker --queue=default"},
+		},
+		{
+			Name: "api", Program: "sh", Dir: "app",
+			Args: []string{"-c", "node api.js --port ${PORT:-3000}"},
+			Env:  []string{"PORT=5200"},
+		},
+	}
+	if !reflect.DeepEqual(config.Procs, want) {
+		t.Errorf("got %s, want %s", procsString(config.Procs), procsString(want))
+	}
+	if len(warnings) != 1 || !strings.HasPrefix(warnings[0], "line 5:") {
+		t.Errorf("expected a warning for line 5, got %q", warnings)
+	}
+}
+
+func TestImportCompose(t *testing.T) {
+	data := `
+version: "3.8"
+x-defaults: &defaults
+  restart: on-failure:3
+  environment:
+    MODE: dev
+    UNSET:
+services:
+  db:
+    image: postgres
+    ports: ["5432:5432"]
+  web:
+    <<: *defaults
+    command: ["python3", "-m", "http.server", "8000"]
+    working_dir: src
+    depends_on:
+      db:
+        condition: service_started
+      cache:
+        condition: service_started
+  cache:
+    <<: *defaults
+    entrypoint: redis-server
+    command: >
+      --port 6380
+      --save ''
+    environment: [A=1, B]
+    stop_signal: SIGINT
+    stop_grace_period: 1m30s
+    user: redis:redis
+  worker:
+    command: |
+      sh -c "echo $$HOME"
+    restart: always
+    env_file: [a.env, b.env]
+volumes:
+  data:
+`
+	config, warnings, err := importCompose([]byte(data), "/app")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []*Process{
+		{
+			Name: "web", Program: "python3",
+			Args:      []string{"-m", "http.server", "8000"},
+			Dir:       "/app/src",
+			DependsOn: []string{"cache"},
+			Restart:   restartOnFailure, MaxRetries: 3,
+			Env: []string{"MODE=dev"},
+		},
+		{
+			Name: "cache", Program: "redis-server",
+			Args:       []string{"--port", "6380", "--save", ""},
+			Dir:        "/app",
+			Env:        []string{"A=1"},
+			StopSignal: "INT", StopTimeout: 90,
+			User: "redis", Group: "redis",
+			Restart: restartOnFailure, MaxRetries: 3,
+		},
+		{
+			Name: "worker", Program: "sh",
+			Args:    []string{"-c", "echo $HOME"},
+			Dir:     "/app",
+			EnvFile: "/app/a.env",
+			Restart: restartAlways,
+		},
+	}
+	if !reflect.DeepEqual(config.Procs, want) {
+		t.Errorf("got %s, want %s", procsString(config.Procs), procsString(want))
+	}
+	wantWarnings := []string{
+		"ignoring top-level key: volumes",
+		"db: ignoring unsupported fields: image, ports",
+		"db: no command or entrypoint (the image's default command can't be run), skipped",
+		"worker: only the first env_file is used",
+		"web: ignoring dependency on skipped service: db",
+	}
+	if !reflect.DeepEqual(warnings, wantWarnings) {
+		t.Errorf("got warnings %q, want %q", warnings, wantWarnings)
+	}
+}
+
+func TestImportComposeErrors(t *testing.T) {
+	tests := map[string]string{
+		"not a mapping":     "- a\n",
+		"no services":       "version: '3'\n",
+		"service not a map": "services:\n  web: x\n",
+		"bad restart":       "services:\n  web:\n    command: x\n    restart: sometimes\n",
+		"bad duration":      "services:\n  web:\n    command: x\n    stop_grace_period: soon\n",
+		"bad command":       "services:\n  web:\n    command: \"echo 'hi\"\n",
+	}
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, _, err := importCompose([]byte(data), "."); err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
+
+func TestEncodeConfigTOML(t *testing.T) {
+	config := &Config{
+		ServerAddr: "127.0.0.1:8080",
+		Env:        []string{"A=1"},
+		Procs: []*Process{
+			{
+				Name: "web", Program: "sh",
+				Args:        []string{"-c", "echo \"hi\"\n\tthere"},
+				StopTimeout: 10,
+				Readiness: &HealthCheck{
+					Type: "http", URL: "http://localhost:8000", Interval: 5,
+				},
+				OnOutput: []*OutputTrigger{
+					{Match: "error", Action: "notify", Message: "web failed"},
+					{Match: "ready", Action: "exec", Command: []string{"true"}},
+				},
+			},
+			{Name: "worker", Program: "./worker", DependsOn: []string{"web"}},
+		},
+	}
+	var buf bytes.Buffer
+	if err := encodeConfigTOML(&buf, config); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := &Config{}
+	if _, err := toml.Decode(buf.String(), got); err != nil {
+		t.Fatalf("error decoding output: %v\n%s", err, buf.String())
+	}
+	if !reflect.DeepEqual(got, config) {
+		t.Errorf("round trip changed the config, output:\n%s", buf.String())
+	}
+	if strings.HasPrefix(buf.String(), "\n") {
+		t.Errorf("output starts with a blank line")
+	}
+}
+
+func procsString(procs []*Process) string {
+	var sb strings.Builder
+	for _, proc := range procs {
+		sb.WriteString("\n" + procString(proc))
+	}
+	return sb.String()
+}
+
+func procString(proc *Process) string {
+	var sb strings.Builder
+	fields, _, _ := tomlFields(reflect.ValueOf(proc).Elem())
+	for _, field := range fields {
+		sb.WriteString(field + "; ")
+	}
+	return sb.String()
+}
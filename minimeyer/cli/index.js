@@ -5,32 +5,106 @@ class Action {
   static Finished = "finished";
   static Interrupt = "interrupt";
   static Kill = "kill";
+  static Stop = "stop";
   static Del = "del";
   static InterruptRestart = "interrupt-restart";
   static KillRestart = "kill-restart";
   static Refresh = "refresh";
   static Env = "env";
   static Password = "password";
+  static Health = "health";
+  static Tail = "tail";
+  static Untail = "untail";
+  static Log = "log";
+  static Reload = "reload";
+  static Usage = "usage";
+  static Runs = "runs";
+  static Bulk = "bulk";
+  static History = "history";
+  static Trigger = "trigger";
+  static Attach = "attach";
   static Error = "error";
 };
 class Status {
   static NotStarted = "NOT STARTED";
   static Running = "RUNNING";
   static Finished = "FINISHED";
+  static Healthy = "HEALTHY";
+  static Unhealthy = "UNHEALTHY";
 };
+function isRunning(proc) {
+  return proc.status == Status.Running || proc.status == Status.Healthy ||
+    proc.status == Status.Unhealthy;
+}
 
 function newProc(name) {
   return {
     "name" : name,
     "program" : "",
     "dir" : "",
+    "user" : "",
+    "group" : "",
+    "umask" : "",
+    "envFile" : "",
+    "stdin" : "",
+    "interactive" : false,
     "args" : [],
     "env" : [],
     "outFilename" : "",
     "errFilename" : "",
+    "dependsOn" : [],
+    "restart" : "",
+    "maxRetries" : 0,
+    "limitNofile" : 0,
+    "limitAs" : "",
+    "limitCpu" : 0,
+    "nice" : 0,
+    "schedule" : "",
+    "overlap" : "",
+    "procGroup" : "",
+    "tagsStr" : "",
   };
 }
 
+// Max number of lines kept for each process console
+const maxConsoleLines = 1000;
+// How often (in ms) the resource usage of the processes is requested
+const usageInterval = 2000;
+
+// Formats a size in bytes (e.g., "12.3M")
+function formatSize(n) {
+  const units = "KMGT";
+  if (n < 1024) {
+    return `${n}B`;
+  }
+  let i = 0;
+  n /= 1024;
+  while (n >= 1024 && i < units.length - 1) {
+    n /= 1024;
+    i++;
+  }
+  return `${n.toFixed(1)}${units[i]}`;
+}
+
+// Returns the URL of the websocket
+function wsURL() {
+  const url = new URL(document.location.origin);
+  if (!url.pathname.endsWith("/")) {
+    url.pathname += "/";
+  }
+  url.pathname += "ws";
+  if (url.protocol === "https:") {
+    url.protocol = "wss";
+  } else {
+    url.protocol = "ws";
+  }
+  return url.toString();
+}
+
+// Maps process nums to the terminals attached to them and their websockets
+// (kept out of the app's data since xterm.js manages the terminals itself)
+const terminals = new Map();
+
 function newMsg(action, content) {
   return {"action" : action, "content" : content};
 }
@@ -40,17 +114,7 @@ function newMsgProc(action, proc) {
 
 const App = {
   data() {
-    const url = new URL(document.location.origin);
-    if (!url.pathname.endsWith("/")) {
-      url.pathname += "/";
-    }
-    url.pathname += "ws";
-    if (url.protocol === "https") {
-      url.protocol = "wss";
-    } else {
-      url.protocol = "ws";
-    }
-    const ws = new WebSocket(url.toString());
+    const ws = new WebSocket(wsURL());
     ws.onopen = () => {
       /*
       this.refreshProcs();
@@ -60,6 +124,7 @@ const App = {
     ws.onmessage = this.msgHandler;
     ws.onerror = this.errHandler;
     ws.onclose = (ev) => {
+      clearInterval(this.usageTimer);
       console.log("Closed:", ev);
       alert("Connection closed");
     };
@@ -74,11 +139,66 @@ const App = {
 
       detailsShowing : false,
 
+      // Text the shown processes are filtered by: part of a name, or a group
+      // or tag selector (group:NAME or tag:NAME)
+      procFilter : "",
+      groupByGroup : false,
+      // Maps group names to whether they're collapsed
+      collapsedGroups : {},
+
+      // Maps process nums to the lines of output being shown
+      consoles : {},
+      // Maps process nums to the runs being shown
+      runs : {},
+      // Maps process nums to whether a terminal is attached to them
+      attached : {},
+      // Events from the state file being shown (null if not shown)
+      history : null,
+
       ws : ws,
-      Status: Status
+      usageTimer : null,
+      Status: Status,
+      isRunning: isRunning,
+      formatSize: formatSize
     };
   },
 
+  computed : {
+    // The selector in the filter, if it's one
+    filterSelector() {
+      const [kind, ...rest] = this.procFilter.trim().split(":");
+      const name = rest.join(":").trim();
+      if (name === "" || (kind !== "group" && kind !== "tag")) {
+        return null;
+      }
+      return {[kind] : name};
+    },
+    // The filtered processes, in groups if grouping by group
+    procGroups() {
+      const sel = this.filterSelector;
+      const filter = this.procFilter.trim().toLowerCase();
+      const procs = this.procs.filter((p) => {
+        if (sel) {
+          return (!sel.group || p.procGroup === sel.group) &&
+            (!sel.tag || (p.tags ?? []).includes(sel.tag));
+        }
+        return p.name.toLowerCase().includes(filter);
+      });
+      if (!this.groupByGroup) {
+        return [{name : "", procs : procs}];
+      }
+      const groups = new Map();
+      for (const proc of procs) {
+        const name = proc.procGroup ?? "";
+        if (!groups.has(name)) {
+          groups.set(name, {name : name, procs : []});
+        }
+        groups.get(name).procs.push(proc);
+      }
+      return [...groups.values()].sort((a, b) => a.name.localeCompare(b.name));
+    },
+  },
+
   methods : {
     startNewProc() {
       this.editing = true;
@@ -92,7 +212,10 @@ const App = {
           return;
         }
       }
-      this.sendMsg(newMsgProc(Action.Add, this.proc));
+      const proc = {...this.proc};
+      proc.tags = proc.tagsStr.split(",").map((t) => t.trim()).filter((t) => t);
+      delete proc.tagsStr;
+      this.sendMsg(newMsgProc(Action.Add, proc));
       this.clearProc();
       this.editing = false;
     },
@@ -105,6 +228,9 @@ const App = {
     killProc(num) {
       this.sendMsg(newMsg(Action.Kill, num));
     },
+    stopProc(num) {
+      this.sendMsg(newMsg(Action.Stop, num));
+    },
     interruptRestartProc(num) {
       this.sendMsg(newMsg(Action.InterruptRestart, num));
     },
@@ -112,14 +238,139 @@ const App = {
       this.sendMsg(newMsg(Action.KillRestart, num));
     },
     delProc(num) { this.sendMsg(newMsg(Action.Del, num)); },
+    bulk(sel, action) {
+      const what = sel.group ? `group ${sel.group}` : `tag ${sel.tag}`;
+      if (action == "del" && !confirm(`Delete all processes in ${what}?`)) {
+        return;
+      }
+      this.sendMsg(newMsg(Action.Bulk, {...sel, "action" : action}));
+    },
+    toggleGroup(name) {
+      this.collapsedGroups[name] = !this.collapsedGroups[name];
+    },
+    tailProc(num) {
+      this.consoles[num] = [];
+      this.sendMsg(newMsg(Action.Tail, num));
+    },
+    untailProc(num) {
+      delete this.consoles[num];
+      this.sendMsg(newMsg(Action.Untail, num));
+    },
+    attachProc(num) {
+      this.attached[num] = true;
+      this.$nextTick(() => this.openTerminal(num));
+    },
+    detachProc(num) {
+      const t = terminals.get(num);
+      if (t) {
+        terminals.delete(num);
+        t.ws.close();
+        t.resizeObserver.disconnect();
+        t.term.dispose();
+      }
+      delete this.attached[num];
+    },
+    // Opens a terminal attached to the process over its own websocket, which
+    // carries the raw output of the process once attached
+    openTerminal(num) {
+      const elem = document.getElementById(`terminal-${num}`);
+      if (!elem || terminals.has(num)) {
+        return;
+      }
+      const term = new Terminal({cursorBlink : true});
+      const fit = new FitAddon.FitAddon();
+      term.loadAddon(fit);
+      term.open(elem);
+      fit.fit();
+
+      const ws = new WebSocket(wsURL());
+      ws.binaryType = "arraybuffer";
+      const send = (input) => {
+        if (ws.readyState === WebSocket.OPEN) {
+          ws.send(JSON.stringify(input));
+        }
+      };
+      ws.onopen = () => { ws.send(JSON.stringify(newMsg(Action.Attach, num))); };
+      ws.onmessage = (ev) => {
+        if (ev.data instanceof ArrayBuffer) {
+          term.write(new Uint8Array(ev.data));
+          return;
+        }
+        // Messages sent before attaching
+        const msg = JSON.parse(ev.data);
+        if (msg.action === Action.Attach) {
+          send({"rows" : term.rows, "cols" : term.cols});
+        } else if (msg.action === Action.Error) {
+          alert(`Error attaching: ${msg.error}`);
+          this.detachProc(num);
+        }
+      };
+      ws.onclose = () => { term.write("\r\n[Detached]\r\n"); };
+      term.onData((data) => send({"data" : data}));
+      term.onResize(({rows, cols}) => send({"rows" : rows, "cols" : cols}));
+      const resizeObserver = new ResizeObserver(() => fit.fit());
+      resizeObserver.observe(elem);
+      terminals.set(num, {term, ws, resizeObserver});
+      term.focus();
+    },
+    getHistory() { this.sendMsg(newMsg(Action.History, {"limit" : 100})); },
+    getRuns(num) {
+      // Null until the history is received
+      this.runs[num] = null;
+      this.sendMsg(newMsg(Action.Runs, num));
+    },
+    addRuns(content) {
+      const runs = this.runs[content.num];
+      if (runs === null) {
+        this.runs[content.num] = content.runs;
+      } else if (runs !== undefined) {
+        runs.push(...content.runs);
+      }
+    },
+    addLogLines(content) {
+      const lines = this.consoles[content.num];
+      if (lines === undefined) {
+        return;
+      }
+      const lastSeq = lines.length ? lines[lines.length - 1].seq : 0;
+      for (const line of content.lines ?? []) {
+        if (line.seq > lastSeq) {
+          lines.push(line);
+        }
+      }
+      if (lines.length > maxConsoleLines) {
+        lines.splice(0, lines.length - maxConsoleLines);
+      }
+      this.$nextTick(() => {
+        const elem = document.getElementById(`console-${content.num}`);
+        if (elem) {
+          elem.scrollTop = elem.scrollHeight;
+        }
+      });
+    },
     cloneProc(proc) {
       Object.assign(this.proc, proc);
+      this.proc.tagsStr = (proc.tags ?? []).join(", ");
       delete this.proc.num;
       this.editing = true;
     },
     clearProc() { this.proc = newProc(); },
     getGlobalEnv() { this.sendMsg(newMsg(Action.Env)); },
     refreshProcs() { this.sendMsg(newMsg(Action.Refresh)); },
+    getUsage() { this.sendMsg(newMsg(Action.Usage)); },
+    reloadConfig() { this.sendMsg(newMsg(Action.Reload, "plan")); },
+    planString(plan) {
+      let s = "";
+      for (const [what, names] of [
+        ["Add", plan.add], ["Remove", plan.remove],
+        ["Restart", plan.restart], ["Update", plan.update],
+      ]) {
+        if (names && names.length) {
+          s += `${what}: ${names.join(", ")}\n`;
+        }
+      }
+      return s;
+    },
     findProcOrRefresh(num) {
       const proc = this.procs.find((p) => p.num == num);
       if (proc) {
@@ -142,6 +393,9 @@ const App = {
         }
         this.refreshProcs();
         this.getGlobalEnv();
+        if (this.usageTimer === null) {
+          this.usageTimer = setInterval(this.getUsage, usageInterval);
+        }
         break;
       case Action.Password:
         let pwd;
@@ -156,21 +410,24 @@ const App = {
         }
         break;
       case Action.Start:
-        var proc = this.findProcOrRefresh(msg.content);
-        if (proc) {
-          proc.status = Status.Finished;
+        for (var proc of msg.processes ?? []) {
+          this.replaceProc(proc);
         }
         break;
       case Action.Finished:
         var proc = this.findProcOrRefresh(msg.content);
         if (proc) {
           proc.status = Status.Finished;
+          proc.stopping = false;
         }
         break;
+      case Action.Stop:
       case Action.Interrupt:
+        // Shown as stopping until it exits (which may take up to its stop
+        // timeout)
         var proc = this.findProcOrRefresh(msg.content);
         if (proc) {
-          // TODO
+          proc.stopping = true;
         }
         break;
       case Action.Kill:
@@ -180,6 +437,7 @@ const App = {
         }
         break;
       case Action.Del:
+        this.detachProc(msg.content);
         const i = this.procs.findIndex((p) => p.num == msg.content);
         if (i != -1) {
           this.procs.splice(i, 1)
@@ -192,25 +450,55 @@ const App = {
             return;
           }
           for (var num of msg.content) {
-            const i = this.procs.findIndexOf((p) => p.num == num);
+            const i = this.procs.findIndex((p) => p.num == num);
             if (i != -1) {
               this.procs.splice(i, 1);
             }
           }
         }
-        for (var proc of msg.processes) {
-          const i = this.procs.findIndexOf((p) => p.num == proc.num);
-          if (i != -1) {
-            this.procs[i] = proc;
-          } else {
-            this.procs.push(proc);
-          }
+        for (var proc of msg.processes ?? []) {
+          this.replaceProc(proc);
         }
-        this.sortProcs();
         break;
       case Action.Env:
         this.globalEnv = msg.content;
         break;
+      case Action.Log:
+        this.addLogLines(msg.content);
+        break;
+      case Action.Health:
+        for (var proc of msg.processes ?? []) {
+          this.replaceProc(proc);
+        }
+        break;
+      case Action.Reload:
+        if (!msg.content.dryRun) {
+          break;
+        }
+        const plan = this.planString(msg.content);
+        if (plan == "") {
+          alert("No changes");
+        } else if (confirm(`Reload config?\n${plan}`)) {
+          this.sendMsg(newMsg(Action.Reload));
+        }
+        break;
+      case Action.History:
+        this.history = msg.content ?? [];
+        break;
+      case Action.Runs:
+        this.addRuns(msg.content);
+        break;
+      case Action.Trigger:
+        var proc = this.findProcOrRefresh(msg.content.num);
+        if (proc) {
+          proc.lastTrigger = msg.content;
+        }
+        break;
+      case Action.Usage:
+        for (const proc of this.procs) {
+          proc.usage = msg.content[proc.num];
+        }
+        break;
       case Action.Error:
         alert(`Error received: ${msg.error}`);
         break;
@@ -233,6 +521,16 @@ const App = {
       }
       this.detailsShowing = !this.detailsShowing;
     },
+    replaceProc(proc) {
+      const i = this.procs.findIndex((p) => p.num == proc.num);
+      if (i != -1) {
+        this.procs[i] = proc;
+      } else {
+        this.procs.push(proc);
+        this.sortProcs();
+      }
+    },
+    timeString(t) { return new Date(t).toLocaleTimeString(); },
     sortProcs() {
       this.procs.sort((a, b) => {
         if (a.num > b.num) {
@@ -0,0 +1,275 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	webs "golang.org/x/net/websocket"
+)
+
+// Compatibility with clients of the old minimeyer server, which exchanged
+// messages with a single "process" (identified by name, with the program as
+// its "path" and a numeric "status") and string "contents". A websocket
+// connection uses the legacy protocol if the first message it sends has a
+// "process" field.
+
+// Statuses of processes in the legacy protocol
+const (
+	legacyStatusNotStarted int32 = iota
+	legacyStatusRunning
+	legacyStatusStopping
+	legacyStatusStopped
+)
+
+// Legacy actions with no equivalent in the current protocol are handled like
+// their current counterparts (e.g., "del" kills and then removes the process)
+type legacyMessage struct {
+	Action   string         `json:"action"`
+	Process  *legacyProcess `json:"process,omitempty"`
+	Contents string         `json:"contents,omitempty"`
+}
+
+type legacyProcess struct {
+	Name string   `json:"name"`
+	Path string   `json:"path"`
+	Args []string `json:"args"`
+	Env  []string `json:"env"`
+	Dir  string   `json:"dir"`
+	// One of the legacy statuses
+	Status int32 `json:"status"`
+	// Error the last run exited with (only set if not running)
+	Error string `json:"error"`
+	// Stderr of the current or last run
+	Stderr string `json:"stderr"`
+}
+
+func newLegacyProcess(p *Process) *legacyProcess {
+	status := p.status.Load()
+	p.procMtx.RLock()
+	lp := &legacyProcess{
+		Name: p.Name,
+		Path: p.Program,
+		Args: p.Args,
+		Env:  p.Env,
+		Dir:  p.Dir,
+	}
+	startedAt, logs := p.startedAt, p.logs
+	switch {
+	case isRunningStatus(status):
+		lp.Status = legacyStatusRunning
+	case status == statusNotStarted:
+		lp.Status = legacyStatusNotStarted
+	default:
+		lp.Status = legacyStatusStopped
+		lp.Error = p.exitErr
+	}
+	p.procMtx.RUnlock()
+	if logs != nil {
+		var stderr strings.Builder
+		for _, line := range logs.Tail(0) {
+			if line.Stream == streamStderr && !line.Time.Before(startedAt) {
+				stderr.WriteString(line.Line + "\n")
+			}
+		}
+		lp.Stderr = stderr.String()
+	}
+	return lp
+}
+
+// Returns true if the (first) message uses the legacy protocol
+func isLegacyMsg(raw []byte) bool {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return false
+	}
+	_, ok := fields["process"]
+	return ok
+}
+
+// A websocket connection using the legacy protocol. Notifications sent to it
+// are translated to legacy messages.
+type legacyConn struct {
+	*webs.Conn
+	// Names of the processes sent, by number, so that the name of a removed
+	// process is known
+	names    map[int]string
+	namesMtx sync.Mutex
+}
+
+func (lc *legacyConn) send(action string, p *Process) error {
+	lp := newLegacyProcess(p)
+	lc.namesMtx.Lock()
+	lc.names[p.Num] = p.Name
+	lc.namesMtx.Unlock()
+	return webs.JSON.Send(lc.Conn, legacyMessage{Action: action, Process: lp})
+}
+
+func (lc *legacyConn) sendErr(format string, args ...any) error {
+	return webs.JSON.Send(lc.Conn, legacyMessage{
+		Action:   ActionError,
+		Contents: fmt.Sprintf(format, args...),
+	})
+}
+
+// Translates a notification (see notify) to legacy messages, ignoring those
+// with no legacy counterpart
+func (lc *legacyConn) notify(v any) error {
+	msg, ok := v.(Message)
+	if !ok {
+		return nil
+	}
+	switch msg.Action {
+	case ActionAdd, ActionStart:
+		for _, p := range msg.Processes {
+			if err := lc.send(msg.Action, p); err != nil {
+				return err
+			}
+		}
+	case ActionFinished:
+		// The legacy server sent kill messages once processes exited
+		if num, ok := msg.Content.(int); ok {
+			if p := app.GetProcByNum(num); p != nil {
+				return lc.send(ActionKill, p)
+			}
+		}
+	case ActionDel:
+		num, ok := msg.Content.(int)
+		if !ok {
+			return nil
+		}
+		lc.namesMtx.Lock()
+		name, ok := lc.names[num]
+		delete(lc.names, num)
+		lc.namesMtx.Unlock()
+		if ok {
+			return webs.JSON.Send(lc.Conn, legacyMessage{
+				Action:  ActionDel,
+				Process: &legacyProcess{Name: name},
+			})
+		}
+	}
+	return nil
+}
+
+// Handles the messages of a websocket connection using the legacy protocol,
+// starting with the first message received
+func handleLegacyMsgs(ws *webs.Conn, first []byte) {
+	lc := &legacyConn{Conn: ws, names: make(map[int]string)}
+	key := ws.Request().RemoteAddr
+	conns.Store(key, lc)
+	defer conns.Delete(key)
+	for raw := first; srvrRunning.Load(); {
+		var msg legacyMessage
+		if err := json.Unmarshal(raw, &msg); err != nil {
+			lc.sendErr("invalid message: %v", err)
+		} else {
+			lc.handle(msg)
+		}
+		if err := webs.Message.Receive(ws, &raw); err != nil {
+			return
+		}
+	}
+}
+
+func (lc *legacyConn) handle(msg legacyMessage) {
+	lp := msg.Process
+	if lp == nil {
+		lp = &legacyProcess{}
+	}
+	switch msg.Action {
+	case ActionAdd:
+		if lp.Name == "" || lp.Path == "" {
+			lc.sendErr("must have name and path")
+		} else if app.GetProcByName(lp.Name) != nil {
+			lc.sendErr("process exists")
+		} else if _, err := lc.add(lp); err != nil {
+			lc.sendErr("%v", err)
+		}
+	case ActionStart:
+		if lp.Name == "" {
+			return
+		}
+		proc := app.GetProcByName(lp.Name)
+		if proc == nil {
+			if lp.Path == "" {
+				lc.sendErr("must have name and path")
+				return
+			}
+			var err error
+			if proc, err = lc.add(lp); err != nil {
+				lc.sendErr("%v", err)
+				return
+			}
+		} else if lp.Path != "" && !isRunningStatus(proc.status.Load()) {
+			// Started with the (possibly edited) program, args, env, and dir
+			proc.procMtx.Lock()
+			proc.Program, proc.Args, proc.Dir = lp.Path, lp.Args, lp.Dir
+			if len(lp.Env) != 0 {
+				proc.Env = processEnv(app.env, &Process{Env: lp.Env})
+			}
+			proc.procMtx.Unlock()
+		}
+		if err := proc.Start(); err != nil {
+			lc.sendErr("%v", err)
+		}
+	case ActionKill, ActionInterrupt:
+		proc := app.GetProcByName(lp.Name)
+		if proc == nil {
+			return
+		} else if !isRunningStatus(proc.status.Load()) {
+			lc.sendErr("process stopped")
+			return
+		}
+		stop := (*Process).kill
+		if msg.Action == ActionInterrupt {
+			stop = (*Process).interrupt
+		}
+		if err := stop(proc); err != nil {
+			lc.sendErr("%v", err)
+		}
+	case ActionDel:
+		if proc := app.GetProcByName(lp.Name); proc != nil {
+			app.BulkAction(ActionDel, []*Process{proc})
+		}
+	case ActionRefresh:
+		procs := app.procsSnapshot()
+		lps := make([]*legacyProcess, 0, len(procs))
+		lc.namesMtx.Lock()
+		for _, p := range procs {
+			lps = append(lps, newLegacyProcess(p))
+			lc.names[p.Num] = p.Name
+		}
+		lc.namesMtx.Unlock()
+		b, _ := json.Marshal(lps)
+		webs.JSON.Send(lc.Conn, legacyMessage{
+			Action: ActionRefresh, Contents: string(b),
+		})
+	case ActionEnv:
+		b, _ := json.Marshal(app.env)
+		webs.JSON.Send(lc.Conn, legacyMessage{
+			Action: ActionEnv, Contents: string(b),
+		})
+	case ActionError:
+		// Shouldn't be received from the client
+	default:
+		lc.sendErr("invalid action: %s", msg.Action)
+	}
+}
+
+// Adds the legacy process
+func (lc *legacyConn) add(lp *legacyProcess) (*Process, error) {
+	proc := &Process{
+		Name:    lp.Name,
+		Program: lp.Path,
+		Args:    lp.Args,
+		Env:     lp.Env,
+		Dir:     lp.Dir,
+	}
+	if err := proc.validate(); err != nil {
+		return nil, err
+	}
+	app.AddRuntimeProc(proc)
+	return proc, nil
+}
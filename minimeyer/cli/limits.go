@@ -0,0 +1,151 @@
+package cli
+
+import (
+	"fmt"
+	"time"
+)
+
+// How often the resource usage of running processes is sampled
+const usageSampleInterval = 2 * time.Second
+
+// Resource usage of a process and the processes it started (its process
+// group)
+type ResourceUsage struct {
+	// CPU usage since the last sample (100 = one full core)
+	CPUPercent float64 `json:"cpuPercent"`
+	// Resident set size in bytes
+	RSS int64 `json:"rss"`
+	// Number of open file descriptors
+	FDs int `json:"fds"`
+	// Number of processes in the group
+	Procs int `json:"procs"`
+	// Time of the sample
+	Time time.Time `json:"time"`
+}
+
+func (u *ResourceUsage) String() string {
+	return fmt.Sprintf(
+		"CPU %.1f%%, RSS %s, %d FDs, %d procs",
+		u.CPUPercent, formatSize(u.RSS), u.FDs, u.Procs,
+	)
+}
+
+// Returns an error if the process's resource limits or nice value are
+// invalid
+func (p *Process) validateLimits() error {
+	hasLimits := p.LimitNofile != 0 || p.LimitAS != "" || p.LimitCPU != 0 ||
+		p.Nice != 0
+	if hasLimits && !limitsSupported {
+		return fmt.Errorf(
+			"%s: resource limits and nice aren't supported on this OS", p.Name,
+		)
+	}
+	if _, err := parseSize(p.LimitAS); err != nil {
+		return fmt.Errorf("%s: invalid address space limit: %v", p.Name, err)
+	} else if p.LimitCPU < 0 {
+		return fmt.Errorf("%s: CPU time limit must be non-negative", p.Name)
+	} else if p.Nice < -20 || p.Nice > 19 {
+		return fmt.Errorf("%s: nice must be between -20 and 19", p.Name)
+	}
+	return nil
+}
+
+// Returns the last sampled resource usage of each running process by num
+func (a *App) Usage() map[int]*ResourceUsage {
+	usage := make(map[int]*ResourceUsage)
+	for _, proc := range a.procsSnapshot() {
+		proc.procMtx.RLock()
+		if proc.usage != nil {
+			usage[proc.Num] = proc.usage
+		}
+		proc.procMtx.RUnlock()
+	}
+	return usage
+}
+
+// Starts sampling the resource usage of the running processes, unless it's
+// been started already
+func (a *App) startSampling() {
+	a.sampleOnce.Do(func() {
+		go a.sampleUsage()
+	})
+}
+
+// Samples the resource usage of the running processes, reading /proc once
+// for all of them each sample
+func (a *App) sampleUsage() {
+	ticker := time.NewTicker(usageSampleInterval)
+	defer ticker.Stop()
+	// The previous sample of each process group, used to get the CPU usage
+	var last map[int]procStats
+	for range ticker.C {
+		// The running processes by their process group id (their pid)
+		running := make(map[int]*Process)
+		for _, proc := range a.procsSnapshot() {
+			proc.procMtx.RLock()
+			if isRunningStatus(proc.status.Load()) &&
+				proc.cmd != nil && proc.cmd.Process != nil {
+				running[proc.cmd.Process.Pid] = proc
+			}
+			proc.procMtx.RUnlock()
+		}
+		if len(running) == 0 {
+			last = nil
+			continue
+		}
+		groups, err := readProcStats()
+		if err != nil {
+			continue
+		}
+		for pid, proc := range running {
+			stats, ok := groups[pid]
+			if !ok {
+				continue
+			}
+			usage := &ResourceUsage{
+				RSS:   stats.rss,
+				FDs:   stats.fds,
+				Procs: stats.procs,
+				Time:  stats.time,
+			}
+			if prev, ok := last[pid]; ok {
+				elapsed := stats.time.Sub(prev.time).Seconds()
+				if cpu := (stats.cpu - prev.cpu).Seconds(); cpu > 0 && elapsed > 0 {
+					usage.CPUPercent = 100 * cpu / elapsed
+				}
+			}
+			proc.procMtx.Lock()
+			// Not stored if the run exited while sampling
+			if isRunningStatus(proc.status.Load()) &&
+				proc.cmd.Process != nil && proc.cmd.Process.Pid == pid {
+				proc.usage = usage
+			}
+			proc.procMtx.Unlock()
+		}
+		last = groups
+	}
+}
+
+// Totals of the processes in a process group at a point in time
+type procStats struct {
+	// Total CPU time used
+	cpu   time.Duration
+	rss   int64
+	fds   int
+	procs int
+	time  time.Time
+}
+
+// Formats a size in bytes (e.g., "12.3M")
+func formatSize(n int64) string {
+	const units = "KMGT"
+	if n < 1024 {
+		return fmt.Sprintf("%dB", n)
+	}
+	f, i := float64(n)/1024, 0
+	for f >= 1024 && i < len(units)-1 {
+		f /= 1024
+		i++
+	}
+	return fmt.Sprintf("%.1f%c", f, units[i])
+}
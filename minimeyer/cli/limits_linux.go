@@ -0,0 +1,106 @@
+//go:build linux
+
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const limitsSupported = true
+
+// Clock ticks per second used by /proc/[pid]/stat (USER_HZ), which is 100 on
+// practically all Linux systems
+const clockTicks = 100
+
+// Sets the process's resource limits and nice value on the current process
+// (the child-exec command, before it execs the program)
+func (p *Process) applyLimits() error {
+	setLimit := func(resource int, value uint64) error {
+		lim := &unix.Rlimit{Cur: value, Max: value}
+		return unix.Setrlimit(resource, lim)
+	}
+	if p.LimitNofile != 0 {
+		if err := setLimit(unix.RLIMIT_NOFILE, p.LimitNofile); err != nil {
+			return fmt.Errorf("error setting open files limit: %v", err)
+		}
+	}
+	if p.LimitAS != "" {
+		size, err := parseSize(p.LimitAS)
+		if err != nil {
+			return err
+		}
+		if err := setLimit(unix.RLIMIT_AS, uint64(size)); err != nil {
+			return fmt.Errorf("error setting address space limit: %v", err)
+		}
+	}
+	if p.LimitCPU != 0 {
+		secs := uint64(p.LimitCPU)
+		if err := setLimit(unix.RLIMIT_CPU, secs); err != nil {
+			return fmt.Errorf("error setting CPU time limit: %v", err)
+		}
+	}
+	if p.Nice != 0 {
+		if err := unix.Setpriority(unix.PRIO_PROCESS, 0, p.Nice); err != nil {
+			return fmt.Errorf("error setting nice: %v", err)
+		}
+	}
+	return nil
+}
+
+// Reads the totals of the processes in each process group from /proc, keyed
+// by the process group id
+func readProcStats() (map[int]procStats, error) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	groups := make(map[int]procStats)
+	pageSize := int64(os.Getpagesize())
+	for _, entry := range entries {
+		if _, err := strconv.Atoi(entry.Name()); err != nil {
+			continue
+		}
+		dir := filepath.Join("/proc", entry.Name())
+		data, err := os.ReadFile(filepath.Join(dir, "stat"))
+		if err != nil {
+			// The process may have exited
+			continue
+		}
+		// The command (field 2) is in parentheses and may contain spaces, so
+		// the fields are split after it
+		i := strings.LastIndexByte(string(data), ')')
+		if i == -1 {
+			continue
+		}
+		// Fields starting at field 3 (state)
+		fields := strings.Fields(string(data[i+1:]))
+		if len(fields) < 22 {
+			continue
+		}
+		pgrp, err := strconv.Atoi(fields[2])
+		if err != nil {
+			continue
+		}
+		stats := groups[pgrp]
+		stats.time = now
+		utime, _ := strconv.ParseInt(fields[11], 10, 64)
+		stime, _ := strconv.ParseInt(fields[12], 10, 64)
+		rss, _ := strconv.ParseInt(fields[21], 10, 64)
+		stats.cpu += time.Duration(utime+stime) * time.Second / clockTicks
+		stats.rss += rss * pageSize
+		stats.procs++
+		if fds, err := os.ReadDir(filepath.Join(dir, "fd")); err == nil {
+			stats.fds += len(fds)
+		}
+		groups[pgrp] = stats
+	}
+	return groups, nil
+}
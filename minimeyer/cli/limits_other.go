@@ -0,0 +1,17 @@
+//go:build !linux
+
+package cli
+
+import "fmt"
+
+const limitsSupported = false
+
+// Resource limits aren't supported on this OS
+func (p *Process) applyLimits() error {
+	return nil
+}
+
+// Usage sampling isn't supported on this OS
+func readProcStats() (map[int]procStats, error) {
+	return nil, fmt.Errorf("usage sampling not supported")
+}
@@ -0,0 +1,200 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// Default number of lines kept for each process
+	defaultLogLines = 1000
+	// Lines longer than this are split
+	maxLogLineLen = 64 * 1024
+	// Number of lines buffered for each subscriber before lines are dropped
+	logSubBufLen = 256
+	// Time to keep reading a process's output after it exits. The output
+	// pipes stay open while children it left running hold them, so waiting
+	// for them to close could take forever.
+	outputWaitDelay = time.Second * 2
+)
+
+// Output streams
+const (
+	streamStdout = "stdout"
+	streamStderr = "stderr"
+	// Output of a process's pre-restart command
+	streamBuild = "build"
+)
+
+// A line of output from a process
+type LogLine struct {
+	// Sequence number of the line (starting at 1) for the process
+	Seq    uint64    `json:"seq"`
+	Time   time.Time `json:"time"`
+	Stream string    `json:"stream"`
+	Line   string    `json:"line"`
+}
+
+func (l LogLine) String() string {
+	return fmt.Sprintf(
+		"%s [%s] %s", l.Time.Format("15:04:05.000"), l.Stream, l.Line,
+	)
+}
+
+// A ring buffer of the most recent lines of output from a process
+type LogBuffer struct {
+	lines []LogLine
+	// Index the next line is put at
+	next int
+	full bool
+	seq  uint64
+	subs map[chan LogLine]struct{}
+	mtx  sync.Mutex
+}
+
+// Creates a new log buffer holding up to size lines (or the default if size
+// is <= 0)
+func NewLogBuffer(size int) *LogBuffer {
+	if size <= 0 {
+		size = defaultLogLines
+	}
+	return &LogBuffer{
+		lines: make([]LogLine, size),
+		subs:  make(map[chan LogLine]struct{}),
+	}
+}
+
+// Adds a line to the buffer and sends it to all subscribers
+func (b *LogBuffer) Add(stream, line string) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	b.seq++
+	l := LogLine{Seq: b.seq, Time: time.Now(), Stream: stream, Line: line}
+	b.lines[b.next] = l
+	if b.next++; b.next == len(b.lines) {
+		b.next, b.full = 0, true
+	}
+	for ch := range b.subs {
+		select {
+		case ch <- l:
+		default:
+			// Drop the line rather than blocking the process's output
+		}
+	}
+}
+
+// Returns the last n lines, or all lines if n <= 0
+func (b *LogBuffer) Tail(n int) []LogLine {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	return b.tail(n)
+}
+
+func (b *LogBuffer) tail(n int) []LogLine {
+	l := b.next
+	if b.full {
+		l = len(b.lines)
+	}
+	if n <= 0 || n > l {
+		n = l
+	}
+	lines := make([]LogLine, 0, n)
+	start := b.next - n
+	if start < 0 {
+		lines = append(lines, b.lines[len(b.lines)+start:]...)
+		start = 0
+	}
+	return append(lines, b.lines[start:b.next]...)
+}
+
+// Returns the last n lines (all if n <= 0) along with a channel that receives
+// every line added afterwards. The returned func must be called to
+// unsubscribe, after which the channel is closed.
+func (b *LogBuffer) Subscribe(n int) ([]LogLine, <-chan LogLine, func()) {
+	ch := make(chan LogLine, logSubBufLen)
+	b.mtx.Lock()
+	lines := b.tail(n)
+	b.subs[ch] = struct{}{}
+	b.mtx.Unlock()
+	var once sync.Once
+	return lines, ch, func() {
+		once.Do(func() {
+			b.mtx.Lock()
+			delete(b.subs, ch)
+			b.mtx.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// Returns the process's log buffer
+func (p *Process) logBuffer() *LogBuffer {
+	p.procMtx.Lock()
+	defer p.procMtx.Unlock()
+	if p.logs == nil {
+		p.logs = NewLogBuffer(p.LogLines)
+	}
+	return p.logs
+}
+
+// Splits output written to it into lines that are added to a log buffer
+type logWriter struct {
+	buf     *LogBuffer
+	stream  string
+	partial []byte
+	mtx     sync.Mutex
+	// Total number of bytes written is added to this (unless nil)
+	written *atomic.Uint64
+	// Called with each line (unless nil)
+	onLine func(stream, line string)
+}
+
+func newLogWriter(
+	buf *LogBuffer, stream string, written *atomic.Uint64,
+) *logWriter {
+	return &logWriter{buf: buf, stream: stream, written: written}
+}
+
+func (w *logWriter) Write(p []byte) (int, error) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	n := len(p)
+	if w.written != nil {
+		w.written.Add(uint64(n))
+	}
+	for len(p) != 0 {
+		i := bytes.IndexByte(p, '\n')
+		if i == -1 {
+			w.partial = append(w.partial, p...)
+			if len(w.partial) >= maxLogLineLen {
+				w.addPartial()
+			}
+			break
+		}
+		w.partial = append(w.partial, p[:i]...)
+		w.addPartial()
+		p = p[i+1:]
+	}
+	return n, nil
+}
+
+// Adds any incomplete last line to the buffer
+func (w *logWriter) Flush() {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	if len(w.partial) != 0 {
+		w.addPartial()
+	}
+}
+
+func (w *logWriter) addPartial() {
+	line := string(bytes.TrimSuffix(w.partial, []byte{'\r'}))
+	w.buf.Add(w.stream, line)
+	w.partial = w.partial[:0]
+	if w.onLine != nil {
+		w.onLine(w.stream, line)
+	}
+}
@@ -0,0 +1,190 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// When minimeyer was started
+	managerStart = time.Now()
+
+	// Number of open websocket and control socket connections
+	wsConns, ctlConns atomic.Int64
+	// Total number of websocket connections (ctlConnNum counts the control
+	// socket connections)
+	wsConnsTotal atomic.Uint64
+)
+
+// A metric and its samples, written in the Prometheus text format
+type metricFamily struct {
+	name, typ, help string
+	samples         []metricSample
+}
+
+type metricSample struct {
+	// Labels in the form name="value",... (may be empty)
+	labels string
+	value  float64
+}
+
+func (f *metricFamily) add(labels string, value float64) {
+	f.samples = append(f.samples, metricSample{labels: labels, value: value})
+}
+
+func (f *metricFamily) writeTo(buf *bytes.Buffer) {
+	fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, f.typ)
+	for _, s := range f.samples {
+		buf.WriteString(f.name)
+		if s.labels != "" {
+			buf.WriteString("{" + s.labels + "}")
+		}
+		buf.WriteString(" " + strconv.FormatFloat(s.value, 'g', -1, 64) + "\n")
+	}
+}
+
+// Escapes a label value for the Prometheus text format
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func procLabels(p *Process) string {
+	return fmt.Sprintf(
+		`name="%s",num="%d",group="%s"`,
+		labelEscaper.Replace(p.Name), p.Num, labelEscaper.Replace(p.ProcGroup),
+	)
+}
+
+// Serves the metrics of minimeyer and the processes in the Prometheus text
+// format
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var buf bytes.Buffer
+	for _, f := range app.metrics() {
+		f.writeTo(&buf)
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(buf.Bytes())
+}
+
+// Returns the current metrics of minimeyer and the processes
+func (a *App) metrics() []*metricFamily {
+	var (
+		up = &metricFamily{
+			name: "minimeyer_process_up", typ: "gauge",
+			help: "Whether the process is running (1) or not (0).",
+		}
+		uptime = &metricFamily{
+			name: "minimeyer_process_uptime_seconds", typ: "gauge",
+			help: "Seconds since the process was started (0 if not running).",
+		}
+		restarts = &metricFamily{
+			name: "minimeyer_process_restarts_total", typ: "counter",
+			help: "Number of times the process was restarted automatically.",
+		}
+		exitCode = &metricFamily{
+			name: "minimeyer_process_last_exit_code", typ: "gauge",
+			help: "Exit code of the last run of the process (-1 if killed by a signal).",
+		}
+		outBytes = &metricFamily{
+			name: "minimeyer_process_output_bytes_total", typ: "counter",
+			help: "Bytes of output written by the process.",
+		}
+		healthy = &metricFamily{
+			name: "minimeyer_process_healthy", typ: "gauge",
+			help: "Whether the process is passing (1) or failing (0) its health checks.",
+		}
+		healthFailures = &metricFamily{
+			name: "minimeyer_process_health_check_failures_total", typ: "counter",
+			help: "Number of failed health checks of the process.",
+		}
+		lastHealthCheck = &metricFamily{
+			name: "minimeyer_process_last_health_check_timestamp_seconds",
+			typ:  "gauge",
+			help: "Unix time of the last health check of the process.",
+		}
+		cpu = &metricFamily{
+			name: "minimeyer_process_cpu_percent", typ: "gauge",
+			help: "Sampled CPU usage of the process (and its children).",
+		}
+		rss = &metricFamily{
+			name: "minimeyer_process_resident_memory_bytes", typ: "gauge",
+			help: "Sampled resident memory of the process (and its children).",
+		}
+	)
+	procs := a.procsSnapshot()
+	now := time.Now()
+	for _, p := range procs {
+		labels := procLabels(p)
+		status := p.status.Load()
+		p.procMtx.RLock()
+		if isRunningStatus(status) {
+			up.add(labels, 1)
+			uptime.add(labels, now.Sub(p.startedAt).Seconds())
+		} else {
+			up.add(labels, 0)
+			uptime.add(labels, 0)
+		}
+		restarts.add(labels, float64(p.restarts))
+		if p.exitCode != nil {
+			exitCode.add(labels, float64(*p.exitCode))
+		}
+		outBytes.add(labels+`,stream="stdout"`, float64(p.outBytes.Load()))
+		outBytes.add(labels+`,stream="stderr"`, float64(p.errBytes.Load()))
+		if p.Readiness != nil || p.Liveness != nil {
+			switch status {
+			case statusHealthy:
+				healthy.add(labels, 1)
+			case statusUnhealthy:
+				healthy.add(labels, 0)
+			}
+			healthFailures.add(labels, float64(p.healthFailures))
+			if !p.lastHealthCheck.IsZero() {
+				lastHealthCheck.add(
+					labels, float64(p.lastHealthCheck.UnixMilli())/1000,
+				)
+			}
+		}
+		if p.usage != nil {
+			cpu.add(labels, p.usage.CPUPercent)
+			rss.add(labels, float64(p.usage.RSS))
+		}
+		p.procMtx.RUnlock()
+	}
+
+	procCount := &metricFamily{
+		name: "minimeyer_processes", typ: "gauge",
+		help: "Number of processes managed.",
+	}
+	procCount.add("", float64(len(procs)))
+	start := &metricFamily{
+		name: "minimeyer_start_time_seconds", typ: "gauge",
+		help: "Unix time minimeyer was started.",
+	}
+	start.add("", float64(managerStart.UnixMilli())/1000)
+	conns := &metricFamily{
+		name: "minimeyer_connections", typ: "gauge",
+		help: "Number of open websocket and control socket connections.",
+	}
+	conns.add(`type="websocket"`, float64(wsConns.Load()))
+	conns.add(`type="control"`, float64(ctlConns.Load()))
+	connsTotal := &metricFamily{
+		name: "minimeyer_connections_total", typ: "counter",
+		help: "Number of websocket and control socket connections made.",
+	}
+	connsTotal.add(`type="websocket"`, float64(wsConnsTotal.Load()))
+	connsTotal.add(`type="control"`, float64(ctlConnNum.Load()))
+
+	return []*metricFamily{
+		procCount, start, conns, connsTotal,
+		up, uptime, restarts, exitCode, outBytes,
+		healthy, healthFailures, lastHealthCheck, cpu, rss,
+	}
+}
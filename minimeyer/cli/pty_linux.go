@@ -0,0 +1,64 @@
+//go:build linux
+
+package cli
+
+import (
+	"os"
+	"strconv"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+const ptySupported = true
+
+// Opens a new pseudo-terminal, returning its master and its slave (the
+// terminal the process is given)
+func openPTY() (master, tty *os.File, err error) {
+	master, err = os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	var n int
+	err = controlFd(master, func(fd int) error {
+		if err := unix.IoctlSetPointerInt(fd, unix.TIOCSPTLCK, 0); err != nil {
+			return err
+		}
+		var err error
+		n, err = unix.IoctlGetInt(fd, unix.TIOCGPTN)
+		return err
+	})
+	if err == nil {
+		tty, err = os.OpenFile(
+			"/dev/pts/"+strconv.Itoa(n), os.O_RDWR|syscall.O_NOCTTY, 0,
+		)
+	}
+	if err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+	return master, tty, nil
+}
+
+// Sets the size of the pseudo-terminal with the given master
+func setPTYSize(master *os.File, rows, cols uint16) error {
+	return controlFd(master, func(fd int) error {
+		return unix.IoctlSetWinsize(
+			fd, unix.TIOCSWINSZ, &unix.Winsize{Row: rows, Col: cols},
+		)
+	})
+}
+
+// Calls fn with the file's descriptor without putting the file in blocking
+// mode (like Fd does)
+func controlFd(f *os.File, fn func(fd int) error) error {
+	conn, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var fnErr error
+	if err := conn.Control(func(fd uintptr) { fnErr = fn(int(fd)) }); err != nil {
+		return err
+	}
+	return fnErr
+}
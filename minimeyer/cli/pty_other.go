@@ -0,0 +1,19 @@
+//go:build !linux
+
+package cli
+
+import (
+	"fmt"
+	"os"
+)
+
+const ptySupported = false
+
+// Pseudo-terminals aren't supported on this OS
+func openPTY() (master, tty *os.File, err error) {
+	return nil, nil, fmt.Errorf("pseudo-terminals not supported")
+}
+
+func setPTYSize(master *os.File, rows, cols uint16) error {
+	return fmt.Errorf("pseudo-terminals not supported")
+}
@@ -0,0 +1,234 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// The changes needed to bring the app's processes in line with its
+// (reloaded) config file
+type ReloadPlan struct {
+	// Names of the processes that will be added (and started)
+	Add []string `json:"add,omitempty"`
+	// Names of the processes that will be stopped and removed
+	Remove []string `json:"remove,omitempty"`
+	// Names of the processes whose program, args, env, or dir changed, which
+	// will be restarted if they're running
+	Restart []string `json:"restart,omitempty"`
+	// Names of the processes whose other settings changed, which will be
+	// updated without restarting them (taking effect the next time they start)
+	Update []string `json:"update,omitempty"`
+	// True if the plan was only requested and won't be applied
+	DryRun bool `json:"dryRun,omitempty"`
+
+	env     []string
+	add     []*Process
+	remove  []*Process
+	restart []*Process
+	update  []*Process
+	// The processes from the config for those being restarted or updated
+	changes map[*Process]*Process
+}
+
+// Returns true if there's nothing to change
+func (plan *ReloadPlan) Empty() bool {
+	return len(plan.Add) == 0 && len(plan.Remove) == 0 &&
+		len(plan.Restart) == 0 && len(plan.Update) == 0
+}
+
+func (plan *ReloadPlan) String() string {
+	if plan.Empty() {
+		return "No changes"
+	}
+	var sb strings.Builder
+	write := func(what string, names []string) {
+		if len(names) != 0 {
+			fmt.Fprintf(&sb, "%s: %s\n", what, strings.Join(names, ", "))
+		}
+	}
+	write("Add", plan.Add)
+	write("Remove", plan.Remove)
+	write("Restart", plan.Restart)
+	write("Update", plan.Update)
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+// Re-parses the app's config file and compares it with the app's processes
+// (by name) to determine what needs to change. Processes added while running
+// are kept even though they aren't in the config. Changes to the server
+// address, server name, and output directory aren't reloaded.
+func (a *App) PlanReload() (*ReloadPlan, error) {
+	if a.configPath == "" {
+		return nil, fmt.Errorf("no config file to reload")
+	}
+	config, err := loadConfig(a.configPath)
+	if err != nil {
+		return nil, err
+	}
+	plan := &ReloadPlan{
+		env:     append(os.Environ(), config.Env...),
+		changes: make(map[*Process]*Process),
+	}
+	current := procsByName(a.procsSnapshot())
+	inConfig := make(map[string]bool, len(config.Procs))
+	for _, proc := range config.Procs {
+		inConfig[proc.Name] = true
+		cur := current[proc.Name]
+		if cur == nil {
+			plan.Add = append(plan.Add, proc.Name)
+			plan.add = append(plan.add, proc)
+			continue
+		}
+		proc.Env, proc.Num = processEnv(plan.env, proc), cur.Num
+		if cur.commandChanged(proc) {
+			plan.Restart = append(plan.Restart, proc.Name)
+			plan.restart = append(plan.restart, cur)
+			plan.changes[cur] = proc
+		} else if !bytes.Equal(cur.settingsJSON(), proc.settingsJSON()) {
+			plan.Update = append(plan.Update, proc.Name)
+			plan.update = append(plan.update, cur)
+			plan.changes[cur] = proc
+		}
+	}
+	for _, proc := range a.procsSnapshot() {
+		if !inConfig[proc.Name] && !proc.runtime {
+			plan.Remove = append(plan.Remove, proc.Name)
+			plan.remove = append(plan.remove, proc)
+		}
+	}
+	return plan, nil
+}
+
+// Applies the plan: stops and removes the removed processes, restarts the
+// changed processes that are running, updates the other changed processes,
+// and adds and starts the new processes.
+func (a *App) ApplyReload(plan *ReloadPlan) {
+	a.reloadMtx.Lock()
+	defer a.reloadMtx.Unlock()
+
+	a.procsMtx.Lock()
+	a.env = plan.env
+	a.procsMtx.Unlock()
+
+	var toStop, toStart []*Process
+	for _, proc := range plan.restart {
+		if isRunningStatus(proc.status.Load()) {
+			toStop = append(toStop, proc)
+			toStart = append(toStart, proc)
+		}
+	}
+	toStop = append(toStop, plan.remove...)
+	a.stopProcs(toStop, (*Process).stop)
+
+	for _, proc := range plan.remove {
+		a.RemoveProcByNum(proc.Num)
+	}
+	for _, proc := range plan.restart {
+		proc.updateFrom(plan.changes[proc], true)
+	}
+	for _, proc := range plan.update {
+		proc.updateFrom(plan.changes[proc], false)
+	}
+	for _, proc := range plan.add {
+		a.AddProc(proc)
+		toStart = append(toStart, proc)
+	}
+	a.startProcs(toStart)
+	Println("Config reloaded")
+}
+
+// Returns true if the program, args, env (including from the env file), or
+// dir of the process differ from those of the other process (from the
+// config)
+func (p *Process) commandChanged(other *Process) bool {
+	p.procMtx.RLock()
+	defer p.procMtx.RUnlock()
+	return p.Program != other.Program || p.Dir != other.Dir ||
+		!equalStrings(p.Args, other.Args) || !equalStrings(p.Env, other.Env)
+}
+
+// Returns the process's settings (exported fields other than those compared
+// by commandChanged) as JSON, used to check if they changed
+func (p *Process) settingsJSON() []byte {
+	p.procMtx.RLock()
+	defer p.procMtx.RUnlock()
+	b, _ := json.Marshal(struct {
+		*processJSON
+		Program     string   `json:"program,omitempty"`
+		Args        []string `json:"args,omitempty"`
+		Env         []string `json:"env,omitempty"`
+		Dir         string   `json:"dir,omitempty"`
+		OutFilename string   `json:"outFilename"`
+		ErrFilename string   `json:"errFilename"`
+	}{
+		processJSON: (*processJSON)(p),
+		// Compare the output files as they'd be used
+		OutFilename: p.expandFilename(p.OutFilename, streamStdout),
+		ErrFilename: p.expandFilename(p.ErrFilename, streamStderr),
+	})
+	return b
+}
+
+// Updates the process's settings to those of the other process (from the
+// config), including the program, args, env, and dir if cmd is true
+func (p *Process) updateFrom(other *Process, cmd bool) {
+	p.procMtx.Lock()
+	defer p.procMtx.Unlock()
+	if cmd {
+		p.Program, p.Args, p.Env, p.Dir =
+			other.Program, other.Args, other.Env, other.Dir
+	}
+	p.OutFilename, p.ErrFilename = other.OutFilename, other.ErrFilename
+	p.Delay = other.Delay
+	p.DependsOn = other.DependsOn
+	p.ProcGroup, p.Tags = other.ProcGroup, other.Tags
+	p.Restart = other.Restart
+	p.RestartDelay = other.RestartDelay
+	p.RestartMaxDelay = other.RestartMaxDelay
+	p.MaxRetries = other.MaxRetries
+	p.RestartReset = other.RestartReset
+	p.Readiness, p.Liveness = other.Readiness, other.Liveness
+	p.StopSignal, p.StopTimeout = other.StopSignal, other.StopTimeout
+	p.LogLines = other.LogLines
+	p.MaxSize = other.MaxSize
+	p.RotateInterval = other.RotateInterval
+	p.MaxFiles = other.MaxFiles
+	p.Compress = other.Compress
+	p.AppendOutput = other.AppendOutput
+	p.Watch, p.Ignore = other.Watch, other.Ignore
+	p.WatchDebounce, p.WatchRestart = other.WatchDebounce, other.WatchRestart
+	p.PreRestart = other.PreRestart
+	p.User, p.Group, p.Umask = other.User, other.Group, other.Umask
+	p.EnvFile, p.Stdin = other.EnvFile, other.Stdin
+	p.Interactive = other.Interactive
+	p.LimitNofile, p.LimitAS = other.LimitNofile, other.LimitAS
+	p.LimitCPU, p.Nice = other.LimitCPU, other.Nice
+	// Used from the next run
+	p.OnOutput = other.OnOutput
+	if p.Schedule != other.Schedule {
+		p.stopScheduling()
+	}
+	p.Schedule, p.Overlap = other.Schedule, other.Overlap
+	p.RunHistory = other.RunHistory
+	p.startScheduling()
+	if len(p.Watch) == 0 {
+		p.stopWatching()
+	} else {
+		p.startWatching()
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,135 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// Writes the contents to a file in a temporary directory, returning its path
+func writeTempFile(t *testing.T, name, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(contents), 0666); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestPlanReload(t *testing.T) {
+	path := writeTempFile(t, "config.toml", `
+env = ["GLOBAL=1"]
+
+[[proc]]
+name = "same"
+program = "sleep"
+args = ["10"]
+
+[[proc]]
+name = "args"
+program = "sleep"
+args = ["10"]
+
+[[proc]]
+name = "settings"
+program = "sleep"
+args = ["10"]
+
+[[proc]]
+name = "removed"
+program = "sleep"
+args = ["10"]
+`)
+	config, err := loadConfig(path)
+	if err != nil {
+		t.Fatalf("error loading config: %v", err)
+	}
+	app := NewApp()
+	app.configPath = path
+	app.env = append(app.env, config.Env...)
+	for _, proc := range config.Procs {
+		app.AddProc(proc)
+	}
+	app.AddRuntimeProc(&Process{Name: "runtime", Program: "sleep"})
+
+	plan, err := app.PlanReload()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if !plan.Empty() {
+		t.Errorf("expected no changes, got %s", plan)
+	}
+
+	err = os.WriteFile(path, []byte(`
+env = ["GLOBAL=1"]
+
+[[proc]]
+name = "added"
+program = "sleep"
+
+[[proc]]
+name = "same"
+program = "sleep"
+args = ["10"]
+
+[[proc]]
+name = "args"
+program = "sleep"
+args = ["20"]
+
+[[proc]]
+name = "settings"
+program = "sleep"
+args = ["10"]
+restart = "always"
+`), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan, err = app.PlanReload(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := &ReloadPlan{
+		Add:     []string{"added"},
+		Remove:  []string{"removed"},
+		Restart: []string{"args"},
+		Update:  []string{"settings"},
+	}
+	got := &ReloadPlan{
+		Add: plan.Add, Remove: plan.Remove,
+		Restart: plan.Restart, Update: plan.Update,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got plan:\n%s\nwant:\n%s", got, want)
+	}
+	if len(plan.restart) != 1 || plan.restart[0] != app.GetProcByName("args") {
+		t.Errorf("expected the running process to be restarted")
+	} else if args := plan.changes[plan.restart[0]].Args; !equalStrings(args, []string{"20"}) {
+		t.Errorf("got new args %q, want [20]", args)
+	}
+
+	// Changing the global env changes the command of every process
+	err = os.WriteFile(path, []byte(`
+env = ["GLOBAL=2"]
+
+[[proc]]
+name = "same"
+program = "sleep"
+args = ["10"]
+`), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan, err = app.PlanReload(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if !equalStrings(plan.Restart, []string{"same"}) {
+		t.Errorf("got restart %q, want [same]", plan.Restart)
+	}
+
+	if err := os.WriteFile(path, []byte("[[proc]]\nname = \"x\"\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := app.PlanReload(); err == nil {
+		t.Errorf("expected an error for an invalid config")
+	}
+}
@@ -0,0 +1,160 @@
+package cli
+
+import (
+	"fmt"
+	"time"
+)
+
+// Restart policies
+const (
+	restartNever     = "never"
+	restartOnFailure = "on-failure"
+	restartAlways    = "always"
+)
+
+func validRestartPolicy(policy string) bool {
+	switch policy {
+	case "", restartNever, restartOnFailure, restartAlways:
+		return true
+	}
+	return false
+}
+
+// Initial delay between restarts (doubled on each consecutive restart)
+func (p *Process) restartDelay() time.Duration {
+	if p.RestartDelay <= 0 {
+		return time.Second
+	}
+	return time.Second * p.RestartDelay
+}
+
+// Max delay between restarts
+func (p *Process) restartMaxDelay() time.Duration {
+	if p.RestartMaxDelay <= 0 {
+		return time.Minute
+	}
+	return time.Second * p.RestartMaxDelay
+}
+
+// How long a process must run before the consecutive restarts are reset
+func (p *Process) restartReset() time.Duration {
+	if p.RestartReset <= 0 {
+		return time.Minute
+	}
+	return time.Second * p.RestartReset
+}
+
+// Returns the delay before the next restart given the number of consecutive
+// retries so far
+func (p *Process) backoff(retries int) time.Duration {
+	delay, maxDelay := p.restartDelay(), p.restartMaxDelay()
+	for i := 0; i < retries && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+	return delay
+}
+
+// Schedules a restart of the process if the restart policy calls for one.
+// Returns true if a restart was scheduled. Must be called without the proc
+// mutex held.
+func (p *Process) scheduleRestart(exitErr error) bool {
+	switch p.Restart {
+	case restartAlways:
+	case restartOnFailure:
+		if exitErr == nil {
+			return false
+		}
+	default:
+		return false
+	}
+
+	p.procMtx.Lock()
+	if time.Since(p.startedAt) >= p.restartReset() {
+		p.retries = 0
+	}
+	if p.MaxRetries > 0 && p.retries >= p.MaxRetries {
+		p.procMtx.Unlock()
+		Printf(
+			"%s reached max retries (%d), not restarting\n",
+			p.Name, p.MaxRetries,
+		)
+		return false
+	}
+	delay := p.backoff(p.retries)
+	p.retries++
+	p.nextRestart = time.Now().Add(delay)
+	// Keep the app from finishing while waiting to restart
+	p.app.wg.Add(1)
+	var timer *time.Timer
+	timer = time.AfterFunc(delay, func() {
+		defer p.app.wg.Done()
+		p.procMtx.Lock()
+		if p.restartTimer != timer {
+			// Cancelled
+			p.procMtx.Unlock()
+			return
+		}
+		p.restartTimer, p.nextRestart = nil, time.Time{}
+		p.restarts++
+		restarts := p.restarts
+		p.procMtx.Unlock()
+
+		Printf("Restarting %s (restart #%d)\n", p.Name, restarts)
+		if err := p.Start(); err != nil && err != errProcRunning {
+			Printf("Error restarting %s: %v\n", p.Name, err)
+			p.scheduleRestart(err)
+		}
+	})
+	p.restartTimer = timer
+	p.procMtx.Unlock()
+
+	Printf("%s will restart in %s\n", p.Name, delay)
+	notify(NewMessageProc(ActionRefresh, p))
+	return true
+}
+
+// Cancels a pending restart, if any, and resets the consecutive restarts.
+// Returns true if a restart was pending.
+func (p *Process) cancelRestart() bool {
+	p.procMtx.Lock()
+	p.retries = 0
+	cancelled := p.stopRestartTimer()
+	p.procMtx.Unlock()
+	return cancelled
+}
+
+// Stops the restart timer. Must be called with the proc mutex held.
+func (p *Process) stopRestartTimer() bool {
+	timer := p.restartTimer
+	p.restartTimer, p.nextRestart = nil, time.Time{}
+	if timer != nil && timer.Stop() {
+		p.app.wg.Done()
+		return true
+	}
+	return false
+}
+
+// Returns a human readable summary of the restart state, or an empty string if
+// there is nothing to report
+func (p *Process) restartInfo() string {
+	p.procMtx.RLock()
+	defer p.procMtx.RUnlock()
+	info := ""
+	if p.restarts != 0 {
+		info = fmt.Sprintf("restarts: %d", p.restarts)
+	}
+	if !p.nextRestart.IsZero() {
+		if info != "" {
+			info += ", "
+		}
+		info += fmt.Sprintf(
+			"next restart: %s (in %s)",
+			p.nextRestart.Format("15:04:05"),
+			time.Until(p.nextRestart).Round(time.Second),
+		)
+	}
+	return info
+}
@@ -0,0 +1,267 @@
+package cli
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Format of the timestamp appended to the names of rotated files
+const rotateTimeFormat = "20060102-150405.000"
+
+// Options for rotating output files
+type rotateOpts struct {
+	// Max size in bytes before rotating (0 = no limit)
+	maxSize int64
+	// Max time before rotating (0 = no limit)
+	interval time.Duration
+	// Max number of rotated files to keep (0 = keep all)
+	maxFiles int
+	// Compress rotated files with gzip
+	compress bool
+}
+
+// An output file that is rotated once it gets too large or old. Rotated files
+// are named the same as the file with a timestamp appended to them.
+type rotatingFile struct {
+	path   string
+	opts   rotateOpts
+	f      *os.File
+	size   int64
+	opened time.Time
+	mtx    sync.Mutex
+}
+
+// Opens the file at path, truncating it unless appendToFile is true
+func openRotatingFile(
+	path string, appendToFile bool, opts rotateOpts,
+) (*rotatingFile, error) {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if appendToFile {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+	f, err := os.OpenFile(path, flags, 0666)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &rotatingFile{
+		path:   path,
+		opts:   opts,
+		f:      f,
+		size:   info.Size(),
+		opened: time.Now(),
+	}, nil
+}
+
+// Returns the path of the (current) file
+func (r *rotatingFile) Name() string {
+	return r.path
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if r.f == nil {
+		return 0, os.ErrClosed
+	}
+	if r.shouldRotate(len(p)) {
+		if err := r.rotate(); err != nil {
+			Eprintf("Error rotating %s: %v\n", r.path, err)
+			if r.f == nil {
+				return 0, err
+			}
+		}
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *rotatingFile) Close() error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if r.f == nil {
+		return os.ErrClosed
+	}
+	err := r.f.Close()
+	r.f = nil
+	return err
+}
+
+// Must be called with the mutex held
+func (r *rotatingFile) shouldRotate(n int) bool {
+	if r.size == 0 {
+		return false
+	}
+	if r.opts.maxSize > 0 && r.size+int64(n) > r.opts.maxSize {
+		return true
+	}
+	return r.opts.interval > 0 && time.Since(r.opened) >= r.opts.interval
+}
+
+// Must be called with the mutex held
+func (r *rotatingFile) rotate() error {
+	if err := r.f.Close(); err != nil {
+		return err
+	}
+	r.f = nil
+	// Make sure an existing rotated file isn't overwritten
+	var rotated string
+	for t := time.Now(); ; t = t.Add(time.Millisecond) {
+		rotated = r.path + "." + t.Format(rotateTimeFormat)
+		if !fileExists(rotated) && !fileExists(rotated+".gz") {
+			break
+		}
+	}
+	renameErr := os.Rename(r.path, rotated)
+	f, err := os.OpenFile(r.path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	r.f, r.size, r.opened = f, 0, time.Now()
+	if renameErr != nil {
+		return renameErr
+	}
+	// Compressing and pruning don't affect the current file so they are done
+	// in the background
+	go func() {
+		if r.opts.compress {
+			if err := gzipFile(rotated); err != nil {
+				Eprintf("Error compressing %s: %v\n", rotated, err)
+			}
+		}
+		if r.opts.maxFiles > 0 {
+			r.prune()
+		}
+	}()
+	return nil
+}
+
+// Removes the oldest rotated files so that there are at most maxFiles of them
+func (r *rotatingFile) prune() {
+	segments, err := rotatedSegments(r.path)
+	if err != nil {
+		Eprintf("Error listing rotated files of %s: %v\n", r.path, err)
+		return
+	}
+	for len(segments) > r.opts.maxFiles {
+		if err := os.Remove(segments[0]); err != nil {
+			Eprintf("Error removing %s: %v\n", segments[0], err)
+		}
+		segments = segments[1:]
+	}
+}
+
+// Returns the paths of the rotated files of the file at path, oldest first
+func rotatedSegments(path string) ([]string, error) {
+	matches, err := filepath.Glob(escapeGlob(path) + ".*")
+	if err != nil {
+		return nil, err
+	}
+	segments := matches[:0]
+	for _, match := range matches {
+		ts := strings.TrimSuffix(strings.TrimPrefix(match, path+"."), ".gz")
+		if _, err := time.Parse(rotateTimeFormat, ts); err == nil {
+			segments = append(segments, match)
+		}
+	}
+	sort.Strings(segments)
+	return segments, nil
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// Escapes the glob metacharacters in the path
+func escapeGlob(path string) string {
+	var sb strings.Builder
+	for _, c := range path {
+		switch c {
+		case '*', '?', '[', '\\':
+			sb.WriteByte('\\')
+		}
+		sb.WriteRune(c)
+	}
+	return sb.String()
+}
+
+// Compresses the file at path to path.gz, removing the original
+func gzipFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.Create(path + ".gz")
+	if err != nil {
+		return err
+	}
+	gw := gzip.NewWriter(dst)
+	if _, err := io.Copy(gw, src); err != nil {
+		dst.Close()
+		os.Remove(dst.Name())
+		return err
+	}
+	if err := gw.Close(); err != nil {
+		dst.Close()
+		os.Remove(dst.Name())
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// Parses a size such as "512", "100K", "10MB", or "1G" into bytes
+func parseSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	if s == "" {
+		return 0, nil
+	}
+	mult := int64(1)
+	num := strings.TrimSuffix(s, "B")
+	if l := len(num); l != 0 {
+		switch num[l-1] {
+		case 'K':
+			mult = 1 << 10
+		case 'M':
+			mult = 1 << 20
+		case 'G':
+			mult = 1 << 30
+		}
+		if mult != 1 {
+			num = num[:l-1]
+		}
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(num), 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size: %s", s)
+	}
+	return n * mult, nil
+}
+
+// Returns the options for rotating the process's output files
+func (p *Process) rotateOpts() rotateOpts {
+	maxSize, _ := parseSize(p.MaxSize)
+	return rotateOpts{
+		maxSize:  maxSize,
+		interval: time.Second * p.RotateInterval,
+		maxFiles: p.MaxFiles,
+		compress: p.Compress,
+	}
+}
@@ -0,0 +1,121 @@
+package cli
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := map[string]int64{
+		"":       0,
+		"512":    512,
+		"512b":   512,
+		"100K":   100 << 10,
+		"100kb":  100 << 10,
+		"10MB":   10 << 20,
+		" 10 M ": 10 << 20,
+		"1G":     1 << 30,
+	}
+	for s, want := range tests {
+		got, err := parseSize(s)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", s, err)
+		} else if got != want {
+			t.Errorf("%q: got %d, want %d", s, got, want)
+		}
+	}
+	for _, s := range []string{"K", "MB", "ten", "-1", "1T", "1.5M"} {
+		if _, err := parseSize(s); err == nil {
+			t.Errorf("%q: expected an error", s)
+		}
+	}
+}
+
+// Waits for the file to have the given number of rotated files, compressed
+// if compressed (they're compressed and pruned in the background)
+func waitSegments(t *testing.T, path string, n int, compressed bool) []string {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		segments, err := rotatedSegments(path)
+		if err != nil {
+			t.Fatalf("error listing rotated files: %v", err)
+		}
+		done := len(segments) == n
+		for _, segment := range segments {
+			if strings.HasSuffix(segment, ".gz") != compressed {
+				done = false
+			}
+		}
+		if done {
+			return segments
+		} else if time.Now().After(deadline) {
+			t.Fatalf("expected %d rotated files, got %q", n, segments)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRotatingFileSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out[1].log")
+	rf, err := openRotatingFile(path, false, rotateOpts{maxSize: 10, maxFiles: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rf.Close()
+	// Writes that don't fit rotate the file first, unless it's empty
+	writes := []string{"12345", "6789", "0", "a very long line", "b", "c", "0123456789X"}
+	for _, s := range writes {
+		if _, err := io.WriteString(rf, s); err != nil {
+			t.Fatalf("error writing: %v", err)
+		}
+	}
+	// The oldest ("1234567890") is pruned
+	segments := waitSegments(t, path, 2, false)
+	want := []string{"a very long line", "bc", "0123456789X"}
+	for i, file := range append(segments, path) {
+		if b, _ := os.ReadFile(file); string(b) != want[i] {
+			t.Errorf("%s: got %q, want %q", file, b, want[i])
+		}
+	}
+}
+
+func TestRotatingFileCompress(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.log")
+	if err := os.WriteFile(path, []byte("old\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	rf, err := openRotatingFile(
+		path, true, rotateOpts{interval: time.Millisecond, compress: true},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rf.Close()
+	time.Sleep(5 * time.Millisecond)
+	// The appended-to file is old enough to be rotated
+	if _, err := io.WriteString(rf, "new\n"); err != nil {
+		t.Fatal(err)
+	}
+	segments := waitSegments(t, path, 1, true)
+	f, err := os.Open(segments[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, err := io.ReadAll(gr); err != nil || string(b) != "old\n" {
+		t.Errorf("rotated file: got %q (error: %v), want %q", b, err, "old\n")
+	}
+	if b, _ := os.ReadFile(path); string(b) != "new\n" {
+		t.Errorf("current file: got %q, want %q", b, "new\n")
+	}
+}
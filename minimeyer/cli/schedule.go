@@ -0,0 +1,377 @@
+package cli
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Default number of runs kept in the run history of a scheduled process
+const defaultRunHistory = 20
+
+// What is done when a scheduled run is due while the previous run is still
+// running
+const (
+	// Don't start the new run
+	overlapSkip = "skip"
+	// Start the new run once the previous one exits (at most one run is
+	// queued)
+	overlapQueue = "queue"
+	// Kill the previous run and start the new one
+	overlapKill = "kill"
+)
+
+// Returns true if the overlap policy is valid
+func validOverlap(policy string) bool {
+	switch policy {
+	case "", overlapSkip, overlapQueue, overlapKill:
+		return true
+	}
+	return false
+}
+
+// A single run of a scheduled process
+type JobRun struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	// Duration of the run in seconds
+	Duration float64 `json:"duration"`
+	// Exit code of the process (-1 if it was killed by a signal)
+	ExitCode int `json:"exitCode"`
+	// Error waiting for the process, if any
+	Error string `json:"error,omitempty"`
+	// Whether the run was started by the schedule (as opposed to manually)
+	Scheduled bool `json:"scheduled"`
+}
+
+func (r JobRun) String() string {
+	s := fmt.Sprintf(
+		"%s (%s): exit code %d",
+		r.Start.Format("2006-01-02 15:04:05"),
+		time.Duration(r.Duration*float64(time.Second)).Round(time.Millisecond),
+		r.ExitCode,
+	)
+	if !r.Scheduled {
+		s += " (manual)"
+	}
+	return s
+}
+
+// A parsed schedule: either a cron expression (minute, hour, day of month,
+// month, and day of week) or a fixed interval (@every)
+type cronSchedule struct {
+	// Bit sets of the allowed values of each field
+	minute, hour, dom, month, dow uint64
+	// Whether the day of month or day of week fields are "*". If neither is,
+	// a day matches if either field matches (like cron).
+	domStar, dowStar bool
+	// Interval between runs for @every schedules
+	every time.Duration
+}
+
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var (
+	monthNames = []string{
+		"jan", "feb", "mar", "apr", "may", "jun",
+		"jul", "aug", "sep", "oct", "nov", "dec",
+	}
+	dayNames = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+)
+
+// Parses a schedule: a standard 5-field cron expression (e.g., "*/15 * * * *"),
+// one of the descriptors (e.g., "@daily"), or "@every" followed by a duration
+// (e.g., "@every 10m")
+func parseSchedule(spec string) (*cronSchedule, error) {
+	spec = strings.TrimSpace(spec)
+	if rest := strings.TrimPrefix(spec, "@every "); rest != spec {
+		every, err := time.ParseDuration(strings.TrimSpace(rest))
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule: %s", spec)
+		} else if every < time.Second {
+			return nil, fmt.Errorf("invalid schedule: interval must be at least 1s")
+		}
+		return &cronSchedule{every: every}, nil
+	}
+	if expr, ok := cronDescriptors[strings.ToLower(spec)]; ok {
+		spec = expr
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf(
+			"invalid schedule: expected 5 fields, got %d: %s", len(fields), spec,
+		)
+	}
+	s := &cronSchedule{
+		domStar: fields[2] == "*" || strings.HasPrefix(fields[2], "*/"),
+		dowStar: fields[4] == "*" || strings.HasPrefix(fields[4], "*/"),
+	}
+	var err error
+	if s.minute, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+		return nil, fmt.Errorf("invalid schedule minute: %v", err)
+	}
+	if s.hour, err = parseCronField(fields[1], 0, 23, nil); err != nil {
+		return nil, fmt.Errorf("invalid schedule hour: %v", err)
+	}
+	if s.dom, err = parseCronField(fields[2], 1, 31, nil); err != nil {
+		return nil, fmt.Errorf("invalid schedule day of month: %v", err)
+	}
+	if s.month, err = parseCronField(fields[3], 1, 12, monthNames); err != nil {
+		return nil, fmt.Errorf("invalid schedule month: %v", err)
+	}
+	// 7 is also Sunday
+	if s.dow, err = parseCronField(fields[4], 0, 7, dayNames); err != nil {
+		return nil, fmt.Errorf("invalid schedule day of week: %v", err)
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	if s.next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("invalid schedule: never runs: %s", spec)
+	}
+	return s, nil
+}
+
+// Parses a comma-separated list of values, ranges (a-b), and steps (*/n or
+// a-b/n) into a bit set. Names, if given, are the names of the values
+// starting at min (e.g., "jan" for 1).
+func parseCronField(field string, min, max int, names []string) (uint64, error) {
+	parseValue := func(s string) (int, error) {
+		for i, name := range names {
+			if strings.EqualFold(s, name) {
+				return min + i, nil
+			}
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n < min || n > max {
+			return 0, fmt.Errorf("invalid value: %s", s)
+		}
+		return n, nil
+	}
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, stepStr, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepStr); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step: %s", part)
+			}
+		}
+		start, end := min, max
+		if rng != "*" {
+			lo, hi, isRange := strings.Cut(rng, "-")
+			var err error
+			if start, err = parseValue(lo); err != nil {
+				return 0, err
+			}
+			end = start
+			if isRange {
+				if end, err = parseValue(hi); err != nil {
+					return 0, err
+				} else if end < start {
+					return 0, fmt.Errorf("invalid range: %s", rng)
+				}
+			} else if hasStep {
+				// "a/n" means starting at a
+				end = max
+			}
+		}
+		for i := start; i <= end; i += step {
+			bits |= 1 << uint(i)
+		}
+	}
+	return bits, nil
+}
+
+// Returns the first time after t that the schedule is due
+func (s *cronSchedule) next(t time.Time) time.Time {
+	if s.every != 0 {
+		return t.Add(s.every)
+	}
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	// Give up if no time matches in the next 5 years (e.g., "0 0 30 2 *")
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			// Not t.Truncate, which truncates to UTC hours (which aren't
+			// local hours in zones with half-hour offsets)
+			t = time.Date(
+				t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location(),
+			)
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+// Number of runs kept in the process's run history
+func (p *Process) runHistory() int {
+	if p.RunHistory <= 0 {
+		return defaultRunHistory
+	}
+	return p.RunHistory
+}
+
+// Starts running the process on its schedule, if it has one and isn't
+// scheduled already. Must be called with the proc mutex held.
+func (p *Process) startScheduling() {
+	if p.Schedule == "" || p.scheduleStop != nil {
+		return
+	}
+	sched, err := parseSchedule(p.Schedule)
+	if err != nil {
+		Printf("Error scheduling %s: %v\n", p.Name, err)
+		return
+	}
+	p.scheduleStop = make(chan struct{})
+	go p.runSchedule(sched, p.scheduleStop)
+}
+
+// Stops running the process on its schedule. Must be called with the proc
+// mutex held.
+func (p *Process) stopScheduling() {
+	if p.scheduleStop != nil {
+		close(p.scheduleStop)
+		p.scheduleStop = nil
+	}
+	p.nextRun, p.queued = time.Time{}, false
+}
+
+// Runs the process each time the schedule is due until stop is closed
+func (p *Process) runSchedule(sched *cronSchedule, stop chan struct{}) {
+	for {
+		next := sched.next(time.Now())
+		p.procMtx.Lock()
+		p.nextRun = next
+		p.procMtx.Unlock()
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		p.runScheduled()
+	}
+}
+
+// Starts a scheduled run of the process, handling a previous run that is
+// still running according to the overlap policy
+func (p *Process) runScheduled() {
+	p.procMtx.Lock()
+	if !isRunningStatus(p.status.Load()) {
+		p.scheduledRun = true
+		p.procMtx.Unlock()
+		Printf("Starting scheduled run of %s\n", p.Name)
+		if err := p.Start(); err != nil && err != errProcRunning {
+			Printf("Error starting scheduled run of %s: %v\n", p.Name, err)
+			p.procMtx.Lock()
+			p.scheduledRun = false
+			p.procMtx.Unlock()
+		}
+		return
+	}
+	overlap := p.Overlap
+	if overlap == overlapQueue {
+		p.queued = true
+	}
+	p.procMtx.Unlock()
+
+	switch overlap {
+	case overlapQueue:
+		Printf("%s is still running, queueing scheduled run\n", p.Name)
+	case overlapKill:
+		Printf("%s is still running, killing it for scheduled run\n", p.Name)
+		if err := p.kill(); err != nil {
+			Printf("Error killing %s: %v\n", p.Name, err)
+		}
+		p.waitExit()
+		p.runScheduled()
+	default:
+		Printf("%s is still running, skipping scheduled run\n", p.Name)
+	}
+}
+
+// Records the run of a scheduled process that just exited and starts a
+// queued run, if any. Must be called without the proc mutex held.
+func (p *Process) finishRun(waitErr error) {
+	p.procMtx.Lock()
+	if p.Schedule == "" {
+		p.procMtx.Unlock()
+		return
+	}
+	now := time.Now()
+	run := JobRun{
+		Start:     p.startedAt,
+		End:       now,
+		Duration:  now.Sub(p.startedAt).Seconds(),
+		ExitCode:  p.cmd.ProcessState.ExitCode(),
+		Scheduled: p.scheduledRun,
+	}
+	if waitErr != nil && run.ExitCode == 0 {
+		run.Error = waitErr.Error()
+	}
+	p.runs = append(p.runs, run)
+	if extra := len(p.runs) - p.runHistory(); extra > 0 {
+		p.runs = append(p.runs[:0], p.runs[extra:]...)
+	}
+	p.scheduledRun = false
+	queued := p.queued && p.scheduleStop != nil
+	p.queued = false
+	p.procMtx.Unlock()
+
+	notify(Message{
+		Action:  ActionRuns,
+		Content: RunsContent{Num: p.Num, Runs: []JobRun{run}},
+	})
+	if queued {
+		go p.runScheduled()
+	}
+}
+
+// Returns a copy of the process's run history, oldest first
+func (p *Process) Runs() []JobRun {
+	p.procMtx.RLock()
+	defer p.procMtx.RUnlock()
+	runs := make([]JobRun, len(p.runs))
+	copy(runs, p.runs)
+	return runs
+}
+
+// Content of ActionRuns messages
+type RunsContent struct {
+	Num  int      `json:"num"`
+	Runs []JobRun `json:"runs"`
+}
@@ -0,0 +1,137 @@
+package cli
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCronField(t *testing.T) {
+	bits := func(values ...int) uint64 {
+		var b uint64
+		for _, v := range values {
+			b |= 1 << uint(v)
+		}
+		return b
+	}
+	tests := []struct {
+		field    string
+		min, max int
+		names    []string
+		want     uint64
+	}{
+		{"*", 0, 5, nil, bits(0, 1, 2, 3, 4, 5)},
+		{"3", 0, 59, nil, bits(3)},
+		{"1,3,5", 0, 59, nil, bits(1, 3, 5)},
+		{"10-13", 0, 59, nil, bits(10, 11, 12, 13)},
+		{"*/15", 0, 59, nil, bits(0, 15, 30, 45)},
+		{"10-30/10", 0, 59, nil, bits(10, 20, 30)},
+		{"50/5", 0, 59, nil, bits(50, 55)},
+		{"jan,MAR-may", 1, 12, monthNames, bits(1, 3, 4, 5)},
+		{"mon-fri", 0, 7, dayNames, bits(1, 2, 3, 4, 5)},
+	}
+	for _, test := range tests {
+		got, err := parseCronField(test.field, test.min, test.max, test.names)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.field, err)
+		} else if got != test.want {
+			t.Errorf("%s: got %b, want %b", test.field, got, test.want)
+		}
+	}
+
+	for _, field := range []string{"", "60", "-1", "5-3", "*/0", "*/x", "a", "1-"} {
+		if _, err := parseCronField(field, 0, 59, nil); err == nil {
+			t.Errorf("%q: expected an error", field)
+		}
+	}
+}
+
+func TestParseScheduleErrors(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"0 0 30 2 *",
+		"@every",
+		"@every 10",
+		"@every 500ms",
+		"@often",
+	} {
+		if _, err := parseSchedule(spec); err == nil {
+			t.Errorf("%q: expected an error", spec)
+		}
+	}
+}
+
+func TestScheduleNext(t *testing.T) {
+	date := func(s string) time.Time {
+		t.Helper()
+		tm, err := time.Parse("2006-01-02 15:04:05", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tm
+	}
+	tests := []struct {
+		spec, from, want string
+	}{
+		{"* * * * *", "2024-03-10 12:00:30", "2024-03-10 12:01:00"},
+		{"* * * * *", "2024-03-10 12:00:00", "2024-03-10 12:01:00"},
+		{"*/15 * * * *", "2024-03-10 12:16:00", "2024-03-10 12:30:00"},
+		{"0 * * * *", "2024-03-10 23:59:00", "2024-03-11 00:00:00"},
+		{"30 9 * * mon-fri", "2024-03-08 10:00:00", "2024-03-11 09:30:00"},
+		{"0 0 * * 7", "2024-03-10 00:00:00", "2024-03-17 00:00:00"},
+		{"@daily", "2024-12-31 12:00:00", "2025-01-01 00:00:00"},
+		{"@monthly", "2024-01-31 00:00:00", "2024-02-01 00:00:00"},
+		{"0 12 29 2 *", "2024-03-01 00:00:00", "2028-02-29 12:00:00"},
+		{"0 0 31 * *", "2024-04-01 00:00:00", "2024-05-31 00:00:00"},
+		// Either the day of month or the day of week matches if neither is *
+		{"0 0 13 * fri", "2024-09-01 00:00:00", "2024-09-06 00:00:00"},
+		{"0 0 13 * fri", "2024-09-07 00:00:00", "2024-09-13 00:00:00"},
+		// Both must match if either is a step of *
+		{"0 0 */2 * mon", "2024-09-01 00:00:00", "2024-09-09 00:00:00"},
+		{"@every 90s", "2024-03-10 12:00:30", "2024-03-10 12:02:00"},
+	}
+	for _, test := range tests {
+		sched, err := parseSchedule(test.spec)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.spec, err)
+			continue
+		}
+		got := sched.next(date(test.from))
+		if want := date(test.want); !got.Equal(want) {
+			t.Errorf(
+				"%s: next after %s: got %s, want %s",
+				test.spec, test.from, got.Format(time.DateTime), test.want,
+			)
+		}
+	}
+}
+
+func TestScheduleNextOffsetZones(t *testing.T) {
+	zones := []*time.Location{
+		// Asia/Kolkata, America/St_Johns, and Asia/Kathmandu
+		time.FixedZone("IST", 5*3600+30*60),
+		time.FixedZone("NST", -(3*3600 + 30*60)),
+		time.FixedZone("NPT", 5*3600+45*60),
+	}
+	defer func(local *time.Location) { time.Local = local }(time.Local)
+	for _, loc := range zones {
+		// Schedules are checked to run from now (in the local time zone)
+		time.Local = loc
+		sched, err := parseSchedule("0 9 * * *")
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", loc, err)
+			continue
+		}
+		from := time.Date(2024, 3, 10, 8, 10, 0, 0, loc)
+		want := time.Date(2024, 3, 10, 9, 0, 0, 0, loc)
+		if got := sched.next(from); !got.Equal(want) {
+			t.Errorf("%s: got %s, want %s", loc, got, want)
+		}
+	}
+}
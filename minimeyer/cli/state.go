@@ -0,0 +1,312 @@
+package cli
+
+import (
+	"database/sql"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Creates the state file's tables
+//
+//go:embed state.sql
+var stateSQL string
+
+// Process lifecycle events recorded in the state file
+const (
+	eventAdd         = "add"
+	eventRemove      = "remove"
+	eventStart       = "start"
+	eventStartFailed = "start-failed"
+	eventExit        = "exit"
+	eventTrigger     = "trigger"
+	// Recorded with no process when minimeyer starts and stops
+	eventManagerStart = "manager-start"
+	eventManagerStop  = "manager-stop"
+)
+
+// Default number of events returned from the history
+const defaultHistoryLimit = 50
+
+// A recorded process lifecycle event
+type Event struct {
+	Time time.Time `json:"time"`
+	// Name and number of the process (empty and 0 for manager events)
+	Proc  string `json:"proc"`
+	Num   int    `json:"num"`
+	Event string `json:"event"`
+	// Exit code of the process for exit events
+	ExitCode *int   `json:"exitCode,omitempty"`
+	Detail   string `json:"detail,omitempty"`
+}
+
+func (e Event) String() string {
+	s := e.Time.Format("2006-01-02 15:04:05") + " "
+	if e.Proc != "" {
+		s += fmt.Sprintf("%s (#%d) ", e.Proc, e.Num)
+	}
+	s += e.Event
+	if e.ExitCode != nil {
+		s += fmt.Sprintf(" (exit code %d)", *e.ExitCode)
+	}
+	if e.Detail != "" {
+		s += ": " + e.Detail
+	}
+	return s
+}
+
+// The state file: a SQLite database with the processes added while running
+// and the history of events. Events are written in the background so that
+// recording them never blocks the processes; events are dropped (and
+// counted) if writing them falls too far behind.
+type stateDB struct {
+	db     *sql.DB
+	events chan Event
+	done   chan struct{}
+	// Held (read) while sending events so the channel isn't closed while
+	// sending
+	mtx    sync.RWMutex
+	closed bool
+	// Number of events dropped since the last one written
+	dropped atomic.Uint64
+}
+
+// Opens (creating if necessary) the state file at path
+func openState(path string) (*stateDB, error) {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(stateSQL); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error creating tables: %v", err)
+	}
+	s := &stateDB{
+		db:     db,
+		events: make(chan Event, 256),
+		done:   make(chan struct{}),
+	}
+	go s.writeEvents()
+	return s, nil
+}
+
+func (s *stateDB) writeEvents() {
+	defer close(s.done)
+	for e := range s.events {
+		_, err := s.db.Exec(
+			`INSERT INTO events (time, proc, num, event, exit_code, detail)
+			VALUES (?, ?, ?, ?, ?, ?)`,
+			e.Time.UnixMilli(), e.Proc, e.Num, e.Event, e.ExitCode, e.Detail,
+		)
+		if err != nil {
+			Println("Error recording event:", err)
+		}
+		if n := s.dropped.Swap(0); n != 0 {
+			Printf("Dropped %d events, recording fell behind\n", n)
+		}
+	}
+}
+
+// Records an event. Does nothing if s is nil (no state file).
+func (s *stateDB) record(e Event) {
+	if s == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	if s.closed {
+		return
+	}
+	select {
+	case s.events <- e:
+	default:
+		s.dropped.Add(1)
+	}
+}
+
+// Records an event for the process
+func (p *Process) recordEvent(event string, exitCode *int, detail string) {
+	p.app.state.record(Event{
+		Proc: p.Name, Num: p.Num, Event: event, ExitCode: exitCode, Detail: detail,
+	})
+}
+
+// Saves the definition of a process added while running
+func (s *stateDB) saveProc(p *Process) {
+	if s == nil {
+		return
+	}
+	def, err := json.Marshal((*processJSON)(p))
+	if err == nil {
+		_, err = s.db.Exec(
+			`INSERT OR REPLACE INTO procs (name, definition, added_at)
+			VALUES (?, ?, ?)`,
+			p.Name, string(def), time.Now().UnixMilli(),
+		)
+	}
+	if err != nil {
+		Printf("Error saving process %s: %v\n", p.Name, err)
+	}
+}
+
+// Deletes the saved definition of a process, if any
+func (s *stateDB) deleteProc(name string) {
+	if s == nil {
+		return
+	}
+	if _, err := s.db.Exec(`DELETE FROM procs WHERE name = ?`, name); err != nil {
+		Printf("Error deleting saved process %s: %v\n", name, err)
+	}
+}
+
+// Returns the saved processes added while running, in the order they were
+// added
+func (s *stateDB) loadProcs() ([]*Process, error) {
+	rows, err := s.db.Query(`SELECT definition FROM procs ORDER BY added_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var procs []*Process
+	for rows.Next() {
+		var def string
+		if err := rows.Scan(&def); err != nil {
+			return nil, err
+		}
+		proc := &Process{}
+		if err := json.Unmarshal([]byte(def), proc); err != nil {
+			return nil, fmt.Errorf("invalid saved process: %v", err)
+		}
+		procs = append(procs, proc)
+	}
+	return procs, rows.Err()
+}
+
+// Returns the last limit events (all if limit is 0), oldest first. Only the
+// events of the named process are returned if proc isn't empty.
+func (s *stateDB) history(proc string, limit int) ([]Event, error) {
+	if limit <= 0 {
+		limit = -1
+	}
+	rows, err := s.db.Query(
+		`SELECT time, proc, num, event, exit_code, detail FROM events
+		WHERE ? = '' OR proc = ? ORDER BY id DESC LIMIT ?`,
+		proc, proc, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var events []Event
+	for rows.Next() {
+		var (
+			e        Event
+			millis   int64
+			exitCode sql.NullInt64
+		)
+		err := rows.Scan(&millis, &e.Proc, &e.Num, &e.Event, &exitCode, &e.Detail)
+		if err != nil {
+			return nil, err
+		}
+		e.Time = time.UnixMilli(millis)
+		if exitCode.Valid {
+			code := int(exitCode.Int64)
+			e.ExitCode = &code
+		}
+		events = append(events, e)
+	}
+	// Oldest first
+	for i, j := 0, len(events)-1; i < j; i, j = i+1, j-1 {
+		events[i], events[j] = events[j], events[i]
+	}
+	return events, rows.Err()
+}
+
+// Writes the remaining events and closes the state file
+func (s *stateDB) close() error {
+	if s == nil {
+		return nil
+	}
+	s.mtx.Lock()
+	if s.closed {
+		s.mtx.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.events)
+	s.mtx.Unlock()
+	<-s.done
+	return s.db.Close()
+}
+
+// Opens the state file at path, restoring the processes that were added while
+// running (unless there's already a process with the same name)
+func (a *App) OpenState(path string) error {
+	state, err := openState(path)
+	if err != nil {
+		return fmt.Errorf("error opening state file: %v", err)
+	}
+	a.state = state
+	state.record(Event{Event: eventManagerStart})
+	procs, err := state.loadProcs()
+	if err != nil {
+		return fmt.Errorf("error loading saved processes: %v", err)
+	}
+	for _, proc := range procs {
+		if a.GetProcByName(proc.Name) != nil {
+			Printf("Not restoring process %s: name in use\n", proc.Name)
+			continue
+		} else if err := proc.validate(); err != nil {
+			Printf("Not restoring process: %v\n", err)
+			continue
+		} else if err := a.checkDeps(proc); err != nil {
+			Printf("Not restoring process: %v\n", err)
+			continue
+		}
+		Printf("Restoring process %s\n", proc.Name)
+		proc.runtime = true
+		a.AddProc(proc)
+		proc.recordEvent(eventAdd, nil, "restored")
+	}
+	return nil
+}
+
+// Adds a process while running (as opposed to from the config), saving it to
+// the state file so it's restored when restarted
+func (a *App) AddRuntimeProc(p *Process) {
+	// Saved before adding since the global env is added to the process's env
+	a.state.saveProc(p)
+	p.runtime = true
+	a.AddProc(p)
+	p.recordEvent(eventAdd, nil, "")
+}
+
+// Records that minimeyer is stopping and closes the state file, if any
+func (a *App) CloseState() error {
+	a.state.record(Event{Event: eventManagerStop})
+	return a.state.close()
+}
+
+// Returns the history from the state file
+func (a *App) History(proc string, limit int) ([]Event, error) {
+	if a.state == nil {
+		return nil, fmt.Errorf("no state file")
+	}
+	return a.state.history(proc, limit)
+}
+
+// Content of ActionHistory messages from the client
+type HistoryRequest struct {
+	// Name of the process to get the history of (all if empty)
+	Proc string `json:"proc,omitempty"`
+	// Max number of events (default is 50)
+	Limit int `json:"limit,omitempty"`
+}
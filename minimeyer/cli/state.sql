@@ -0,0 +1,20 @@
+-- Definitions (JSON) of the processes added while running (not from the
+-- config), which are restored when minimeyer is started again
+CREATE TABLE IF NOT EXISTS procs (
+  name TEXT PRIMARY KEY,
+  definition TEXT NOT NULL,
+  added_at INTEGER NOT NULL
+);
+
+-- Timeline of process lifecycle events (times are Unix milliseconds)
+CREATE TABLE IF NOT EXISTS events (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  time INTEGER NOT NULL,
+  proc TEXT NOT NULL,
+  num INTEGER NOT NULL,
+  event TEXT NOT NULL,
+  exit_code INTEGER,
+  detail TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS events_proc_idx ON events (proc, id);
@@ -0,0 +1,119 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Signals that can be used as stop signals
+var stopSignals = map[string]syscall.Signal{
+	"INT":  syscall.SIGINT,
+	"TERM": syscall.SIGTERM,
+	"HUP":  syscall.SIGHUP,
+	"QUIT": syscall.SIGQUIT,
+}
+
+// Parses a stop signal name (e.g., "TERM" or "SIGTERM")
+func parseStopSignal(name string) (syscall.Signal, error) {
+	name = strings.TrimPrefix(strings.ToUpper(name), "SIG")
+	if sig, ok := stopSignals[name]; ok {
+		return sig, nil
+	}
+	return 0, fmt.Errorf("invalid stop signal: %s", name)
+}
+
+// The signal used to gracefully stop the process (default is SIGTERM)
+func (p *Process) stopSignal() syscall.Signal {
+	if sig, err := parseStopSignal(p.StopSignal); err == nil {
+		return sig
+	}
+	return syscall.SIGTERM
+}
+
+// How long to wait for the process to exit after sending the stop signal
+// before killing it
+func (p *Process) stopTimeout() time.Duration {
+	if p.StopTimeout <= 0 {
+		return 10 * time.Second
+	}
+	return time.Second * p.StopTimeout
+}
+
+// Sends the signal to the process's process group so that any children it
+// spawned get the signal as well
+func (p *Process) signal(sig syscall.Signal) error {
+	pid := p.cmd.Process.Pid
+	if err := syscall.Kill(-pid, sig); err != nil {
+		// Fall back to signalling just the process
+		return p.cmd.Process.Signal(sig)
+	}
+	return nil
+}
+
+// Gracefully stops the process by sending it its stop signal and waiting for
+// it to exit, killing it if it hasn't exited after the stop timeout
+func (p *Process) stop() error {
+	return p.stopWith(p.stopSignal(), ActionStop)
+}
+
+// Like stop but interrupts the process rather than sending its stop signal
+func (p *Process) interruptStop() error {
+	return p.stopWith(syscall.SIGINT, ActionInterrupt)
+}
+
+// Sends the signal to the process, notifying clients with the action, and
+// waits for it to exit, killing it if it hasn't exited after the stop
+// timeout
+func (p *Process) stopWith(sig syscall.Signal, action string) error {
+	p.cancelRestart()
+	if !p.markFinished() {
+		return nil
+	}
+	if p.cmd == nil || p.cmd.Process == nil {
+		return nil
+	}
+	err := p.signal(sig)
+	notify(Message{Action: action, Content: p.Num})
+	if err != nil {
+		return err
+	}
+
+	p.procMtx.RLock()
+	exited := p.exited
+	p.procMtx.RUnlock()
+	timeout := p.stopTimeout()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-exited:
+		return nil
+	case <-timer.C:
+	}
+	Printf("%s didn't stop after %s, killing\n", p.Name, timeout)
+	err = p.signal(syscall.SIGKILL)
+	notify(Message{Action: ActionKill, Content: p.Num})
+	return err
+}
+
+// Kills the process if it's still running, even if it's already being stopped
+// (which kill does nothing for). Used to force processes to exit.
+func (p *Process) forceKill() {
+	p.cancelRestart()
+	p.procMtx.RLock()
+	cmd, exited := p.cmd, p.exited
+	p.procMtx.RUnlock()
+	if cmd == nil || cmd.Process == nil || exited == nil {
+		return
+	}
+	select {
+	case <-exited:
+		return
+	default:
+	}
+	if err := p.signal(syscall.SIGKILL); err != nil {
+		Printf("Error killing %s: %v\n", p.Name, err)
+	}
+	notify(Message{Action: ActionKill, Content: p.Num})
+}
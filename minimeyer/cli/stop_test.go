@@ -0,0 +1,113 @@
+package cli
+
+import (
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestParseStopSignal(t *testing.T) {
+	tests := map[string]syscall.Signal{
+		"INT":     syscall.SIGINT,
+		"term":    syscall.SIGTERM,
+		"SIGHUP":  syscall.SIGHUP,
+		"sigquit": syscall.SIGQUIT,
+	}
+	for name, want := range tests {
+		if got, err := parseStopSignal(name); err != nil {
+			t.Errorf("%s: unexpected error: %v", name, err)
+		} else if got != want {
+			t.Errorf("%s: got %v, want %v", name, got, want)
+		}
+	}
+	for _, name := range []string{"", "KILL", "SIGUSR1", "15"} {
+		if _, err := parseStopSignal(name); err == nil {
+			t.Errorf("%q: expected an error", name)
+		}
+	}
+
+	p := &Process{}
+	if sig := p.stopSignal(); sig != syscall.SIGTERM {
+		t.Errorf("expected SIGTERM by default, got %v", sig)
+	}
+	p.StopSignal = "int"
+	if sig := p.stopSignal(); sig != syscall.SIGINT {
+		t.Errorf("expected SIGINT, got %v", sig)
+	}
+	if d := (&Process{}).stopTimeout(); d != 10*time.Second {
+		t.Errorf("expected a 10s stop timeout by default, got %s", d)
+	} else if d := (&Process{StopTimeout: 3}).stopTimeout(); d != 3*time.Second {
+		t.Errorf("expected a 3s stop timeout, got %s", d)
+	}
+}
+
+// Starts a shell script as a process with a 1 second stop timeout
+func startStopProc(t *testing.T, script string) *Process {
+	t.Helper()
+	p := &Process{
+		Name:        "stop",
+		Program:     "sh",
+		Args:        []string{"-c", script},
+		StopTimeout: 1,
+	}
+	NewApp().AddProc(p)
+	if err := p.Start(); err != nil {
+		t.Fatalf("error starting process: %v", err)
+	}
+	// Give the shell time to set its traps
+	time.Sleep(100 * time.Millisecond)
+	return p
+}
+
+// Stops the process, returning how long it took for the process to exit
+func timeStop(t *testing.T, p *Process, stop func(*Process) error) time.Duration {
+	t.Helper()
+	start := time.Now()
+	if err := stop(p); err != nil {
+		t.Fatalf("error stopping process: %v", err)
+	}
+	p.waitExit()
+	return time.Since(start)
+}
+
+func TestStopEscalation(t *testing.T) {
+	// Exits on its stop signal
+	p := startStopProc(t, "sleep 30")
+	if d := timeStop(t, p, (*Process).stop); d >= 500*time.Millisecond {
+		t.Errorf("expected the process to stop right away, took %s", d)
+	}
+
+	// Killed after the stop timeout since it ignores its stop signal
+	p = startStopProc(t, `trap "" TERM; sleep 30`)
+	d := timeStop(t, p, (*Process).stop)
+	if d < time.Second || d >= 2*time.Second {
+		t.Errorf("expected the process to be killed after 1s, took %s", d)
+	}
+
+	// The same for interrupting
+	p = startStopProc(t, `trap "" INT; sleep 30`)
+	d = timeStop(t, p, (*Process).interruptStop)
+	if d < time.Second || d >= 2*time.Second {
+		t.Errorf("expected the process to be killed after 1s, took %s", d)
+	}
+}
+
+func TestForceKill(t *testing.T) {
+	p := startStopProc(t, `trap "" TERM; sleep 30`)
+	done := make(chan struct{})
+	go func() {
+		p.stop()
+		close(done)
+	}()
+	// Being stopped already, so kill does nothing
+	time.Sleep(100 * time.Millisecond)
+	start := time.Now()
+	p.forceKill()
+	p.waitExit()
+	if d := time.Since(start); d >= 500*time.Millisecond {
+		t.Errorf("expected the process to be killed right away, took %s", d)
+	}
+	<-done
+	// Does nothing once the process has exited
+	p.forceKill()
+}
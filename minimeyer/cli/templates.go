@@ -0,0 +1,135 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// A process definition expanded into multiple processes (instances). The
+// name, program, args, env, dir, and output filenames are Go templates
+// executed with the instance's index (from 0) as {{.Index}} and the values
+// of its parameter set, if any (e.g., {{.Port}} for a parameter set with a
+// Port key). Numbers can be added with add (e.g., {{add 8000 .Index}}). If
+// the name has no template actions, "-[index]" is appended to it.
+type ProcessTemplate struct {
+	Process
+	// Number of instances (defaults to the number of parameter sets)
+	Instances int `json:"instances,omitempty" toml:"instances"`
+	// Parameters of each instance
+	Params []map[string]any `json:"params,omitempty" toml:"params"`
+}
+
+// Functions available in process templates
+var templateFuncs = template.FuncMap{
+	"add": func(nums ...any) (int, error) {
+		sum := 0
+		for _, n := range nums {
+			i, err := templateInt(n)
+			if err != nil {
+				return 0, err
+			}
+			sum += i
+		}
+		return sum, nil
+	},
+}
+
+func templateInt(v any) (int, error) {
+	switch n := v.(type) {
+	case int:
+		return n, nil
+	case int64:
+		return int(n), nil
+	case float64:
+		return int(n), nil
+	case string:
+		return strconv.Atoi(n)
+	}
+	return 0, fmt.Errorf("not a number: %v", v)
+}
+
+// Returns the processes the template expands to
+func (t *ProcessTemplate) expand() ([]*Process, error) {
+	if t.Name == "" {
+		return nil, fmt.Errorf("missing template name")
+	}
+	n := t.Instances
+	if n == 0 {
+		n = len(t.Params)
+	}
+	if n <= 0 {
+		return nil, fmt.Errorf("%s: instances must be positive", t.Name)
+	} else if len(t.Params) != 0 && len(t.Params) != n {
+		return nil, fmt.Errorf(
+			"%s: instances (%d) doesn't match the number of params (%d)",
+			t.Name, n, len(t.Params),
+		)
+	}
+	def, err := json.Marshal((*processJSON)(&t.Process))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", t.Name, err)
+	}
+	name := t.Name
+	if !strings.Contains(name, "{{") {
+		name += "-{{.Index}}"
+	}
+
+	procs := make([]*Process, 0, n)
+	for i := 0; i < n; i++ {
+		data := map[string]any{}
+		if len(t.Params) != 0 {
+			for k, v := range t.Params[i] {
+				data[k] = v
+			}
+		}
+		data["Index"] = i
+
+		proc := &Process{}
+		if err := json.Unmarshal(def, (*processJSON)(proc)); err != nil {
+			return nil, fmt.Errorf("%s: %v", t.Name, err)
+		}
+		exec := func(field *string) {
+			if err == nil {
+				*field, err = executeTemplate(*field, data)
+			}
+		}
+		proc.Name = name
+		exec(&proc.Name)
+		exec(&proc.Program)
+		for j := range proc.Args {
+			exec(&proc.Args[j])
+		}
+		for j := range proc.Env {
+			exec(&proc.Env[j])
+		}
+		exec(&proc.Dir)
+		exec(&proc.OutFilename)
+		exec(&proc.ErrFilename)
+		if err != nil {
+			return nil, fmt.Errorf("%s: instance %d: %v", t.Name, i, err)
+		}
+		procs = append(procs, proc)
+	}
+	return procs, nil
+}
+
+func executeTemplate(text string, data map[string]any) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+	tmpl, err := template.New("").
+		Option("missingkey=error").
+		Funcs(templateFuncs).
+		Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, data); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
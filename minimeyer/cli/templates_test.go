@@ -0,0 +1,143 @@
+package cli
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestProcessTemplateExpand(t *testing.T) {
+	tmpl := &ProcessTemplate{
+		Process: Process{
+			Name:        "worker",
+			Program:     "./worker",
+			Args:        []string{"--id", "{{.Index}}", "--port", "{{add 8000 .Index}}"},
+			Env:         []string{"QUEUE={{.Queue}}", "STATIC=1"},
+			Dir:         "/srv/{{.Queue}}",
+			OutFilename: "logs/{{.Queue}}.log",
+			DependsOn:   []string{"db"},
+		},
+		Params: []map[string]any{
+			{"Queue": "emails"},
+			{"Queue": "reports"},
+		},
+	}
+	procs, err := tmpl.expand()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []*Process{
+		{
+			Name:        "worker-0",
+			Program:     "./worker",
+			Args:        []string{"--id", "0", "--port", "8000"},
+			Env:         []string{"QUEUE=emails", "STATIC=1"},
+			Dir:         "/srv/emails",
+			OutFilename: "logs/emails.log",
+			DependsOn:   []string{"db"},
+		},
+		{
+			Name:        "worker-1",
+			Program:     "./worker",
+			Args:        []string{"--id", "1", "--port", "8001"},
+			Env:         []string{"QUEUE=reports", "STATIC=1"},
+			Dir:         "/srv/reports",
+			OutFilename: "logs/reports.log",
+			DependsOn:   []string{"db"},
+		},
+	}
+	if !reflect.DeepEqual(procs, want) {
+		t.Errorf("got %s, want %s", procsString(procs), procsString(want))
+	}
+	// The instances don't share the template's slices
+	procs[0].DependsOn[0] = "cache"
+	if tmpl.DependsOn[0] != "db" || procs[1].DependsOn[0] != "db" {
+		t.Errorf("instances share the template's slices")
+	}
+}
+
+func TestProcessTemplateExpandInstances(t *testing.T) {
+	tmpl := &ProcessTemplate{
+		Process: Process{
+			// Params from TOML are int64s and from JSON are float64s
+			Name:    "web-{{add .Base .Index}}",
+			Program: "server",
+			Args:    []string{"{{add .Base .Index 1}}"},
+		},
+		Params: []map[string]any{
+			{"Base": int64(10)}, {"Base": float64(20)}, {"Base": "30"},
+		},
+	}
+	procs, err := tmpl.expand()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, want := procNames(procs), "web-10,web-21,web-32"; got != want {
+		t.Errorf("got names %s, want %s", got, want)
+	}
+	if got := procs[2].Args[0]; got != "33" {
+		t.Errorf("got arg %s, want 33", got)
+	}
+
+	tmpl = &ProcessTemplate{
+		Process:   Process{Name: "copy", Program: "cp"},
+		Instances: 3,
+	}
+	if procs, err = tmpl.expand(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, want := procNames(procs), "copy-0,copy-1,copy-2"; got != want {
+		t.Errorf("got names %s, want %s", got, want)
+	}
+}
+
+func TestProcessTemplateExpandErrors(t *testing.T) {
+	tests := map[string]*ProcessTemplate{
+		"no name":      {Process: Process{Program: "x"}, Instances: 1},
+		"no instances": {Process: Process{Name: "x", Program: "x"}},
+		"params mismatch": {
+			Process:   Process{Name: "x", Program: "x"},
+			Instances: 2,
+			Params:    []map[string]any{{"A": 1}},
+		},
+		"missing param": {
+			Process:   Process{Name: "x", Program: "{{.Missing}}"},
+			Instances: 1,
+		},
+		"bad template": {
+			Process:   Process{Name: "x", Program: "{{.Index"},
+			Instances: 1,
+		},
+		"not a number": {
+			Process: Process{Name: "x", Program: "{{add .A 1}}"},
+			Params:  []map[string]any{{"A": "a"}},
+		},
+	}
+	for name, tmpl := range tests {
+		if _, err := tmpl.expand(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestExpandFilename(t *testing.T) {
+	p := &Process{Num: 3, Name: "web"}
+	tests := []struct {
+		filename, stream, want string
+	}{
+		{"-", "out", "process3-out.txt"},
+		{"%", "err", "web-err.txt"},
+		{"logs/-.log", "out", "logs/process3-out.log"},
+		{"/var/log/%.log", "err", "/var/log/web-err.log"},
+		{"out.txt", "out", "out.txt"},
+		{"logs/-x.log", "out", "logs/-x.log"},
+		{".log", "out", ".log"},
+	}
+	for _, test := range tests {
+		if got := p.expandFilename(test.filename, test.stream); got != test.want {
+			t.Errorf(
+				"%s (%s): got %s, want %s",
+				test.filename, test.stream, got, test.want,
+			)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package cli
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"time"
+)
+
+var (
+	// Paths of the certificate and key files the web server uses for TLS
+	webTLSCert, webTLSKey string
+	// Use a generated self-signed certificate if no certificate is given
+	webTLSSelfSigned bool
+)
+
+// Returns whether the web server uses TLS
+func webTLSEnabled() bool {
+	return webTLSCert != "" || webTLSSelfSigned
+}
+
+// Returns the TLS config for the web server running on addr, or nil if TLS
+// isn't used
+func webTLSConfig(addr string) (*tls.Config, error) {
+	var cert tls.Certificate
+	var err error
+	switch {
+	case webTLSCert != "" || webTLSKey != "":
+		if webTLSCert == "" || webTLSKey == "" {
+			return nil, fmt.Errorf("both the TLS certificate and key are required")
+		}
+		cert, err = tls.LoadX509KeyPair(webTLSCert, webTLSKey)
+		if err != nil {
+			return nil, fmt.Errorf("error loading TLS certificate: %v", err)
+		}
+	case webTLSSelfSigned:
+		cert, err = selfSignedCert(addr)
+		if err != nil {
+			return nil, fmt.Errorf("error generating TLS certificate: %v", err)
+		}
+		Printf(
+			"Generated self-signed certificate (SHA-256 fingerprint %X)\n",
+			sha256.Sum256(cert.Certificate[0]),
+		)
+	default:
+		return nil, nil
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// Generates a self-signed certificate for the host of addr, localhost, and
+// the machine's hostname, valid for a year
+func selfSignedCert(addr string) (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{Organization: []string{"minimeyer"}},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.AddDate(1, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	if hostname, err := os.Hostname(); err == nil && hostname != "" {
+		tmpl.DNSNames = append(tmpl.DNSNames, hostname)
+	}
+	if host, _, err := net.SplitHostPort(addr); err == nil && host != "" {
+		if ip := net.ParseIP(host); ip != nil {
+			if !ip.IsUnspecified() {
+				tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+			}
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, host)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
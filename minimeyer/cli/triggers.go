@@ -0,0 +1,214 @@
+package cli
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Output trigger actions
+const (
+	triggerRestart   = "restart"
+	triggerMarkReady = "mark-ready"
+	triggerCommand   = "command"
+	triggerNotify    = "notify"
+)
+
+// Max firings of an output trigger that can be running at once. Matching
+// lines are ignored while a trigger is at the limit, so a burst of matching
+// output (e.g., with no cooldown) can't start an unbounded number of commands.
+const maxTriggerFirings = 4
+
+// A rule evaluated on each line of a process's output
+type OutputTrigger struct {
+	// Regular expression lines are matched against (e.g., "panic:")
+	Match string `json:"match" toml:"match"`
+	// Only match lines of this stream ("stdout" or "stderr"; both if empty)
+	Stream string `json:"stream,omitempty" toml:"stream"`
+	// What to do when a line matches: "restart" (gracefully restart the
+	// process), "mark-ready" (mark the process as ready so its dependents are
+	// started), "command" (run the command), or "notify" (send a desktop
+	// notification with notify-send)
+	Action string `json:"action" toml:"action"`
+	// The program and args to run for command actions. The process name and
+	// number, the line, and the stream are passed in the MINIMEYER_PROC_NAME,
+	// MINIMEYER_PROC_NUM, MINIMEYER_LINE, and MINIMEYER_STREAM env vars.
+	Command []string `json:"command,omitempty" toml:"command"`
+	// Text of the notification for notify actions (default is the line)
+	Message string `json:"message,omitempty" toml:"message"`
+	// Minimum time in seconds between firings during a run (0 = fire on
+	// every matching line, as long as fewer than 4 firings of the trigger are
+	// still running). Restarts only fire once per run.
+	Cooldown time.Duration `json:"cooldown,omitempty" toml:"cooldown"`
+
+	re *regexp.Regexp
+}
+
+func (t *OutputTrigger) validate() error {
+	if t.Match == "" {
+		return fmt.Errorf("missing match")
+	}
+	re, err := regexp.Compile(t.Match)
+	if err != nil {
+		return fmt.Errorf("invalid match: %v", err)
+	}
+	t.re = re
+	switch t.Stream {
+	case "", streamStdout, streamStderr:
+	default:
+		return fmt.Errorf("invalid stream: %q", t.Stream)
+	}
+	switch t.Action {
+	case triggerRestart, triggerMarkReady, triggerNotify:
+	case triggerCommand:
+		if len(t.Command) == 0 {
+			return fmt.Errorf("missing command for command action")
+		}
+	default:
+		return fmt.Errorf("invalid action: %q", t.Action)
+	}
+	if t.Cooldown < 0 {
+		return fmt.Errorf("cooldown must be non-negative")
+	}
+	return nil
+}
+
+func (t *OutputTrigger) matches(stream, line string) bool {
+	if t.Stream != "" && t.Stream != stream {
+		return false
+	}
+	if t.re == nil {
+		// Not validated
+		matched, _ := regexp.MatchString(t.Match, line)
+		return matched
+	}
+	return t.re.MatchString(line)
+}
+
+// Returns true if any of the triggers marks the process as ready
+func hasMarkReadyTrigger(triggers []*OutputTrigger) bool {
+	for _, t := range triggers {
+		if t.Action == triggerMarkReady {
+			return true
+		}
+	}
+	return false
+}
+
+// A firing of an output trigger, broadcast with ActionTrigger messages
+type TriggerEvent struct {
+	Num    int       `json:"num"`
+	Match  string    `json:"match"`
+	Action string    `json:"action"`
+	Stream string    `json:"stream"`
+	Line   string    `json:"line"`
+	Time   time.Time `json:"time"`
+}
+
+// Returns the function the output lines of a run are passed to (nil if there
+// are no triggers). Called when the process is started.
+func (p *Process) outputTriggers(triggers []*OutputTrigger) func(string, string) {
+	if len(triggers) == 0 {
+		return nil
+	}
+	var (
+		lastFired = make([]time.Time, len(triggers))
+		// Number of firings of each trigger that are running
+		firing     = make([]int, len(triggers))
+		restarting bool
+		mtx        sync.Mutex
+	)
+	return func(stream, line string) {
+		for i, t := range triggers {
+			if !t.matches(stream, line) {
+				continue
+			}
+			now := time.Now()
+			mtx.Lock()
+			if t.Action == triggerRestart {
+				if restarting {
+					mtx.Unlock()
+					continue
+				}
+				restarting = true
+			} else if firing[i] >= maxTriggerFirings ||
+				(!lastFired[i].IsZero() &&
+					now.Sub(lastFired[i]) < time.Second*t.Cooldown) {
+				mtx.Unlock()
+				continue
+			}
+			lastFired[i] = now
+			firing[i]++
+			mtx.Unlock()
+			go func(i int, t *OutputTrigger) {
+				p.fireTrigger(t, TriggerEvent{
+					Num: p.Num, Match: t.Match, Action: t.Action,
+					Stream: stream, Line: line, Time: now,
+				})
+				mtx.Lock()
+				firing[i]--
+				mtx.Unlock()
+			}(i, t)
+		}
+	}
+}
+
+// Performs the trigger's action and broadcasts the firing
+func (p *Process) fireTrigger(t *OutputTrigger, ev TriggerEvent) {
+	Printf("%s: output trigger %q fired (%s): %s\n", p.Name, t.Match, t.Action, ev.Line)
+	p.procMtx.Lock()
+	p.lastTrigger = &ev
+	ready := p.ready
+	p.procMtx.Unlock()
+	p.recordEvent(eventTrigger, nil, t.Action+": "+ev.Line)
+	notify(Message{Action: ActionTrigger, Content: ev})
+
+	switch t.Action {
+	case triggerRestart:
+		if err := p.restart((*Process).stop); err != nil && err != errProcRunning {
+			Printf("Error restarting %s: %v\n", p.Name, err)
+		}
+	case triggerMarkReady:
+		if ready != nil {
+			p.markReady(ready)
+		}
+	case triggerCommand:
+		cmd := exec.Command(t.Command[0], t.Command[1:]...)
+		p.procMtx.RLock()
+		cmd.Env = append(
+			append([]string(nil), p.Env...),
+			"MINIMEYER_PROC_NAME="+p.Name,
+			"MINIMEYER_PROC_NUM="+strconv.Itoa(p.Num),
+			"MINIMEYER_LINE="+ev.Line,
+			"MINIMEYER_STREAM="+ev.Stream,
+		)
+		cmd.Dir = p.Dir
+		p.procMtx.RUnlock()
+		if out, err := cmd.CombinedOutput(); err != nil {
+			Printf("Error running trigger command for %s: %v: %s\n", p.Name, err, out)
+		}
+	case triggerNotify:
+		msg := t.Message
+		if msg == "" {
+			msg = ev.Line
+		}
+		if err := sendDesktopNotification("minimeyer: "+p.Name, msg); err != nil {
+			Printf("Error sending notification for %s: %v\n", p.Name, err)
+		}
+	}
+}
+
+// Sends a desktop notification with notify-send
+func sendDesktopNotification(title, body string) error {
+	path, err := exec.LookPath("notify-send")
+	if err != nil {
+		return fmt.Errorf("notify-send not available")
+	}
+	if out, err := exec.Command(path, title, body).CombinedOutput(); err != nil {
+		return fmt.Errorf("%v: %s", err, out)
+	}
+	return nil
+}
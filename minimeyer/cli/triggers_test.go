@@ -0,0 +1,209 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOutputTriggerValidate(t *testing.T) {
+	valid := []OutputTrigger{
+		{Match: "panic:", Action: triggerRestart},
+		{Match: "ready", Stream: streamStdout, Action: triggerMarkReady},
+		{Match: "x", Stream: streamStderr, Action: triggerNotify, Cooldown: 5},
+		{Match: "x", Action: triggerCommand, Command: []string{"true"}},
+	}
+	for _, trigger := range valid {
+		if err := trigger.validate(); err != nil {
+			t.Errorf("%+v: unexpected error: %v", trigger, err)
+		}
+	}
+	invalid := []OutputTrigger{
+		{Action: triggerRestart},
+		{Match: "(", Action: triggerRestart},
+		{Match: "x", Stream: "both", Action: triggerRestart},
+		{Match: "x", Action: "exit"},
+		{Match: "x", Action: triggerCommand},
+		{Match: "x", Action: triggerRestart, Cooldown: -1},
+	}
+	for _, trigger := range invalid {
+		if err := trigger.validate(); err == nil {
+			t.Errorf("%+v: expected an error", trigger)
+		}
+	}
+}
+
+func TestOutputTriggerMatches(t *testing.T) {
+	trigger := &OutputTrigger{Match: `^error: \d+`, Action: triggerNotify}
+	// Also matched before being validated
+	for _, validate := range []bool{false, true} {
+		if validate {
+			if err := trigger.validate(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if !trigger.matches(streamStdout, "error: 12 happened") ||
+			!trigger.matches(streamStderr, "error: 3") {
+			t.Errorf("expected the lines to match")
+		} else if trigger.matches(streamStdout, "an error: 12") ||
+			trigger.matches(streamStdout, "error: x") {
+			t.Errorf("expected the lines not to match")
+		}
+	}
+	trigger.Stream = streamStderr
+	if trigger.matches(streamStdout, "error: 1") {
+		t.Errorf("expected stdout lines not to match")
+	} else if !trigger.matches(streamStderr, "error: 1") {
+		t.Errorf("expected stderr lines to match")
+	}
+}
+
+// Returns a process with the trigger, which runs a command that appends the
+// line to a file (after sleeping for sleep), and a function returning the
+// lines in the file once it has want of them
+func commandTriggerProc(
+	t *testing.T, cooldown time.Duration, sleep string,
+) (*Process, *OutputTrigger, func(want int) []string) {
+	t.Helper()
+	dir := t.TempDir()
+	trigger := &OutputTrigger{
+		Match:  "match",
+		Action: triggerCommand,
+		Command: []string{
+			"sh", "-c", `echo "$MINIMEYER_LINE" >> out; sleep ` + sleep,
+		},
+		Cooldown: cooldown,
+	}
+	if err := trigger.validate(); err != nil {
+		t.Fatal(err)
+	}
+	p := &Process{Name: "triggered", Program: "true", Dir: dir}
+	NewApp().AddProc(p)
+	lines := func(want int) []string {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			b, _ := os.ReadFile(filepath.Join(dir, "out"))
+			lines := strings.Fields(string(b))
+			if len(lines) >= want {
+				return lines
+			} else if time.Now().After(deadline) {
+				t.Fatalf("expected %d firings, got %d", want, len(lines))
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	return p, trigger, lines
+}
+
+func TestOutputTriggerCooldown(t *testing.T) {
+	p, trigger, lines := commandTriggerProc(t, 60, "0")
+	onLine := p.outputTriggers([]*OutputTrigger{trigger})
+	onLine(streamStdout, "match1")
+	onLine(streamStdout, "other")
+	onLine(streamStderr, "match2")
+	onLine(streamStdout, "match3")
+	// Only the first fired, the rest were within the cooldown
+	lines(1)
+	time.Sleep(100 * time.Millisecond)
+	if got := lines(1); len(got) != 1 || got[0] != "match1" {
+		t.Errorf("expected only the first line to fire the trigger, got %q", got)
+	}
+
+	p.procMtx.RLock()
+	ev := p.lastTrigger
+	p.procMtx.RUnlock()
+	if ev == nil || ev.Line != "match1" || ev.Stream != streamStdout ||
+		ev.Action != triggerCommand {
+		t.Errorf("got last trigger %+v", ev)
+	}
+
+	// Each run has its own cooldown
+	onLine = p.outputTriggers([]*OutputTrigger{trigger})
+	onLine(streamStdout, "match4")
+	if got := lines(2); got[1] != "match4" {
+		t.Errorf("expected the new run to fire the trigger, got %q", got)
+	}
+}
+
+func TestOutputTriggerFiringCap(t *testing.T) {
+	// Each firing runs for a second, so the ones after the limit are dropped
+	p, trigger, lines := commandTriggerProc(t, 0, "1")
+	onLine := p.outputTriggers([]*OutputTrigger{trigger})
+	for i := 0; i < maxTriggerFirings+3; i++ {
+		onLine(streamStdout, "match")
+	}
+	lines(maxTriggerFirings)
+	time.Sleep(100 * time.Millisecond)
+	if got := lines(maxTriggerFirings); len(got) != maxTriggerFirings {
+		t.Errorf("expected %d firings, got %d", maxTriggerFirings, len(got))
+	}
+
+	// Fires again once the running firings finish
+	time.Sleep(1200 * time.Millisecond)
+	onLine(streamStdout, "match")
+	lines(maxTriggerFirings + 1)
+}
+
+func TestOutputTriggerRestart(t *testing.T) {
+	trigger := &OutputTrigger{Match: "panic:", Action: triggerRestart}
+	p := &Process{
+		Name:     "triggered",
+		Program:  "sleep",
+		Args:     []string{"30"},
+		OnOutput: []*OutputTrigger{trigger},
+	}
+	NewApp().AddProc(p)
+	if err := p.Start(); err != nil {
+		t.Fatalf("error starting process: %v", err)
+	}
+	defer func() {
+		p.kill()
+		p.waitExit()
+	}()
+	pid := func() int {
+		p.procMtx.RLock()
+		defer p.procMtx.RUnlock()
+		if p.cmd == nil || p.cmd.Process == nil {
+			return 0
+		}
+		return p.cmd.Process.Pid
+	}
+	firstPid := pid()
+
+	// Restarts only once per run, however many lines match
+	onLine := p.outputTriggers(p.OnOutput)
+	onLine(streamStdout, "panic: 1")
+	onLine(streamStdout, "panic: 2")
+	deadline := time.Now().Add(5 * time.Second)
+	for pid() == firstPid || !isRunningStatus(p.status.Load()) {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the process to be restarted")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	secondPid := pid()
+	onLine(streamStdout, "panic: 3")
+	time.Sleep(200 * time.Millisecond)
+	if pid() != secondPid {
+		t.Errorf("expected the process to be restarted only once")
+	}
+}
+
+func TestOutputTriggerMarkReady(t *testing.T) {
+	trigger := &OutputTrigger{Match: "listening", Action: triggerMarkReady}
+	p := &Process{Name: "triggered", Program: "true"}
+	NewApp().AddProc(p)
+	ready := make(chan struct{})
+	p.ready = ready
+	onLine := p.outputTriggers([]*OutputTrigger{trigger})
+	onLine(streamStdout, "starting")
+	onLine(streamStdout, "listening on :8000")
+	select {
+	case <-ready:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected the process to be marked ready")
+	}
+}
@@ -0,0 +1,679 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// The full-screen terminal UI, used instead of the line-prompt CLI (see
+// handleInput) when stdin and stdout are terminals. It shows the processes
+// and the output of the selected one, and anything minimeyer prints (e.g.,
+// processes finishing) is captured while it runs.
+
+// Help shown at the bottom of the TUI
+const tuiHelp = "↑/↓ select  s start  x stop  r restart  K kill  i interrupt  " +
+	"a add  d delete  t attach  PgUp/PgDn scroll  o toggle output  q quit"
+
+// Max number of lines of minimeyer's output kept while the TUI runs
+const tuiMaxMessages = 500
+
+// Runs the TUI if stdin and stdout are terminals (and noTUI is false) or the
+// line-prompt CLI otherwise
+func runInteractive(noTUI bool) {
+	if !noTUI && term.IsTerminal(int(os.Stdin.Fd())) &&
+		term.IsTerminal(int(os.Stdout.Fd())) && os.Getenv("TERM") != "dumb" {
+		err := runTUI()
+		if err == nil {
+			return
+		}
+		Println("Error running TUI, using prompt:", err)
+	}
+	handleInput()
+}
+
+type tui struct {
+	in, out *os.File
+	// Input read from the terminal
+	input chan []byte
+	// Closed when the TUI exits to stop reading input
+	stopInput chan struct{}
+	// Index of the selected process
+	selected int
+	// Number of lines the output pane is scrolled up by
+	scroll int
+	// Show minimeyer's output rather than the selected process's
+	showMessages bool
+	// Active prompt, if any
+	prompt *tuiPrompt
+
+	// Output of minimeyer (lines and the incomplete last line) and the result
+	// of the last action
+	messages []string
+	partial  string
+	status   string
+	msgMtx   sync.Mutex
+	// Signaled to redraw after a message or status
+	redraw chan struct{}
+}
+
+// A line of input entered at the bottom of the TUI
+type tuiPrompt struct {
+	label, input string
+	// Called with the input when enter is pressed
+	done func(string)
+}
+
+// Runs the TUI until the user quits (waiting for the processes) or presses
+// Ctrl-C (stopping them)
+func runTUI() error {
+	t := &tui{in: os.Stdin, out: os.Stdout, redraw: make(chan struct{}, 1)}
+	interrupted, err := t.runFullScreen()
+	if err != nil {
+		return err
+	}
+	if interrupted {
+		// Handled like Ctrl-C outside the TUI (the processes are stopped)
+		syscall.Kill(os.Getpid(), syscall.SIGINT)
+	} else {
+		Println("Waiting for processes to finish (Ctrl-C to stop them)...")
+	}
+	return nil
+}
+
+// Puts the terminal in raw mode on the alternate screen and captures
+// minimeyer's output while running the TUI, restoring everything once it
+// exits (even if it panics). Returns true if Ctrl-C was pressed.
+func (t *tui) runFullScreen() (bool, error) {
+	oldState, err := term.MakeRaw(int(t.in.Fd()))
+	if err != nil {
+		return false, err
+	}
+	defer term.Restore(int(t.in.Fd()), oldState)
+	// Use the alternate screen and hide the cursor
+	t.out.WriteString("\x1b[?1049h\x1b[?25l")
+	defer t.out.WriteString("\x1b[?25h\x1b[?1049l")
+	stdout.Lock()
+	stderr.Lock()
+	oldOut, oldErr := stdout.w, stderr.w
+	stdout.w, stderr.w = t, t
+	stderr.Unlock()
+	stdout.Unlock()
+	defer func() {
+		stdout.Lock()
+		stderr.Lock()
+		stdout.w, stderr.w = oldOut, oldErr
+		stderr.Unlock()
+		stdout.Unlock()
+	}()
+	return t.run(), nil
+}
+
+// Captures minimeyer's output (stdout and stderr) while the TUI runs
+func (t *tui) Write(p []byte) (int, error) {
+	t.msgMtx.Lock()
+	lines := strings.Split(t.partial+string(p), "\n")
+	t.partial = lines[len(lines)-1]
+	t.messages = append(t.messages, lines[:len(lines)-1]...)
+	if n := len(t.messages) - tuiMaxMessages; n > 0 {
+		t.messages = append(t.messages[:0], t.messages[n:]...)
+	}
+	t.msgMtx.Unlock()
+	t.requestRedraw()
+	return len(p), nil
+}
+
+func (t *tui) setStatus(format string, args ...any) {
+	t.msgMtx.Lock()
+	t.status = fmt.Sprintf(format, args...)
+	t.msgMtx.Unlock()
+	t.requestRedraw()
+}
+
+func (t *tui) requestRedraw() {
+	select {
+	case t.redraw <- struct{}{}:
+	default:
+	}
+}
+
+// Handles input and redraws until the user quits, returning true if Ctrl-C
+// was pressed
+func (t *tui) run() bool {
+	t.input, t.stopInput = make(chan []byte), make(chan struct{})
+	defer close(t.stopInput)
+	go readTerminalInput(t.in, t.input, t.stopInput)
+	winch := make(chan os.Signal, 1)
+	signal.Notify(winch, syscall.SIGWINCH)
+	defer signal.Stop(winch)
+	ticker := time.NewTicker(time.Second / 2)
+	defer ticker.Stop()
+
+	for {
+		t.draw()
+		select {
+		case b, ok := <-t.input:
+			if !ok {
+				return false
+			}
+			for _, k := range parseKeys(b) {
+				switch t.handleKey(k) {
+				case tuiQuit:
+					return false
+				case tuiInterrupt:
+					return true
+				}
+			}
+		case <-ticker.C:
+		case <-winch:
+		case <-t.redraw:
+		}
+	}
+}
+
+// Keys returned by parseKeys other than printable characters
+const (
+	keyUp        = "up"
+	keyDown      = "down"
+	keyPgUp      = "pgup"
+	keyPgDn      = "pgdn"
+	keyEnter     = "enter"
+	keyBackspace = "backspace"
+	keyEsc       = "esc"
+	keyCtrlC     = "ctrl-c"
+)
+
+// Splits the input read from the terminal into keys
+func parseKeys(b []byte) []string {
+	var keys []string
+	for len(b) != 0 {
+		switch {
+		case bytes.HasPrefix(b, []byte("\x1b[A")), bytes.HasPrefix(b, []byte("\x1bOA")):
+			keys, b = append(keys, keyUp), b[3:]
+		case bytes.HasPrefix(b, []byte("\x1b[B")), bytes.HasPrefix(b, []byte("\x1bOB")):
+			keys, b = append(keys, keyDown), b[3:]
+		case bytes.HasPrefix(b, []byte("\x1b[5~")):
+			keys, b = append(keys, keyPgUp), b[4:]
+		case bytes.HasPrefix(b, []byte("\x1b[6~")):
+			keys, b = append(keys, keyPgDn), b[4:]
+		case b[0] == 0x1b && len(b) > 2 && b[1] == '[':
+			// Ignore other escape sequences
+			i := 2
+			for i < len(b) && (b[i] < 0x40 || b[i] > 0x7e) {
+				i++
+			}
+			if i < len(b) {
+				i++
+			}
+			b = b[i:]
+		case b[0] == 0x1b:
+			keys, b = append(keys, keyEsc), b[1:]
+		case b[0] == '\r' || b[0] == '\n':
+			keys, b = append(keys, keyEnter), b[1:]
+		case b[0] == 0x7f || b[0] == '\b':
+			keys, b = append(keys, keyBackspace), b[1:]
+		case b[0] == 0x03:
+			keys, b = append(keys, keyCtrlC), b[1:]
+		default:
+			r := []rune(string(b))
+			if len(r) == 0 {
+				return keys
+			}
+			if r[0] >= 0x20 {
+				keys = append(keys, string(r[0]))
+			}
+			b = b[len(string(r[0])):]
+		}
+	}
+	return keys
+}
+
+// Results of handling a key
+const (
+	tuiContinue = iota
+	tuiQuit
+	tuiInterrupt
+)
+
+func (t *tui) handleKey(key string) int {
+	if key == keyCtrlC {
+		return tuiInterrupt
+	}
+	if p := t.prompt; p != nil {
+		switch key {
+		case keyEnter:
+			t.prompt = nil
+			p.done(p.input)
+		case keyEsc:
+			t.prompt = nil
+			t.setStatus("")
+		case keyBackspace:
+			if r := []rune(p.input); len(r) != 0 {
+				p.input = string(r[:len(r)-1])
+			}
+		case keyUp, keyDown, keyPgUp, keyPgDn:
+		default:
+			p.input += key
+		}
+		return tuiContinue
+	}
+
+	procs := app.procsSnapshot()
+	var proc *Process
+	if t.selected < len(procs) {
+		proc = procs[t.selected]
+	}
+	switch key {
+	case keyUp, "k":
+		if t.selected > 0 {
+			t.selected--
+			t.scroll = 0
+		}
+	case keyDown, "j":
+		if t.selected < len(procs)-1 {
+			t.selected++
+			t.scroll = 0
+		}
+	case keyPgUp:
+		t.scroll += 10
+	case keyPgDn:
+		if t.scroll -= 10; t.scroll < 0 {
+			t.scroll = 0
+		}
+	case "o":
+		t.showMessages = !t.showMessages
+		t.scroll = 0
+	case "q":
+		return tuiQuit
+	case "a":
+		t.addProcess()
+	case "t":
+		if proc == nil {
+			t.setStatus("No process selected")
+			break
+		}
+		t.attach(proc)
+	case "s", "x", "r", "K", "i", "d":
+		if proc == nil {
+			t.setStatus("No process selected")
+			break
+		}
+		t.procAction(key, proc)
+	}
+	return tuiContinue
+}
+
+// Performs the action for the key on the process (without blocking)
+func (t *tui) procAction(key string, proc *Process) {
+	running := isRunningStatus(proc.status.Load())
+	switch key {
+	case "s":
+		if running {
+			t.setStatus("%s is already running", proc.Name)
+			return
+		}
+		go func() {
+			if err := proc.Start(); err != nil {
+				t.setStatus("Error starting %s: %v", proc.Name, err)
+			} else {
+				t.setStatus("Started %s", proc.Name)
+			}
+		}()
+	case "x":
+		if !running {
+			t.setStatus("%s is not running", proc.Name)
+			return
+		}
+		t.setStatus("Stopping %s...", proc.Name)
+		go func() {
+			if err := proc.stop(); err != nil {
+				t.setStatus("Error stopping %s: %v", proc.Name, err)
+			} else {
+				proc.waitExit()
+				t.setStatus("Stopped %s", proc.Name)
+			}
+		}()
+	case "r":
+		t.setStatus("Restarting %s...", proc.Name)
+		go func() {
+			if err := proc.restart((*Process).stop); err != nil {
+				t.setStatus("Error restarting %s: %v", proc.Name, err)
+			} else {
+				t.setStatus("Restarted %s", proc.Name)
+			}
+		}()
+	case "K", "i":
+		if !running {
+			t.setStatus("%s is not running", proc.Name)
+			return
+		}
+		stop, verb := (*Process).kill, "Killed"
+		if key == "i" {
+			stop, verb = (*Process).interrupt, "Interrupted"
+		}
+		if err := stop(proc); err != nil {
+			t.setStatus("Error signaling %s: %v", proc.Name, err)
+		} else {
+			t.setStatus("%s %s", verb, proc.Name)
+		}
+	case "d":
+		t.ask(fmt.Sprintf("Delete %s [y/N]? ", proc.Name), func(s string) {
+			if s = strings.ToLower(s); s != "y" && s != "yes" {
+				t.setStatus("")
+				return
+			}
+			go func() {
+				app.BulkAction(ActionDel, []*Process{proc})
+				t.setStatus("Deleted %s", proc.Name)
+			}()
+		})
+	}
+}
+
+// Hands the terminal over to the (interactive) process until the detach key
+// is pressed or the process exits
+func (t *tui) attach(proc *Process) {
+	pty, err := proc.attachablePTY()
+	if err != nil {
+		t.setStatus("Can't attach to %s: %v", proc.Name, err)
+		return
+	}
+	scrollback, output, detach := pty.attach()
+	defer detach()
+	if output == nil {
+		t.setStatus("%s exited", proc.Name)
+		return
+	}
+	// Clear the screen and show the cursor
+	t.out.WriteString("\x1b[H\x1b[2J\x1b[?25h")
+	fmt.Fprintf(t.out, "Attached to %s (Ctrl-] to detach)\r\n", proc.Name)
+	t.out.Write(scrollback)
+	detached := runAttached(t.input, output, pty.input)
+	// Undo any changes made by the process (e.g., leaving the alternate
+	// screen or changing the cursor keys' mode)
+	t.out.WriteString("\x1b[0m\x1b[?1l\x1b[?1049h\x1b[?25l\x1b[2J")
+	if detached {
+		t.setStatus("Detached from %s", proc.Name)
+	} else {
+		t.setStatus("%s exited", proc.Name)
+	}
+}
+
+// Prompts for the name, program, args, and working directory of a process
+// and then adds and starts it
+func (t *tui) addProcess() {
+	proc := &Process{}
+	t.ask("Name: ", func(name string) {
+		if name == "" {
+			t.setStatus("Missing process name")
+			return
+		} else if app.GetProcByName(name) != nil {
+			t.setStatus("Process name in use: %s", name)
+			return
+		}
+		proc.Name = name
+		t.ask("Program: ", func(program string) {
+			proc.Program = program
+			t.askArgs(proc, func() {
+				t.ask("Working directory (blank = current): ", func(dir string) {
+					proc.Dir = dir
+					if err := proc.validate(); err != nil {
+						t.setStatus("Invalid process: %v", err)
+						return
+					}
+					app.AddRuntimeProc(proc)
+					t.selected = len(app.procsSnapshot()) - 1
+					t.scroll = 0
+					go func() {
+						if err := proc.Start(); err != nil {
+							t.setStatus("Added %s, error starting: %v", proc.Name, err)
+						} else {
+							t.setStatus("Added and started %s", proc.Name)
+						}
+					}()
+				})
+			})
+		})
+	})
+}
+
+// Prompts for the args of the process one at a time until a blank one is
+// entered
+func (t *tui) askArgs(proc *Process, done func()) {
+	label := fmt.Sprintf("Arg %d (blank = done): ", len(proc.Args)+1)
+	t.ask(label, func(arg string) {
+		if arg == "" {
+			done()
+			return
+		}
+		proc.Args = append(proc.Args, arg)
+		t.askArgs(proc, done)
+	})
+}
+
+func (t *tui) ask(label string, done func(string)) {
+	t.prompt = &tuiPrompt{label: label, done: done}
+}
+
+// A row of the process table
+type tuiRow struct {
+	num, restarts int
+	name, status  string
+	pid           int
+	uptime        time.Duration
+	running       bool
+}
+
+func tuiRows(procs []*Process) []tuiRow {
+	rows := make([]tuiRow, len(procs))
+	now := time.Now()
+	for i, p := range procs {
+		status := p.status.Load()
+		row := tuiRow{
+			num: p.Num, name: p.Name, status: statusString(status),
+			running: isRunningStatus(status),
+		}
+		p.procMtx.RLock()
+		row.restarts = p.restarts
+		if row.running {
+			row.uptime = now.Sub(p.startedAt)
+			if p.cmd != nil && p.cmd.Process != nil {
+				row.pid = p.cmd.Process.Pid
+			}
+		}
+		p.procMtx.RUnlock()
+		rows[i] = row
+	}
+	return rows
+}
+
+// Draws the whole screen
+func (t *tui) draw() {
+	width, height, err := term.GetSize(int(t.out.Fd()))
+	if err != nil || width <= 0 || height <= 0 {
+		width, height = 80, 24
+	}
+	procs := app.procsSnapshot()
+	if t.selected >= len(procs) {
+		t.selected = len(procs) - 1
+	}
+	if t.selected < 0 {
+		t.selected = 0
+	}
+	rows := tuiRows(procs)
+
+	var lines []string
+	addLine := func(style, s string) {
+		s = truncateRunes(s, width)
+		if style != "" {
+			s = style + s + "\x1b[0m"
+		}
+		lines = append(lines, s)
+	}
+
+	web := "web: not running"
+	if srvrRunning.Load() {
+		web = "web: " + srvr.Addr
+	}
+	addLine("\x1b[1m", fmt.Sprintf(
+		"minimeyer | %d processes | %s | %s",
+		len(procs), web, time.Now().Format("15:04:05"),
+	))
+	addLine("\x1b[1;7m", padRunes(fmt.Sprintf(
+		"%4s  %-20s %-10s %7s %10s %8s",
+		"#", "NAME", "STATUS", "PID", "UPTIME", "RESTARTS",
+	), width))
+
+	// The table takes up to half of the screen, scrolled to the selection
+	tableHeight := (height - 6) / 2
+	if tableHeight < 1 {
+		tableHeight = 1
+	}
+	if len(rows) < tableHeight {
+		tableHeight = len(rows)
+	}
+	first := 0
+	if t.selected >= tableHeight {
+		first = t.selected - tableHeight + 1
+	}
+	if len(rows) == 0 {
+		addLine("", "  No processes (a to add)")
+	}
+	for i := first; i < len(rows) && i < first+tableHeight; i++ {
+		row := rows[i]
+		pid, uptime := "-", "-"
+		if row.running {
+			uptime = row.uptime.Truncate(time.Second).String()
+			if row.pid != 0 {
+				pid = fmt.Sprint(row.pid)
+			}
+		}
+		s := fmt.Sprintf(
+			"%4d  %-20s %-10s %7s %10s %8d",
+			row.num, truncateRunes(row.name, 20), row.status, pid, uptime,
+			row.restarts,
+		)
+		style := ""
+		if i == t.selected {
+			style = "\x1b[7m"
+			s = padRunes(s, width)
+		}
+		addLine(style, s)
+	}
+
+	// The output pane takes the rest of the screen, leaving room for the
+	// status and help lines
+	paneHeight := height - len(lines) - 3
+	var pane []string
+	title := "Output of minimeyer (o: process output)"
+	if t.showMessages {
+		t.msgMtx.Lock()
+		pane = append(pane, t.messages...)
+		t.msgMtx.Unlock()
+	} else if t.selected < len(procs) {
+		proc := procs[t.selected]
+		title = fmt.Sprintf("Output of %s (o: minimeyer output)", proc.Name)
+		if paneHeight > 0 {
+			for _, line := range proc.logBuffer().Tail(paneHeight + t.scroll) {
+				s := line.Time.Format("15:04:05") + " " + sanitizeLine(line.Line)
+				if line.Stream == streamStderr {
+					s = "\x1b[31m" + s + "\x1b[0m"
+				}
+				pane = append(pane, s)
+			}
+		}
+	}
+	if t.scroll > 0 {
+		title += fmt.Sprintf(" [scrolled %d]", t.scroll)
+	}
+	addLine("\x1b[1m", "── "+title+" "+strings.Repeat("─", width))
+	if t.showMessages {
+		for i := range pane {
+			pane[i] = sanitizeLine(pane[i])
+		}
+	}
+	// Show the lines ending scroll lines from the end
+	end := len(pane) - t.scroll
+	if end < 0 {
+		end = 0
+	}
+	start := end - paneHeight
+	if start < 0 {
+		start = 0
+	}
+	for _, s := range pane[start:end] {
+		lines = append(lines, truncateStyled(s, width))
+	}
+	for len(lines) < height-2 {
+		lines = append(lines, "")
+	}
+
+	if p := t.prompt; p != nil {
+		addLine("\x1b[1m", p.label+p.input+"_")
+	} else {
+		t.msgMtx.Lock()
+		status := t.status
+		t.msgMtx.Unlock()
+		addLine("", status)
+	}
+	addLine("\x1b[2m", tuiHelp)
+	if len(lines) > height {
+		lines = lines[:height]
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("\x1b[H")
+	for i, line := range lines {
+		buf.WriteString(line)
+		buf.WriteString("\x1b[K")
+		if i != len(lines)-1 {
+			buf.WriteString("\r\n")
+		}
+	}
+	buf.WriteString("\x1b[J")
+	t.out.Write(buf.Bytes())
+}
+
+// Replaces tabs with spaces and removes other control characters (which
+// would break the layout)
+func sanitizeLine(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '\t':
+			return ' '
+		case r < 0x20, r == 0x7f:
+			return -1
+		}
+		return r
+	}, s)
+}
+
+func truncateRunes(s string, n int) string {
+	if r := []rune(s); len(r) > n {
+		return string(r[:n])
+	}
+	return s
+}
+
+func padRunes(s string, n int) string {
+	if r := []rune(s); len(r) < n {
+		return s + strings.Repeat(" ", n-len(r))
+	}
+	return s
+}
+
+// Truncates the line, which may start with a color (and end with a reset)
+func truncateStyled(s string, n int) string {
+	if strings.HasPrefix(s, "\x1b[31m") {
+		s = strings.TrimSuffix(strings.TrimPrefix(s, "\x1b[31m"), "\x1b[0m")
+		return "\x1b[31m" + truncateRunes(s, n) + "\x1b[0m"
+	}
+	return truncateRunes(s, n)
+}
@@ -0,0 +1,269 @@
+package cli
+
+import (
+	"fmt"
+	"io/fs"
+	"os/exec"
+	pathpkg "path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// How often the watched files are checked for changes
+	watchPollInterval = 500 * time.Millisecond
+	// Default time to wait after a change for further changes before
+	// restarting
+	defaultWatchDebounce = 500 * time.Millisecond
+)
+
+// Names of the directories that aren't watched unless a watch pattern names
+// them (e.g., "vendor/**/*.go") since they tend to be large and to be changed
+// by builds and package managers rather than by hand
+var defaultIgnoreDirs = []string{
+	".git", ".hg", ".svn", "node_modules", "vendor", "target", "dist",
+	"build", "__pycache__", ".venv",
+}
+
+// How a process is restarted when its watched files change
+const (
+	watchRestartInterrupt = "interrupt"
+	watchRestartKill      = "kill"
+	watchRestartStop      = "stop"
+)
+
+// Returns true if the watch restart method is valid
+func validWatchRestart(method string) bool {
+	switch method {
+	case "", watchRestartInterrupt, watchRestartKill, watchRestartStop:
+		return true
+	}
+	return false
+}
+
+// Returns an error if the glob pattern is invalid
+func validateGlob(pattern string) error {
+	for _, seg := range strings.Split(filepath.ToSlash(pattern), "/") {
+		if _, err := pathpkg.Match(seg, ""); err != nil {
+			return fmt.Errorf("invalid glob: %s", pattern)
+		}
+	}
+	return nil
+}
+
+// Reports whether the slash-separated path matches the glob pattern. Along
+// with the syntax of path.Match, a "**" segment matches zero or more path
+// segments.
+func matchGlob(pattern, path string) bool {
+	return matchSegs(
+		strings.Split(filepath.ToSlash(pattern), "/"), strings.Split(path, "/"),
+	)
+}
+
+func matchSegs(pats, segs []string) bool {
+	for len(pats) != 0 {
+		if pats[0] == "**" {
+			for i := 0; i <= len(segs); i++ {
+				if matchSegs(pats[1:], segs[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segs) == 0 {
+			return false
+		}
+		if ok, _ := pathpkg.Match(pats[0], segs[0]); !ok {
+			return false
+		}
+		pats, segs = pats[1:], segs[1:]
+	}
+	return len(segs) == 0
+}
+
+func matchAny(patterns []string, path string) bool {
+	for _, pattern := range patterns {
+		if matchGlob(pattern, path) {
+			return true
+		}
+	}
+	return false
+}
+
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// Returns the state of the files under root that match the watch patterns
+// and don't match the ignore patterns, keyed by their path relative to root
+func scanWatched(root string, watch, ignore []string) map[string]fileState {
+	skipDirs := make(map[string]bool, len(defaultIgnoreDirs))
+	for _, name := range defaultIgnoreDirs {
+		skipDirs[name] = true
+	}
+	for _, pattern := range watch {
+		for _, seg := range strings.Split(filepath.ToSlash(pattern), "/") {
+			delete(skipDirs, seg)
+		}
+	}
+	files := make(map[string]fileState)
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil || rel == "." {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		if d.IsDir() {
+			// Skip ignored directories (e.g., "node_modules" or ".git/**")
+			if skipDirs[d.Name()] ||
+				matchAny(ignore, rel) || matchAny(ignore, rel+"/") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !matchAny(watch, rel) || matchAny(ignore, rel) {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			files[rel] = fileState{modTime: info.ModTime(), size: info.Size()}
+		}
+		return nil
+	})
+	return files
+}
+
+// Returns the path of a file that was added, removed, or changed, if any
+func changedFile(old, cur map[string]fileState) (string, bool) {
+	for path, state := range cur {
+		if oldState, ok := old[path]; !ok || oldState != state {
+			return path, true
+		}
+	}
+	for path := range old {
+		if _, ok := cur[path]; !ok {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// Time to wait after a change for further changes before restarting
+func (p *Process) watchDebounce() time.Duration {
+	if p.WatchDebounce <= 0 {
+		return defaultWatchDebounce
+	}
+	return time.Duration(p.WatchDebounce * float64(time.Second))
+}
+
+// Starts watching the process's files, if it has watch patterns and isn't
+// being watched already. Must be called with the proc mutex held.
+func (p *Process) startWatching() {
+	if len(p.Watch) == 0 || p.watchStop != nil {
+		return
+	}
+	p.watchStop = make(chan struct{})
+	go p.watchFiles(p.watchStop)
+}
+
+// Stops watching the process's files. Must be called with the proc mutex
+// held.
+func (p *Process) stopWatching() {
+	if p.watchStop != nil {
+		close(p.watchStop)
+		p.watchStop = nil
+	}
+}
+
+// Polls the process's watched files, restarting the process once they've
+// changed and no further changes have been made for the debounce time
+func (p *Process) watchFiles(stop chan struct{}) {
+	ticker := time.NewTicker(watchPollInterval)
+	defer ticker.Stop()
+	scan := func() map[string]fileState {
+		p.procMtx.RLock()
+		root, watch, ignore := p.Dir, p.Watch, p.Ignore
+		p.procMtx.RUnlock()
+		if root == "" {
+			root = "."
+		}
+		return scanWatched(root, watch, ignore)
+	}
+	files := scan()
+	var (
+		changed    string
+		lastChange time.Time
+	)
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		cur := scan()
+		if path, ok := changedFile(files, cur); ok {
+			changed, lastChange = path, time.Now()
+		}
+		files = cur
+		if changed != "" && time.Since(lastChange) >= p.watchDebounce() {
+			p.watchRestart(changed)
+			changed = ""
+			// Ignore changes made by the restart (e.g., by the build)
+			files = scan()
+		}
+	}
+}
+
+// Restarts the process after a watched file changed, running the pre-restart
+// command first. The process is only restarted if it's running or if it
+// exited with an error on its own (e.g., a dev server that failed to
+// compile).
+func (p *Process) watchRestart(changed string) {
+	p.procMtx.RLock()
+	running := isRunningStatus(p.status.Load())
+	crashed, preRestart, method := p.crashed, p.PreRestart, p.WatchRestart
+	p.procMtx.RUnlock()
+	if !running && !crashed {
+		return
+	}
+	Printf("%s changed, restarting %s\n", changed, p.Name)
+
+	if len(preRestart) != 0 {
+		if err := p.runPreRestart(preRestart); err != nil {
+			Printf("Not restarting %s, pre-restart command failed: %v\n", p.Name, err)
+			return
+		}
+	}
+	var stop func(*Process) error
+	switch method {
+	case watchRestartKill:
+		stop = (*Process).kill
+	case watchRestartStop:
+		stop = (*Process).stop
+	default:
+		// Killed if it doesn't exit after the stop timeout, so the restart
+		// can't hang
+		stop = (*Process).interruptStop
+	}
+	if err := p.restart(stop); err != nil && err != errProcRunning {
+		Printf("Error restarting %s: %v\n", p.Name, err)
+	}
+}
+
+// Runs the pre-restart command, adding its output to the process's logs
+func (p *Process) runPreRestart(command []string) error {
+	cmd := exec.Command(command[0], command[1:]...)
+	p.procMtx.RLock()
+	cmd.Env, cmd.Dir = p.Env, p.Dir
+	p.procMtx.RUnlock()
+	w := newLogWriter(p.logBuffer(), streamBuild, nil)
+	cmd.Stdout, cmd.Stderr = w, w
+	cmd.WaitDelay = outputWaitDelay
+	err := cmd.Run()
+	w.Flush()
+	return err
+}
@@ -1,14 +1,16 @@
 package cli
 
-// TODO: Test *Restart actions
-
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/json"
 	"fmt"
+	"html"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	pathpkg "path"
 	"path/filepath"
@@ -22,7 +24,6 @@ import (
 )
 
 var (
-	webPassword *string
 	srvr        = &http.Server{}
 	srvrRunning atomic.Bool
 	conns       sync.Map
@@ -53,13 +54,20 @@ func newServer(addr string) *http.Server {
 		Addr: addr,
 		Handler: func() http.Handler {
 			r := http.NewServeMux()
+			r.HandleFunc(loginPath, loginHandler)
+			r.HandleFunc(logoutPath, logoutHandler)
 			r.HandleFunc("/", homeHandler)
 			r.HandleFunc("/index.js", jsHandler)
 			r.HandleFunc("/index.css", cssHandler)
 			r.HandleFunc("/stdout/", stdoutHandler)
 			r.HandleFunc("/stderr/", stderrHandler)
-			r.Handle("/ws", webs.Handler(wsHandler))
-			return r
+			r.HandleFunc(apiPrefix, apiHandler)
+			r.HandleFunc("/metrics", metricsHandler)
+			r.Handle("/ws", webs.Server{
+				Handler:   wsHandler,
+				Handshake: wsHandshake,
+			})
+			return requireAuth(r)
 		}(),
 		// TODO: Discard errors?
 		//ErrorLog: log.New(io.Discard, "SERVER: ", 0),
@@ -72,8 +80,19 @@ func RunWeb(addr string) error {
 		return errSrvrRunning
 	}
 	srvr = newServer(addr)
+	tlsConfig, err := webTLSConfig(addr)
+	if err != nil {
+		srvrRunning.Store(false)
+		return err
+	}
+	srvr.TLSConfig = tlsConfig
 	go func() {
-		err := srvr.ListenAndServe()
+		var err error
+		if srvr.TLSConfig != nil {
+			err = srvr.ListenAndServeTLS("", "")
+		} else {
+			err = srvr.ListenAndServe()
+		}
 		srvrRunning.Store(false)
 		if err != nil && err != http.ErrServerClosed {
 			Eprintln("Server stopped with error:", err)
@@ -127,15 +146,28 @@ func cssHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func stdoutHandler(w http.ResponseWriter, r *http.Request) {
+	outputHandler(w, r, streamStdout)
+}
+
+func stderrHandler(w http.ResponseWriter, r *http.Request) {
+	outputHandler(w, r, streamStderr)
+}
+
+// Serves the output files of processes:
+// /[stream]/[num]: the current file
+// /[stream]/[num]/: a list of the current and rotated files
+// /[stream]/[num]/[name]: a rotated file (decompressed if needed)
+func outputHandler(w http.ResponseWriter, r *http.Request, stream string) {
 	path := r.URL.Path
 	if !pathpkg.IsAbs(path) {
 		path = "/" + path
 	}
-	prefix, snum := pathpkg.Split(path)
-	if prefix != "/stdout/" {
+	prefix := "/" + stream + "/"
+	if !strings.HasPrefix(path, prefix) {
 		http.NotFound(w, r)
 		return
 	}
+	snum, segment, listing := strings.Cut(strings.TrimPrefix(path, prefix), "/")
 	num, err := strconv.Atoi(snum)
 	if err != nil {
 		http.Error(w, "invalid number: "+snum, http.StatusBadRequest)
@@ -147,76 +179,147 @@ func stdoutHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	proc.procMtx.RLock()
-	if proc.OutFilename == "" || proc.outFile == nil {
-		w.Write([]byte(`<p style="color:red">Process stdout not captured</p>`))
-		return
+	filename, file := proc.OutFilename, proc.outFile
+	if stream == streamStderr {
+		filename, file = proc.ErrFilename, proc.errFile
+		if filename != "" && filename == proc.OutFilename {
+			// Same file
+			file = proc.outFile
+		}
 	}
-	name := proc.outFile.Name()
 	proc.procMtx.RUnlock()
-	http.ServeFile(w, r, name)
-}
-
-func stderrHandler(w http.ResponseWriter, r *http.Request) {
-	path := r.URL.Path
-	if !pathpkg.IsAbs(path) {
-		path = "/" + path
+	if filename == "" || file == nil {
+		w.Write([]byte(
+			`<p style="color:red">Process ` + stream + ` not captured</p>`,
+		))
+		return
 	}
-	prefix, snum := pathpkg.Split(path)
-	if prefix != "/stderr/" {
-		http.NotFound(w, r)
+	name := file.Name()
+	if !listing {
+		http.ServeFile(w, r, name)
 		return
 	}
-	num, err := strconv.Atoi(snum)
+
+	segments, err := rotatedSegments(name)
 	if err != nil {
-		http.Error(w, "invalid number: "+snum, http.StatusBadRequest)
+		http.Error(
+			w, "error listing files: "+err.Error(), http.StatusInternalServerError,
+		)
 		return
 	}
-	proc := app.GetProcByNum(num)
-	if proc == nil {
-		http.Error(w, "no process with number "+snum, http.StatusNotFound)
+	if segment == "" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprintf(
+			w, `<ul><li><a href="../%d">%s (current)</a></li>`,
+			num, html.EscapeString(filepath.Base(name)),
+		)
+		// Newest first
+		for i := len(segments) - 1; i >= 0; i-- {
+			base := filepath.Base(segments[i])
+			fmt.Fprintf(
+				w, `<li><a href="%s">%s</a></li>`,
+				url.PathEscape(base), html.EscapeString(base),
+			)
+		}
+		w.Write([]byte(`</ul>`))
 		return
 	}
-	proc.procMtx.RLock()
-	if proc.ErrFilename == "" || proc.errFile == nil {
-		w.Write([]byte(`<p style="color:red">Process stderr not captured</p>`))
+	for _, seg := range segments {
+		if filepath.Base(seg) != segment {
+			continue
+		}
+		if !strings.HasSuffix(seg, ".gz") {
+			http.ServeFile(w, r, seg)
+			return
+		}
+		f, err := os.Open(seg)
+		if err != nil {
+			http.Error(
+				w, "error opening file: "+err.Error(), http.StatusInternalServerError,
+			)
+			return
+		}
+		defer f.Close()
+		gr, err := gzip.NewReader(f)
+		if err != nil {
+			http.Error(
+				w, "error reading file: "+err.Error(), http.StatusInternalServerError,
+			)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		io.Copy(w, gr)
 		return
 	}
-	name := proc.errFile.Name()
-	proc.procMtx.RUnlock()
-	http.ServeFile(w, r, name)
+	http.NotFound(w, r)
+}
+
+// Checks the websocket handshake. Browsers let any page open websockets
+// (with the session cookie), so connections from pages on other sites (or
+// other origins on the same host, e.g., another port) are rejected. Both the
+// current and legacy protocols are served on these connections.
+func wsHandshake(config *webs.Config, r *http.Request) error {
+	if err := checkSameSite(r); err != nil {
+		return err
+	}
+	// Like webs.Handler, require an origin
+	origin, err := webs.Origin(config, r)
+	if err == nil && origin == nil {
+		err = fmt.Errorf("missing origin")
+	}
+	config.Origin = origin
+	return err
 }
 
 func wsHandler(ws *webs.Conn) {
 	defer ws.Close()
 
-	if webPassword != nil {
-		webs.JSON.Send(ws, Message{Action: ActionPassword})
-		for {
-			var msg Message
-			if err := webs.JSON.Receive(ws, &msg); err != nil {
-				return
-			}
-			if pwd, ok := msg.Content.(string); ok && pwd == *webPassword {
-				break
-			} else {
-			}
-			webs.JSON.Send(ws, Message{
-				Action: ActionPassword,
-				Error:  "Invalid Password",
-			})
-		}
-	}
-	webs.JSON.Send(ws, Message{
+	// The connection was authenticated (if necessary) by requireAuth
+	wsConnsTotal.Add(1)
+	wsConns.Add(1)
+	defer wsConns.Add(-1)
+	sendMsg(ws, Message{
 		Action:  ActionConnected,
 		Content: srvrName,
 	})
+	// The first message tells whether the client uses the legacy protocol
+	var first []byte
+	if err := webs.Message.Receive(ws, &first); err != nil {
+		return
+	}
+	if isLegacyMsg(first) {
+		handleLegacyMsgs(ws, first)
+		return
+	}
+	handleMsgsFrom(
+		ws, io.MultiReader(bytes.NewReader(first), ws),
+		ws.Request().RemoteAddr, &srvrRunning,
+	)
+}
+
+// Handles the messages received on the connection until it's closed or the
+// server it belongs to is no longer running. The connection is stored in
+// conns under the given key while the messages are handled so that it
+// receives notifications.
+func handleMsgs(ws msgConn, key string, running *atomic.Bool) {
+	handleMsgsFrom(ws, ws, key, running)
+}
 
-	conns.Store(ws.Request().RemoteAddr, ws)
-	defer conns.Delete(ws.Request().RemoteAddr)
-	d := json.NewDecoder(ws)
+// Like handleMsgs but the messages are read from r
+func handleMsgsFrom(ws msgConn, r io.Reader, key string, running *atomic.Bool) {
+	conns.Store(key, ws)
+	defer conns.Delete(key)
+	// Unsubscribe funcs for the processes being tailed
+	tails := make(map[int]func())
+	defer func() {
+		for _, unsub := range tails {
+			unsub()
+		}
+	}()
+	d := json.NewDecoder(r)
 	d.UseNumber()
 WsLoop:
-	for srvrRunning.Load() {
+	for running.Load() {
 		var msg Message
 		if err := d.Decode(&msg); err != nil {
 			if err != io.EOF && !strings.Contains(err.Error(), "closed") {
@@ -228,22 +331,42 @@ WsLoop:
 		case ActionAdd:
 			//resp := Message{}
 			errStr := ""
-		ActionAddLoop:
+			var procs []*Process
 			for _, proc := range msg.Processes {
-				if proc.Name == "" {
-					errStr += "missing process name" + "\n"
-					continue
-				} else if proc.Program == "" {
-					errStr += proc.Name + ": missing program" + "\n"
+				if err := proc.validate(); err != nil {
+					errStr += err.Error() + "\n"
 					continue
 				}
-				for _, pair := range proc.Env {
-					if pair != "" && !strings.Contains(pair, "=") {
-						errStr += proc.Name + ": invalid environment variable key-value pair: " + pair + "\n"
-						continue ActionAddLoop
+				procs = append(procs, proc)
+			}
+			// Dropping a process can leave others depending on it, so check
+			// until none are dropped
+			for checked := false; !checked; {
+				checked = true
+				for i := 0; i < len(procs); i++ {
+					proc := procs[i]
+					if err := app.checkDeps(proc, procs...); err != nil {
+						errStr += err.Error() + "\n"
+						procs = append(procs[:i], procs[i+1:]...)
+						i--
+						checked = false
 					}
 				}
-				app.AddProc(proc)
+			}
+			if sorted, err := app.sortBatchByDeps(procs); err != nil {
+				errStr += err.Error() + "\n"
+				procs = nil
+			} else {
+				procs = sorted
+			}
+			for _, proc := range procs {
+				app.AddRuntimeProc(proc)
+			}
+			for _, proc := range procs {
+				if proc.Schedule != "" {
+					// Started by its schedule
+					continue
+				}
 				// TODO: Use startProc?
 				if err := proc.Start(); err != nil {
 					errStr += "error starting process: " + err.Error() + "\n"
@@ -257,7 +380,7 @@ WsLoop:
 				Eprint(errStr)
 				//fmt.Print(errStr)
 			}
-			//webs.JSON.Send(ws, msg)
+			//sendMsg(ws, msg)
 		case ActionStart:
 			jnum, ok := msg.Content.(json.Number)
 			if !ok {
@@ -272,7 +395,7 @@ WsLoop:
 			num := int(inum)
 			proc := app.GetProcByNum(num)
 			if proc == nil {
-				webs.JSON.Send(ws, Message{
+				sendMsg(ws, Message{
 					Action:  ActionDel,
 					Content: num,
 					Error:   "no process num: " + jnum.String(),
@@ -282,7 +405,7 @@ WsLoop:
 			if err := proc.Start(); err != nil {
 				sendErr(ws, "error starting process: "+err.Error())
 			} else {
-				//webs.JSON.Send(ws, Message{Action: ActionAdd, Content: num})
+				//sendMsg(ws, Message{Action: ActionAdd, Content: num})
 			}
 		case ActionDel:
 			jnum, ok := msg.Content.(json.Number)
@@ -297,7 +420,7 @@ WsLoop:
 			}
 			num := int(inum)
 			if app.RemoveProcByNum(num) == nil {
-				webs.JSON.Send(ws, Message{
+				sendMsg(ws, Message{
 					Action:  ActionDel,
 					Content: num,
 					Error:   "no process num: " + jnum.String(),
@@ -307,18 +430,18 @@ WsLoop:
 			interruptProcMsg(ws, msg, false)
 		case ActionKill:
 			killProcMsg(ws, msg, false)
+		case ActionStop:
+			stopProcMsg(ws, msg)
 		case ActionInterruptRestart:
-			sendErr(ws, "not implemented")
-			//interruptProcMsg(ws, msg, true)
+			interruptProcMsg(ws, msg, true)
 		case ActionKillRestart:
-			sendErr(ws, "not implemented")
-			//killProcMsg(ws, msg, true)
+			killProcMsg(ws, msg, true)
 		case ActionRefresh:
 			if msg.Content == nil {
 				if bytes, err := app.refreshProcsJSON(); err != nil {
 					sendErr(ws, "internal server error: "+err.Error())
 				} else {
-					ws.Write(bytes)
+					sendMsg(ws, json.RawMessage(bytes))
 				}
 				continue
 			}
@@ -354,7 +477,7 @@ WsLoop:
 				if len(numsToDel) != 0 {
 					resp.Content = numsToDel
 				}
-				webs.JSON.Send(ws, resp)
+				sendMsg(ws, resp)
 			case json.Number:
 				jnum := msg.Content.(json.Number)
 				inum, err := jnum.Int64()
@@ -365,20 +488,141 @@ WsLoop:
 				num := int(inum)
 				proc := app.GetProcByNum(num)
 				if proc == nil {
-					webs.JSON.Send(ws, Message{
+					sendMsg(ws, Message{
 						Action:  ActionRefresh,
 						Content: []int{num},
 						Error:   "no process with number " + jnum.String(),
 					})
 					sendErr(ws, "no process with number "+jnum.String())
 				} else {
-					webs.JSON.Send(ws, NewMessageProc(ActionRefresh, proc))
+					sendMsg(ws, NewMessageProc(ActionRefresh, proc))
 				}
 			default:
 				sendErr(ws, "invalid message content")
 			}
 		case ActionEnv:
-			webs.JSON.Send(ws, Message{Action: ActionEnv, Content: app.env})
+			sendMsg(ws, Message{Action: ActionEnv, Content: app.env})
+		case ActionTail:
+			num, ok := msgProcNum(ws, msg)
+			if !ok {
+				continue
+			}
+			proc := app.GetProcByNum(num)
+			if proc == nil {
+				sendErr(ws, "no process with number "+strconv.Itoa(num))
+				continue
+			}
+			if unsub := tails[num]; unsub != nil {
+				unsub()
+			}
+			lines, ch, unsub := proc.logBuffer().Subscribe(0)
+			tails[num] = unsub
+			sendMsg(ws, Message{
+				Action:  ActionLog,
+				Content: LogsContent{Num: num, Lines: lines},
+			})
+			go func() {
+				for line := range ch {
+					sendMsg(ws, Message{
+						Action:  ActionLog,
+						Content: LogsContent{Num: num, Lines: []LogLine{line}},
+					})
+				}
+			}()
+		case ActionAttach:
+			num, ok := msgProcNum(ws, msg)
+			if !ok {
+				continue
+			}
+			proc := app.GetProcByNum(num)
+			if proc == nil {
+				sendErr(ws, "no process with number "+strconv.Itoa(num))
+				continue
+			}
+			if _, err := proc.attachablePTY(); err != nil {
+				sendErr(ws, err.Error())
+				continue
+			}
+			// The connection is only used for the terminal from now on
+			conns.Delete(key)
+			for num, unsub := range tails {
+				unsub()
+				delete(tails, num)
+			}
+			if err := attachConn(ws, d, proc); err != nil {
+				sendErr(ws, err.Error())
+			}
+			return
+		case ActionReload:
+			plan, err := app.PlanReload()
+			if err != nil {
+				sendErr(ws, "error reloading config: "+err.Error())
+				continue
+			}
+			if msg.Content == "plan" {
+				plan.DryRun = true
+				sendMsg(ws, Message{Action: ActionReload, Content: plan})
+				continue
+			}
+			notify(Message{Action: ActionReload, Content: plan})
+			app.ApplyReload(plan)
+		case ActionBulk:
+			var content BulkContent
+			if !msgContent(ws, msg, &content) {
+				continue
+			}
+			if content.Group == "" && content.Tag == "" {
+				sendErr(ws, "missing group or tag")
+				continue
+			} else if !validBulkAction(content.Action) {
+				sendErr(ws, "invalid bulk action: "+content.Action)
+				continue
+			}
+			procs := app.SelectProcs(content.ProcSelector)
+			if len(procs) == 0 {
+				sendErr(ws, "no matching processes")
+				continue
+			}
+			go app.BulkAction(content.Action, procs)
+		case ActionHistory:
+			var req HistoryRequest
+			if msg.Content != nil && !msgContent(ws, msg, &req) {
+				continue
+			}
+			if req.Limit <= 0 {
+				req.Limit = defaultHistoryLimit
+			}
+			events, err := app.History(req.Proc, req.Limit)
+			if err != nil {
+				sendErr(ws, "error getting history: "+err.Error())
+				continue
+			}
+			sendMsg(ws, Message{Action: ActionHistory, Content: events})
+		case ActionRuns:
+			num, ok := msgProcNum(ws, msg)
+			if !ok {
+				continue
+			}
+			proc := app.GetProcByNum(num)
+			if proc == nil {
+				sendErr(ws, "no process with number "+strconv.Itoa(num))
+				continue
+			}
+			sendMsg(ws, Message{
+				Action:  ActionRuns,
+				Content: RunsContent{Num: num, Runs: proc.Runs()},
+			})
+		case ActionUsage:
+			sendMsg(ws, Message{Action: ActionUsage, Content: app.Usage()})
+		case ActionUntail:
+			num, ok := msgProcNum(ws, msg)
+			if !ok {
+				continue
+			}
+			if unsub := tails[num]; unsub != nil {
+				unsub()
+				delete(tails, num)
+			}
 		default:
 			sendErr(ws, fmt.Sprintf("invalid action: %s", msg.Action))
 		}
@@ -386,78 +630,109 @@ WsLoop:
 }
 
 // Returns true if there was no error
-func interruptProcMsg(ws *webs.Conn, msg Message, restart bool) bool {
-	jnum, ok := msg.Content.(json.Number)
-	if !ok {
-		sendErr(ws, "invalid content field, expected process num")
-		return false
-	}
-	inum, err := jnum.Int64()
-	if err != nil {
-		sendErr(ws, "invalid number: "+err.Error())
-		return false
-	}
-	num := int(inum)
-	proc := app.GetProcByNum(num)
+func interruptProcMsg(ws msgConn, msg Message, restart bool) bool {
+	proc := msgProc(ws, msg)
 	if proc == nil {
-		webs.JSON.Send(ws, Message{
-			Action:  ActionDel,
-			Content: num,
-			Error:   "no process num: " + jnum.String(),
-		})
 		return false
 	}
+	if restart {
+		go restartProcMsg(ws, proc, (*Process).interruptStop)
+		return true
+	}
 	if err := proc.interrupt(); err != nil {
 		sendErr(ws, "error interrupting process: "+err.Error())
 		return false
 	}
-	if !restart {
-		//webs.JSON.Send(ws, Message{Action: ActionInterrupt, Content: num})
-		return true
-	}
-	if err := proc.Start(); err != nil {
+	//sendMsg(ws, Message{Action: ActionInterrupt, Content: num})
+	return true
+}
+
+// Restarts the process using the stop function, sending any error. The old
+// run is waited for so this should be run in its own goroutine.
+func restartProcMsg(ws msgConn, proc *Process, stop func(*Process) error) {
+	if err := proc.restart(stop); err != nil {
 		sendErr(ws, "error restarting process: "+err.Error())
-		return false
 	}
-	//webs.JSON.Send(ws, Message{Action: ActionInterruptRestart, Content: num})
-	return true
 }
 
-// Returns true if there was no error
-func killProcMsg(ws *webs.Conn, msg Message, restart bool) bool {
+// Gets the process number from the message content, sending an error and
+// returning false if it isn't a valid number
+func msgProcNum(ws msgConn, msg Message) (int, bool) {
 	jnum, ok := msg.Content.(json.Number)
 	if !ok {
 		sendErr(ws, "invalid content field, expected process num")
-		return false
+		return 0, false
 	}
 	inum, err := jnum.Int64()
 	if err != nil {
 		sendErr(ws, "invalid number: "+err.Error())
-		return false
+		return 0, false
+	}
+	return int(inum), true
+}
+
+// Gets the process whose number is the message content, sending an error
+// and returning nil if there isn't one
+func msgProc(ws msgConn, msg Message) *Process {
+	num, ok := msgProcNum(ws, msg)
+	if !ok {
+		return nil
 	}
-	num := int(inum)
 	proc := app.GetProcByNum(num)
 	if proc == nil {
-		webs.JSON.Send(ws, Message{
+		sendMsg(ws, Message{
 			Action:  ActionDel,
 			Content: num,
-			Error:   "no process num: " + jnum.String(),
+			Error:   "no process num: " + strconv.Itoa(num),
 		})
+	}
+	return proc
+}
+
+// Decodes the message content into v, sending an error and returning false
+// if it can't be decoded
+func msgContent(ws msgConn, msg Message, v any) bool {
+	b, err := json.Marshal(msg.Content)
+	if err == nil {
+		err = json.Unmarshal(b, v)
+	}
+	if err != nil {
+		sendErr(ws, "invalid message content: "+err.Error())
 		return false
 	}
-	if err := proc.kill(); err != nil {
-		sendErr(ws, "error kill process: "+err.Error())
+	return true
+}
+
+// Returns true if there was no error
+func stopProcMsg(ws msgConn, msg Message) bool {
+	proc := msgProc(ws, msg)
+	if proc == nil {
+		return false
+	}
+	// Stopping may take a while so don't block other messages
+	go func() {
+		if err := proc.stop(); err != nil {
+			sendErr(ws, "error stopping process: "+err.Error())
+		}
+	}()
+	return true
+}
+
+// Returns true if there was no error
+func killProcMsg(ws msgConn, msg Message, restart bool) bool {
+	proc := msgProc(ws, msg)
+	if proc == nil {
 		return false
 	}
-	if !restart {
-		//webs.JSON.Send(ws, Message{Action: ActionKill, Content: num})
+	if restart {
+		go restartProcMsg(ws, proc, (*Process).kill)
 		return true
 	}
-	if err := proc.Start(); err != nil {
-		sendErr(ws, "error restarting process: "+err.Error())
+	if err := proc.kill(); err != nil {
+		sendErr(ws, "error kill process: "+err.Error())
 		return false
 	}
-	//webs.JSON.Send(ws, Message{Action: ActionKillRestart, Content: num})
+	//sendMsg(ws, Message{Action: ActionKill, Content: num})
 	return true
 }
 
@@ -473,6 +748,12 @@ func NewMessageProc(action string, proc *Process) Message {
 	return Message{Action: action, Processes: []*Process{proc}}
 }
 
+// Content of ActionLog messages
+type LogsContent struct {
+	Num   int       `json:"num"`
+	Lines []LogLine `json:"lines"`
+}
+
 const (
 	// FROM CLIENT:
 	// Not sent by client
@@ -506,6 +787,12 @@ const (
 	// Content field should be populated with proc ID.
 	ActionInterrupt = "interrupt"
 	// FROM CLIENT:
+	// Content field should be populated with proc ID. The process is sent its
+	// stop signal and killed if it doesn't exit before its stop timeout.
+	// FROM SERVER:
+	// Content field should be populated with proc ID.
+	ActionStop = "stop"
+	// FROM CLIENT:
 	// Content field should be populated with proc ID.
 	// FROM SERVER:
 	// Content field should be populated with proc ID.
@@ -537,8 +824,102 @@ const (
 	// The password attempt.
 	// FROM SERVER:
 	// Whether a password is required and/or if it's invalid.
+	// NOTE: No longer sent since the web password is checked when logging in
+	// (see requireAuth) before the websocket is connected.
 	ActionPassword = "password"
 	// FROM CLIENT:
+	// Content field should be populated with proc ID. The server responds
+	// with the process's recent output and then sends new output as it's
+	// produced (ActionLog messages) until ActionUntail is sent.
+	// FROM SERVER:
+	// Not sent by server
+	ActionTail = "tail"
+	// FROM CLIENT:
+	// Content field should be populated with proc ID. Stops ActionLog
+	// messages for the process.
+	// FROM SERVER:
+	// Not sent by server
+	ActionUntail = "untail"
+	// FROM CLIENT:
+	// Not sent by client.
+	// FROM SERVER:
+	// Content populated with an object with the proc ID ("num") and an array
+	// of lines ("lines"), each with a sequence number ("seq"), timestamp
+	// ("time"), stream ("stream", either "stdout", "stderr", or "build" for
+	// the output of the pre-restart command), and the text of the line
+	// ("line").
+	ActionLog = "log"
+	// FROM CLIENT:
+	// Not sent by client.
+	// FROM SERVER:
+	// Processes populated with the process whose health (status) changed.
+	// Content populated with the last health check error, if any.
+	ActionHealth = "health"
+	// FROM CLIENT:
+	// Content may be populated with "plan" to only get the plan. Otherwise,
+	// the config file is reloaded and the plan is applied.
+	// FROM SERVER:
+	// Content populated with the plan: the names of the processes to add
+	// ("add"), remove ("remove"), restart ("restart"), and update ("update"),
+	// and whether it was only requested ("dryRun"). Sent to all clients
+	// before the plan is applied.
+	ActionReload = "reload"
+	// FROM CLIENT:
+	// Nothing should be populated.
+	// FROM SERVER:
+	// Content populated with an object mapping the proc IDs of the running
+	// processes to their last sampled resource usage ("cpuPercent", "rss" in
+	// bytes, "fds", "procs", and "time").
+	ActionUsage = "usage"
+	// FROM CLIENT:
+	// Content field should be populated with proc ID.
+	// FROM SERVER:
+	// Content populated with an object with the proc ID ("num") and an array
+	// of runs ("runs"), each with the start and end times ("start" and
+	// "end"), duration in seconds ("duration"), exit code ("exitCode"), error
+	// ("error", if any), and whether it was started by the schedule
+	// ("scheduled"). Sent in response with the process's run history (oldest
+	// first) and to all clients with the single run when a run of a scheduled
+	// process exits.
+	ActionRuns = "runs"
+	// FROM CLIENT:
+	// Content field should be populated with an object with the action
+	// ("action"; one of "start", "stop", "kill", "interrupt", "restart",
+	// "kill-restart", "interrupt-restart", or "del") and the group ("group")
+	// and/or tag ("tag") of the processes to perform it on. The processes are
+	// stopped and started in dependency order. Progress is sent using the
+	// usual messages (e.g., ActionStart and ActionFinished).
+	// FROM SERVER:
+	// Not sent by server
+	ActionBulk = "bulk"
+	// FROM CLIENT:
+	// Content may be populated with an object with the name of the process
+	// to get the history of ("proc"; all if empty) and the max number of
+	// events ("limit"; default is 50).
+	// FROM SERVER:
+	// Content populated with an array of the events from the state file,
+	// oldest first, each with the time ("time"), process name and ID ("proc"
+	// and "num"; empty and 0 for events of minimeyer itself), event
+	// ("event"; e.g., "start" or "exit"), exit code ("exitCode", for exit
+	// events), and details ("detail"). An error is sent if there's no state
+	// file.
+	ActionHistory = "history"
+	// FROM CLIENT:
+	// Not sent by client.
+	// FROM SERVER:
+	// Content populated with an object with the proc ID ("num"), the
+	// trigger's match ("match") and action ("action"), and the line that
+	// fired it ("line", "stream", and "time"). Sent to all clients when an
+	// output trigger fires.
+	ActionTrigger = "trigger"
+	// FROM CLIENT:
+	// Content field should be populated with proc ID of an interactive
+	// process that's running. Once the server responds, the connection is
+	// attached to the process's terminal (see attach.go) until it's closed.
+	// FROM SERVER:
+	// Content populated with the proc ID. Sent only to the client attaching.
+	ActionAttach = "attach"
+	// FROM CLIENT:
 	// Not sent by client.
 	// FROM SERVER:
 	// Content populated with error.
@@ -547,11 +928,33 @@ const (
 
 func notify(msg Message) {
 	conns.Range(func(_, iWs any) bool {
-		webs.JSON.Send(iWs.(*webs.Conn), msg)
+		sendMsg(iWs.(msgConn), msg)
 		return true
 	})
 }
 
-func sendErr(ws *webs.Conn, msg string) {
-	webs.JSON.Send(ws, Message{Action: ActionError, Error: msg})
+// A connection messages are exchanged over: either a websocket connection or
+// a control socket connection
+type msgConn interface {
+	io.ReadWriter
+}
+
+// Sends the value (usually a Message) over the connection as JSON. Messages
+// sent over control socket connections are terminated by a newline.
+func sendMsg(ws msgConn, v any) error {
+	if lc, ok := ws.(*legacyConn); ok {
+		return lc.notify(v)
+	} else if wsConn, ok := ws.(*webs.Conn); ok {
+		return webs.JSON.Send(wsConn, v)
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = ws.Write(append(b, '\n'))
+	return err
+}
+
+func sendErr(ws msgConn, msg string) {
+	sendMsg(ws, Message{Action: ActionError, Error: msg})
 }
@@ -0,0 +1,43 @@
+package cli
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	webs "golang.org/x/net/websocket"
+)
+
+func TestWebsocketHandshake(t *testing.T) {
+	const origin = "http://example.com"
+	tests := []struct {
+		origin, site string
+		ok           bool
+	}{
+		{origin, "", true},
+		{origin, "same-origin", true},
+		{"", "", false},
+		{"http://evil.com", "", false},
+		{"http://example.com:8080", "", false},
+		{origin, "cross-site", false},
+	}
+	for _, test := range tests {
+		// Requests are for example.com
+		r := httptest.NewRequest("GET", "/ws", nil)
+		if test.origin != "" {
+			r.Header.Set("Origin", test.origin)
+		}
+		if test.site != "" {
+			r.Header.Set("Sec-Fetch-Site", test.site)
+		}
+		config := &webs.Config{Version: webs.ProtocolVersionHybi13}
+		err := wsHandshake(config, r)
+		name := test.origin + " " + test.site
+		if test.ok && err != nil {
+			t.Errorf("%s: unexpected error: %v", name, err)
+		} else if !test.ok && err == nil {
+			t.Errorf("%s: expected an error", name)
+		} else if test.ok && config.Origin.String() != origin {
+			t.Errorf("%s: got origin %v", name, config.Origin)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package cli
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Compose files are decoded with yaml.v3 into generic values that keep the
+// order of mapping keys: scalars are strings (or nil for null), mappings are
+// *yamlMap, and sequences are []any. Aliases are expanded and merge keys (<<)
+// are applied.
+
+// Max depth of nested collections (and aliases), so recursive aliases can't
+// expand forever
+const maxYAMLDepth = 100
+
+// A YAML mapping, keeping the order of its keys
+type yamlMap struct {
+	keys   []string
+	values map[string]any
+}
+
+func newYAMLMap() *yamlMap {
+	return &yamlMap{values: make(map[string]any)}
+}
+
+func (m *yamlMap) get(key string) (any, bool) {
+	v, ok := m.values[key]
+	return v, ok
+}
+
+func (m *yamlMap) set(key string, v any) error {
+	if _, ok := m.values[key]; ok {
+		return fmt.Errorf("duplicate key: %s", key)
+	}
+	m.keys = append(m.keys, key)
+	m.values[key] = v
+	return nil
+}
+
+// Merges the values of the mappings into m (keys already in m are kept)
+func (m *yamlMap) merge(v any) error {
+	maps, ok := v.([]any)
+	if !ok {
+		maps = []any{v}
+	}
+	for _, item := range maps {
+		other, ok := item.(*yamlMap)
+		if !ok {
+			return fmt.Errorf("can only merge mappings")
+		}
+		for _, key := range other.keys {
+			if _, ok := m.values[key]; !ok {
+				m.set(key, other.values[key])
+			}
+		}
+	}
+	return nil
+}
+
+// Parses a YAML document (only the first if there are multiple)
+func parseYAML(data []byte) (any, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil
+	}
+	return yamlValue(doc.Content[0], 0)
+}
+
+// Converts a node to a generic value
+func yamlValue(n *yaml.Node, depth int) (any, error) {
+	if depth > maxYAMLDepth {
+		return nil, fmt.Errorf("line %d: nested too deeply", n.Line)
+	}
+	switch n.Kind {
+	case yaml.AliasNode:
+		return yamlValue(n.Alias, depth+1)
+	case yaml.ScalarNode:
+		if n.ShortTag() == "!!null" {
+			return nil, nil
+		}
+		return n.Value, nil
+	case yaml.SequenceNode:
+		items := make([]any, 0, len(n.Content))
+		for _, c := range n.Content {
+			v, err := yamlValue(c, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, v)
+		}
+		return items, nil
+	case yaml.MappingNode:
+		m := newYAMLMap()
+		// Merged after the other keys so those take precedence
+		var merges []any
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			k, vn := n.Content[i], n.Content[i+1]
+			v, err := yamlValue(vn, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			if k.Kind == yaml.ScalarNode && k.ShortTag() == "!!merge" {
+				merges = append(merges, v)
+				continue
+			} else if k.Kind != yaml.ScalarNode {
+				return nil, fmt.Errorf("line %d: keys must be scalars", k.Line)
+			}
+			if err := m.set(k.Value, v); err != nil {
+				return nil, fmt.Errorf("line %d: %v", k.Line, err)
+			}
+		}
+		for _, v := range merges {
+			if err := m.merge(v); err != nil {
+				return nil, fmt.Errorf("line %d: %v", n.Line, err)
+			}
+		}
+		return m, nil
+	}
+	return nil, fmt.Errorf("line %d: unexpected YAML node", n.Line)
+}
@@ -0,0 +1,134 @@
+package cli
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Converts parsed YAML to plain maps so it can be compared, with mappings'
+// keys listed under "_keys" to check their order
+func yamlPlain(v any) any {
+	switch v := v.(type) {
+	case *yamlMap:
+		m := map[string]any{"_keys": strings.Join(v.keys, ",")}
+		for key, val := range v.values {
+			m[key] = yamlPlain(val)
+		}
+		return m
+	case []any:
+		items := make([]any, len(v))
+		for i, item := range v {
+			items[i] = yamlPlain(item)
+		}
+		return items
+	}
+	return v
+}
+
+func TestParseYAML(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		want any
+	}{
+		{
+			name: "scalars",
+			yaml: "a: 1\nb: \"two\"\nc: 'three'\nd: ~\ne:\nf: true\n",
+			want: map[string]any{
+				"_keys": "a,b,c,d,e,f",
+				"a":     "1", "b": "two", "c": "three", "d": nil, "e": nil,
+				"f": "true",
+			},
+		},
+		{
+			name: "block sequence",
+			yaml: "list:\n  - a\n  - b # comment\n  -\n    c: d\n",
+			want: map[string]any{
+				"_keys": "list",
+				"list": []any{
+					"a", "b", map[string]any{"_keys": "c", "c": "d"},
+				},
+			},
+		},
+		{
+			name: "flow collections",
+			yaml: "list: [a, \"b c\", [d]]\nmap: {x: 1, y: [2, 3]}\n",
+			want: map[string]any{
+				"_keys": "list,map",
+				"list":  []any{"a", "b c", []any{"d"}},
+				"map": map[string]any{
+					"_keys": "x,y", "x": "1", "y": []any{"2", "3"},
+				},
+			},
+		},
+		{
+			name: "literal block scalar",
+			yaml: "cmd: |\n  line 1\n    line 2\n\n  line 3\nnext: x\n",
+			want: map[string]any{
+				"_keys": "cmd,next",
+				"cmd":   "line 1\n  line 2\n\nline 3\n",
+				"next":  "x",
+			},
+		},
+		{
+			name: "folded block scalar",
+			yaml: "cmd: >-\n  sh -c\n  'echo hi'\n",
+			want: map[string]any{"_keys": "cmd", "cmd": "sh -c 'echo hi'"},
+		},
+		{
+			name: "anchors and aliases",
+			yaml: "a: &x [1, 2]\nb: *x\n",
+			want: map[string]any{
+				"_keys": "a,b", "a": []any{"1", "2"}, "b": []any{"1", "2"},
+			},
+		},
+		{
+			name: "merge keys",
+			yaml: "base: &base\n  a: 1\n  b: 2\n" +
+				"other: &other\n  c: 3\n" +
+				"m:\n  <<: [*base, *other]\n  b: 20\n",
+			want: map[string]any{
+				"_keys": "base,other,m",
+				"base":  map[string]any{"_keys": "a,b", "a": "1", "b": "2"},
+				"other": map[string]any{"_keys": "c", "c": "3"},
+				"m": map[string]any{
+					"_keys": "b,a,c", "a": "1", "b": "20", "c": "3",
+				},
+			},
+		},
+		{
+			name: "empty",
+			yaml: "# nothing\n",
+			want: nil,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			v, err := parseYAML([]byte(test.yaml))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := yamlPlain(v); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %#v, want %#v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseYAMLErrors(t *testing.T) {
+	tests := map[string]string{
+		"duplicate key":     "a: 1\na: 2\n",
+		"merge non-mapping": "a: &x [1]\nb:\n  <<: *x\n",
+		"bad indentation":   "a:\n  b: 1\n c: 2\n",
+		"unclosed flow":     "a: [1, 2\n",
+		"recursive alias":   "a: &x\n  - *x\n",
+	}
+	for name, yaml := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := parseYAML([]byte(yaml)); err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
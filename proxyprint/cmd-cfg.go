@@ -24,6 +24,7 @@ func makeCmd() *cobra.Command {
 		Long:  "Generate a blank config file to populate. NOTE: the file is generated with mostly invalid values which must be changed or deleted.",
 		Run:   runCfg,
 	})
+	cmd.AddCommand(makeReplayCmd())
 
 	flags := cmd.Flags()
 
@@ -45,13 +46,15 @@ func makeCmd() *cobra.Command {
 		&config.ClientPrint,
 		"client-print",
 		"Set the client data print (0 = off*, 1 = as string, "+
-			"2 = as bytes, 3 = as lower hex bytestring, 4 = as upper hex bytestring)",
+			"2 = as bytes, 3 = as lower hex bytestring, 4 = as upper hex bytestring, "+
+			"5 = as decoded HTTP/1.x requests)",
 	)
 	flags.Var(
 		&config.ServerPrint,
 		"server-print",
 		"Set the server data print (0 = off*, 1 = as string, "+
-			"2 = as bytes, 3 = as lower hex bytestring, 4 = as upper hex bytestring)",
+			"2 = as bytes, 3 = as lower hex bytestring, 4 = as upper hex bytestring, "+
+			"5 = as decoded HTTP/1.x responses, paired with their requests)",
 	)
 	flags.StringVar(
 		&config.ClientPrintFile,
@@ -108,6 +111,13 @@ func makeCmd() *cobra.Command {
 		&config.Log,
 		"log", "", "File to output logs to (blank is command line)",
 	)
+	flags.StringVar(
+		&config.Record,
+		"record",
+		"",
+		"File to record the traffic of every connection to "+
+			"(can be replayed with the replay subcommand)",
+	)
 	flags.StringVar(
 		&config.MonitorServer,
 		"monitor-server",
@@ -136,6 +146,7 @@ type Config struct {
 	RequirePwdEnvExists bool        `json:"requirePwdEnvExists,omitempty"`
 	Log                 string      `json:"log,omitempty"`
 	MonitorServer       string      `json:"monitorServer,omitempty"`
+	Record              string      `json:"record,omitempty"`
 }
 type ConfigPtrs struct {
 	Listen              *string      `json:"listen,omitempty"`
@@ -153,6 +164,7 @@ type ConfigPtrs struct {
 	RequirePwdEnvExists *bool        `json:"requirePwdEnvExists,omitempty"`
 	Log                 *string      `json:"log,omitempty"`
 	MonitorServer       *string      `json:"monitorServer,omitempty"`
+	Record              *string      `json:"record,omitempty"`
 }
 
 func (c *Config) FillEmptyFrom(other *Config) {
@@ -203,6 +215,9 @@ func (c *Config) FillEmptyFrom(other *Config) {
 	if c.MonitorServer == "" {
 		c.MonitorServer = other.MonitorServer
 	}
+	if c.Record == "" {
+		c.Record = other.Record
+	}
 }
 
 func checkFlagSet(flags *pflag.FlagSet, name string) bool {
@@ -261,6 +276,9 @@ func (c *Config) PopulateCheckFlags(other *ConfigPtrs, flags *pflag.FlagSet) {
 	if other.MonitorServer != nil && !checkFlagSet(flags, "monitor-server") {
 		c.MonitorServer = *other.MonitorServer
 	}
+	if other.Record != nil && !checkFlagSet(flags, "record") {
+		c.Record = *other.Record
+	}
 }
 
 func runCfg(_ *cobra.Command, args []string) {
@@ -294,6 +312,7 @@ func runCfg(_ *cobra.Command, args []string) {
 		PwdEnvName:         "PROXYPRINT_PWD",
 		Log:                "PATH",
 		MonitorServer:      "IP:PORT",
+		Record:             "PATH",
 	}
 	if err := enc.Encode(config); err != nil {
 		log.Fatal("error writing config file: ", err)
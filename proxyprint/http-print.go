@@ -0,0 +1,431 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+const (
+	// Max bytes of a (decoded) body shown when printing HTTP messages.
+	httpBodyPreview = 1024
+	// Max bytes buffered for decoding in each direction of a connection.
+	// Decoding stops for the direction if it falls further behind.
+	httpMaxBacklog = 16 << 20
+)
+
+var (
+	errHTTPBacklog = errors.New("decoding fell too far behind")
+	errHTTPStopped = errors.New("decoding stopped")
+)
+
+// Decodes the traffic of a connection into HTTP/1.x messages, printing the
+// requests (if printClient) and responses (if printServer). Each response is
+// printed with the request it's for. Both directions are decoded even if only
+// one is printed since responses can only be decoded knowing their requests.
+// Decoding stops for good once the connection switches protocols (e.g., to
+// websockets) or a direction can't be decoded.
+type httpPrinter struct {
+	clientAddr, serverAddr   string
+	printClient, printServer bool
+
+	client, server *httpStream
+	// Requests waiting for responses, in order (closed once no more requests
+	// will be decoded)
+	exchanges chan *httpExchange
+}
+
+// A request waiting for its response
+type httpExchange struct {
+	num          int
+	method, line string
+	// Receives whether the connection switched protocols after the response
+	done chan bool
+}
+
+func newHTTPPrinter(
+	clientAddr, serverAddr string, printClient, printServer bool,
+) *httpPrinter {
+	hp := &httpPrinter{
+		clientAddr:  clientAddr,
+		serverAddr:  serverAddr,
+		printClient: printClient,
+		printServer: printServer,
+		client:      newHTTPStream(),
+		server:      newHTTPStream(),
+		exchanges:   make(chan *httpExchange, 64),
+	}
+	go hp.decodeRequests()
+	go hp.decodeResponses()
+	return hp
+}
+
+// Returns a PrintFunc which calls pf and then feeds the data to the decoder.
+func (hp *httpPrinter) wrap(pf PrintFunc, server bool) PrintFunc {
+	stream := hp.client
+	if server {
+		stream = hp.server
+	}
+	return func(b []byte, from, to string, fromServer bool) {
+		pf(b, from, to, fromServer)
+		stream.write(b)
+	}
+}
+
+// Closes both directions once the connection is closed. Any data already
+// received is still decoded.
+func (hp *httpPrinter) close() {
+	hp.client.close()
+	hp.server.close()
+}
+
+func (hp *httpPrinter) decodeRequests() {
+	defer close(hp.exchanges)
+	br := bufio.NewReader(hp.client)
+	for num := 1; ; num++ {
+		req, err := http.ReadRequest(br)
+		if err == nil && req.ProtoMajor != 1 {
+			err = fmt.Errorf("unsupported protocol: %s", req.Proto)
+		}
+		if err != nil {
+			hp.stop(hp.client, false, err)
+			return
+		}
+		ex := &httpExchange{
+			num:    num,
+			method: req.Method,
+			line:   req.Method + " " + req.RequestURI,
+			done:   make(chan bool, 1),
+		}
+		body, err := readHTTPBody(req.Body, req.Header)
+		if hp.printClient {
+			var sb strings.Builder
+			sb.WriteString(ex.line + " " + req.Proto + "\n")
+			if req.Host != "" {
+				sb.WriteString("Host: " + req.Host + "\n")
+			}
+			writeHTTPHead(&sb, req.Header, req.TransferEncoding)
+			body.writeTo(&sb)
+			hp.print(fmt.Sprintf("HTTP request #%d", num), sb.String(), false)
+		}
+		if err != nil {
+			hp.stop(hp.client, false, err)
+			return
+		}
+		hp.exchanges <- ex
+		if req.Method == http.MethodConnect || req.Header.Get("Upgrade") != "" {
+			// What follows may not be HTTP, depending on the response
+			if <-ex.done {
+				hp.client.stop()
+				return
+			}
+		}
+	}
+}
+
+func (hp *httpPrinter) decodeResponses() {
+	// Unblocks the requests decoder if it's waiting on a response
+	defer func() {
+		for ex := range hp.exchanges {
+			ex.done <- false
+		}
+	}()
+	br := bufio.NewReader(hp.server)
+	for {
+		ex := <-hp.exchanges
+		if !hp.decodeResponse(br, ex) {
+			return
+		}
+	}
+}
+
+// Decodes the response (and any preceding informational responses) to the
+// request, which is nil if there isn't one. Returns false if decoding should
+// stop.
+func (hp *httpPrinter) decodeResponse(br *bufio.Reader, ex *httpExchange) bool {
+	var req *http.Request
+	title := "HTTP response (no matching request)"
+	if ex != nil {
+		req = &http.Request{Method: ex.method}
+		title = fmt.Sprintf("HTTP response to #%d %s", ex.num, ex.line)
+	}
+	upgraded := false
+	defer func() {
+		if ex != nil {
+			ex.done <- upgraded
+		}
+	}()
+	for {
+		// ReadResponse reports the connection closing before a response as
+		// an unexpected EOF
+		if _, err := br.Peek(1); err != nil {
+			hp.stop(hp.server, true, err)
+			return false
+		}
+		resp, err := http.ReadResponse(br, req)
+		if err == nil && resp.ProtoMajor != 1 {
+			err = fmt.Errorf("unsupported protocol: %s", resp.Proto)
+		}
+		if err != nil {
+			hp.stop(hp.server, true, err)
+			return false
+		}
+		body, err := readHTTPBody(resp.Body, resp.Header)
+		upgraded = resp.StatusCode == http.StatusSwitchingProtocols ||
+			(req != nil && req.Method == http.MethodConnect &&
+				resp.StatusCode >= 200 && resp.StatusCode < 300)
+		if hp.printServer {
+			var sb strings.Builder
+			sb.WriteString(resp.Proto + " " + resp.Status + "\n")
+			writeHTTPHead(&sb, resp.Header, resp.TransferEncoding)
+			body.writeTo(&sb)
+			if upgraded {
+				sb.WriteString("\n(switched protocols, no longer decoding HTTP)\n")
+			}
+			hp.print(title, sb.String(), true)
+		}
+		if err != nil {
+			hp.stop(hp.server, true, err)
+			return false
+		} else if upgraded {
+			hp.server.stop()
+			return false
+		} else if resp.StatusCode >= 200 {
+			return true
+		}
+		// Informational (1xx) responses are followed by the final response
+	}
+}
+
+// Stops decoding the direction because of err, printing err unless the
+// connection just closed
+func (hp *httpPrinter) stop(stream *httpStream, server bool, err error) {
+	stream.stop()
+	if err == io.EOF || err == errHTTPStopped ||
+		(server && !hp.printServer) || (!server && !hp.printClient) {
+		return
+	}
+	hp.print(
+		"HTTP decoding stopped",
+		fmt.Sprintf("stopped decoding HTTP/1.x: %v\n", err),
+		server,
+	)
+}
+
+func (hp *httpPrinter) print(title, content string, server bool) {
+	from, to := hp.clientAddr, hp.serverAddr
+	if server {
+		from, to = to, from
+	}
+	printChan <- PrintData{
+		msg: fmt.Sprintf(
+			"%s => %s (%s)\n"+
+				"-------------------\n"+
+				"%s"+
+				"===================\n",
+			from, to, title, content,
+		),
+		server: server,
+	}
+}
+
+// Writes the headers (sorted by name), followed by a blank line
+func writeHTTPHead(sb *strings.Builder, header http.Header, te []string) {
+	if len(te) != 0 {
+		header = header.Clone()
+		header["Transfer-Encoding"] = te
+	}
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, value := range header[name] {
+			sb.WriteString(name + ": " + value + "\n")
+		}
+	}
+	sb.WriteString("\n")
+}
+
+// A summary of a message's body
+type httpBody struct {
+	// Size of the body as sent and, if it was gzipped, decoded
+	size, decodedSize int64
+	gzipped           bool
+	// Start of the (decoded) body
+	preview []byte
+	// Error decoding the gzipped body
+	gzipErr error
+}
+
+// Reads the whole body, returning its summary. The error is from reading the
+// body (e.g., if the connection closed early).
+func readHTTPBody(body io.ReadCloser, header http.Header) (httpBody, error) {
+	defer body.Close()
+	cr := &countingReader{r: body}
+	b := httpBody{gzipped: header.Get("Content-Encoding") == "gzip"}
+	var src io.Reader = cr
+	var decoded *countingReader
+	if b.gzipped {
+		gz, err := gzip.NewReader(cr)
+		if err != nil {
+			b.gzipErr = err
+		} else {
+			decoded = &countingReader{r: gz}
+			src = decoded
+		}
+	}
+	if b.gzipErr == nil {
+		var err error
+		b.preview, err = io.ReadAll(io.LimitReader(src, httpBodyPreview))
+		if err == nil {
+			_, err = io.Copy(io.Discard, src)
+		}
+		if err != nil && decoded != nil {
+			b.gzipErr = err
+		}
+	}
+	io.Copy(io.Discard, cr)
+	b.size = cr.n
+	if decoded != nil {
+		b.decodedSize = decoded.n
+	}
+	if b.gzipped && b.size == 0 {
+		b.gzipErr = nil
+	}
+	return b, cr.err
+}
+
+func (b httpBody) writeTo(sb *strings.Builder) {
+	switch {
+	case b.size == 0:
+		sb.WriteString("(no body)\n")
+		return
+	case b.gzipErr != nil:
+		fmt.Fprintf(sb, "(%d bytes, gzip: error decoding: %v)\n", b.size, b.gzipErr)
+		return
+	case b.gzipped:
+		fmt.Fprintf(sb, "(%d bytes, gzip: %d bytes decoded", b.size, b.decodedSize)
+	default:
+		fmt.Fprintf(sb, "(%d bytes", b.size)
+	}
+	total := b.size
+	if b.gzipped {
+		total = b.decodedSize
+	}
+	if int64(len(b.preview)) < total {
+		fmt.Fprintf(sb, ", showing first %d", len(b.preview))
+	}
+	if isPrintableText(b.preview) {
+		sb.WriteString(")\n")
+		sb.Write(b.preview)
+		if !bytes.HasSuffix(b.preview, []byte("\n")) {
+			sb.WriteString("\n")
+		}
+	} else {
+		fmt.Fprintf(sb, ", as hex)\n%x\n", b.preview)
+	}
+}
+
+// Returns true if b is valid UTF-8 (except possibly for a rune cut off at the
+// end) without control characters other than whitespace
+func isPrintableText(b []byte) bool {
+	for len(b) != 0 {
+		r, size := utf8.DecodeRune(b)
+		if r == utf8.RuneError && size == 1 {
+			return !utf8.FullRune(b)
+		} else if r < 0x20 && r != '\n' && r != '\r' && r != '\t' || r == 0x7f {
+			return false
+		}
+		b = b[size:]
+	}
+	return true
+}
+
+type countingReader struct {
+	r   io.Reader
+	n   int64
+	err error
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	if err != nil && err != io.EOF {
+		cr.err = err
+	}
+	return n, err
+}
+
+// The data of one direction of a connection waiting to be decoded. Writes
+// never block (so decoding never holds up the proxying); data is dropped
+// once decoding is stopped.
+type httpStream struct {
+	buf    bytes.Buffer
+	closed bool
+	err    error
+	mtx    sync.Mutex
+	cond   *sync.Cond
+}
+
+func newHTTPStream() *httpStream {
+	s := &httpStream{}
+	s.cond = sync.NewCond(&s.mtx)
+	return s
+}
+
+func (s *httpStream) write(b []byte) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.closed || s.err != nil {
+		return
+	}
+	if s.buf.Len()+len(b) > httpMaxBacklog {
+		s.err = errHTTPBacklog
+		s.buf = bytes.Buffer{}
+	} else {
+		s.buf.Write(b)
+	}
+	s.cond.Signal()
+}
+
+func (s *httpStream) close() {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.closed = true
+	s.cond.Signal()
+}
+
+// Stops decoding, dropping any buffered and future data
+func (s *httpStream) stop() {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.err == nil {
+		s.err = errHTTPStopped
+	}
+	s.buf = bytes.Buffer{}
+	s.cond.Signal()
+}
+
+func (s *httpStream) Read(p []byte) (int, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	for s.buf.Len() == 0 && !s.closed && s.err == nil {
+		s.cond.Wait()
+	}
+	if s.err != nil {
+		return 0, s.err
+	} else if s.buf.Len() == 0 {
+		return 0, io.EOF
+	}
+	return s.buf.Read(p)
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Feeds the client's and server's data to an HTTP printer (each in the given
+// chunks) and returns the messages printed for each side
+func runHTTPPrinter(
+	t *testing.T, client, server []string, nClient, nServer int,
+) (clientMsgs, serverMsgs []string) {
+	t.Helper()
+	printChan = make(chan PrintData, 100)
+	defer func() { printChan = nil }()
+	hp := newHTTPPrinter("client", "server", true, true)
+	noPrint := func([]byte, string, string, bool) {}
+	clientPF, serverPF := hp.wrap(noPrint, false), hp.wrap(noPrint, true)
+	for _, b := range client {
+		clientPF([]byte(b), "client", "server", false)
+	}
+	for _, b := range server {
+		serverPF([]byte(b), "server", "client", true)
+	}
+	hp.close()
+
+	timeout := time.After(5 * time.Second)
+	for len(clientMsgs) < nClient || len(serverMsgs) < nServer {
+		select {
+		case data := <-printChan:
+			if data.server {
+				serverMsgs = append(serverMsgs, data.msg)
+			} else {
+				clientMsgs = append(clientMsgs, data.msg)
+			}
+		case <-timeout:
+			t.Fatalf(
+				"expected %d client and %d server messages, got:\n%s\n%s",
+				nClient, nServer,
+				strings.Join(clientMsgs, ""), strings.Join(serverMsgs, ""),
+			)
+		}
+	}
+	select {
+	case data := <-printChan:
+		t.Fatalf("unexpected message:\n%s", data.msg)
+	case <-time.After(50 * time.Millisecond):
+	}
+	return clientMsgs, serverMsgs
+}
+
+func checkContains(t *testing.T, msg string, wants ...string) {
+	t.Helper()
+	for _, want := range wants {
+		if !strings.Contains(msg, want) {
+			t.Errorf("expected message to contain %q:\n%s", want, msg)
+		}
+	}
+}
+
+func gzipString(t *testing.T, s string) string {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	if _, err := gw.Write([]byte(s)); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestHTTPPrinterPipelining(t *testing.T) {
+	gzipped := gzipString(t, strings.Repeat("compressed ", 10))
+	client := []string{
+		"GET /chunked HTTP/1.1\r\nHost: example.com\r\n\r\n" +
+			"HEAD /head HTTP/1.1\r\nHost: exam",
+		"ple.com\r\n\r\n" +
+			"GET /gzip HTTP/1.1\r\nHost: example.com\r\n" +
+			"Accept-Encoding: gzip\r\n\r\n",
+	}
+	server := []string{
+		"HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n" +
+			"6\r\nhello \r\n5\r\nwor",
+		"ld\r\n0\r\n\r\n" +
+			// Responses to HEAD requests have no body
+			"HTTP/1.1 200 OK\r\nContent-Length: 1000\r\n\r\n" +
+			"HTTP/1.1 200 OK\r\nContent-Encoding: gzip\r\n" +
+			"Content-Length: " + strconv.Itoa(len(gzipped)) + "\r\n\r\n" + gzipped,
+	}
+	clientMsgs, serverMsgs := runHTTPPrinter(t, client, server, 3, 3)
+
+	checkContains(t, clientMsgs[0],
+		"HTTP request #1", "GET /chunked HTTP/1.1", "Host: example.com",
+	)
+	checkContains(t, clientMsgs[1], "HTTP request #2", "HEAD /head HTTP/1.1")
+	checkContains(t, clientMsgs[2],
+		"HTTP request #3", "GET /gzip", "Accept-Encoding: gzip", "(no body)",
+	)
+
+	checkContains(t, serverMsgs[0],
+		"HTTP response to #1 GET /chunked", "Transfer-Encoding: chunked",
+		"(11 bytes)\nhello world\n",
+	)
+	checkContains(t, serverMsgs[1], "HTTP response to #2 HEAD /head", "(no body)")
+	checkContains(t, serverMsgs[2],
+		"HTTP response to #3 GET /gzip",
+		"gzip: 110 bytes decoded)\n"+strings.Repeat("compressed ", 10),
+	)
+}
+
+func TestHTTPPrinterInformational(t *testing.T) {
+	client := []string{
+		"POST /upload HTTP/1.1\r\nHost: example.com\r\nExpect: 100-continue\r\n" +
+			"Content-Length: 4\r\n\r\n",
+		"\x00\x01\x02\x03",
+	}
+	server := []string{
+		"HTTP/1.1 100 Continue\r\n\r\n",
+		"HTTP/1.1 201 Created\r\nContent-Length: 2\r\n\r\nok",
+	}
+	clientMsgs, serverMsgs := runHTTPPrinter(t, client, server, 1, 2)
+	checkContains(t, clientMsgs[0],
+		"POST /upload", "(4 bytes, as hex)\n00010203\n",
+	)
+	checkContains(t, serverMsgs[0],
+		"HTTP response to #1 POST /upload", "100 Continue",
+	)
+	checkContains(t, serverMsgs[1],
+		"HTTP response to #1 POST /upload", "201 Created", "ok",
+	)
+}
+
+func TestHTTPPrinterUpgrade(t *testing.T) {
+	client := []string{
+		"GET /ws HTTP/1.1\r\nHost: example.com\r\nConnection: Upgrade\r\n" +
+			"Upgrade: websocket\r\n\r\n",
+		"\x81\x85not http",
+	}
+	server := []string{
+		"HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\n" +
+			"Upgrade: websocket\r\n\r\n\x81\x02hi",
+	}
+	// Nothing is printed for the websocket frames
+	clientMsgs, serverMsgs := runHTTPPrinter(t, client, server, 1, 1)
+	checkContains(t, clientMsgs[0], "GET /ws", "Upgrade: websocket")
+	checkContains(t, serverMsgs[0],
+		"101 Switching Protocols", "(switched protocols, no longer decoding HTTP)",
+	)
+}
+
+func TestHTTPPrinterNotHTTP(t *testing.T) {
+	client := []string{"\x16\x03\x01\x02\x00\x01\x00\x01\xfc\x03\x03\r\n\r\n"}
+	server := []string{"HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n"}
+	// The response has no matching request (decoding requests stopped)
+	clientMsgs, serverMsgs := runHTTPPrinter(t, client, server, 1, 1)
+	checkContains(t, clientMsgs[0],
+		"HTTP decoding stopped", "stopped decoding HTTP/1.x",
+	)
+	checkContains(t, serverMsgs[0], "HTTP response (no matching request)")
+}
+
+func TestIsPrintableText(t *testing.T) {
+	tests := map[string]bool{
+		"":                  true,
+		"hello\r\n\tworld":  true,
+		"héllo":             true,
+		"cut off \xc3":      true,
+		"bad \xc3 in mid":   false,
+		"nul \x00":          false,
+		"del \x7f":          false,
+		"\x1b[31mred\x1b[m": false,
+	}
+	for s, want := range tests {
+		if got := isPrintableText([]byte(s)); got != want {
+			t.Errorf("%q: got %v, want %v", s, got, want)
+		}
+	}
+}
@@ -111,6 +111,13 @@ func run(cmd *cobra.Command, _ []string) {
 		}
 	}
 
+	if config.Record != "" {
+		recorder, err = NewRecorder(config.Record)
+		if err != nil {
+			log.Fatal("error creating capture file: ", err)
+		}
+	}
+
 	startedServer := false
 
 	if config.Listen != "" {
@@ -415,10 +422,32 @@ func handle(client *BufferedConn, num int) {
 		server = NewBufferedConn(srvr)
 	}
 
+	clientPF, serverPF := clientPrintFunc, serverPrintFunc
+	if config.ClientPrint == httpPrint || config.ServerPrint == httpPrint {
+		hp := newHTTPPrinter(
+			clientAddrStr, server.RemoteAddr().String(),
+			config.ClientPrint == httpPrint, config.ServerPrint == httpPrint,
+		)
+		defer hp.close()
+		clientPF, serverPF = hp.wrap(clientPF, false), hp.wrap(serverPF, true)
+	}
+	if recorder != nil {
+		connNum := recorder.Open(clientAddrStr, server.RemoteAddr().String())
+		defer recorder.Close(connNum)
+		clientPF = recorder.Wrap(clientPF, connNum, false)
+		serverPF = recorder.Wrap(serverPF, connNum, true)
+	}
+
+	// Both pipes must finish before returning so nothing is printed or
+	// recorded for the connection after it's closed (by the defers above).
+	// Either pipe finishing closes both conns, ending the other.
+	clientDone := make(chan struct{})
 	go func() {
-		pipe(client, server, clientPrintFunc, false)
+		defer close(clientDone)
+		pipe(client, server, clientPF, false)
 	}()
-	pipe(server, client, serverPrintFunc, true)
+	pipe(server, client, serverPF, true)
+	<-clientDone
 }
 
 // Only prints and closes both "from" and "to"
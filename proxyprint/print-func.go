@@ -55,6 +55,9 @@ func (p printStatus) printFunc() PrintFunc {
 		return lowerHexBytesPrintFunc
 	case upperHexBytesPrint:
 		return upperHexBytesPrintFunc
+	case httpPrint:
+		// Decoded per connection (see httpPrinter)
+		return noPrintFunc
 	}
 	log.Fatalln("unknown printStatus value:", p)
 	return nil
@@ -73,7 +76,8 @@ const (
 	bytesPrint         printStatus = 2
 	lowerHexBytesPrint printStatus = 3
 	upperHexBytesPrint printStatus = 4
-	stopValPrint       printStatus = 5 // Used for checking if values are in range
+	httpPrint          printStatus = 5
+	stopValPrint       printStatus = 6 // Used for checking if values are in range
 )
 
 func noPrintFunc([]byte, string, string, bool) {}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Capture file format (integers are big endian):
+//  1. Header (captureHeaderBytes), ending with the version
+//  2. Records, each with a type (1 byte), timestamp (8 bytes, Unix
+//     nanoseconds), connection number (8 bytes), data length (4 bytes), and
+//     data. Connection numbers start at 1 for each recording.
+//
+// Record types:
+//   - Open: a connection was proxied; the data is the client's and server's
+//     addresses, separated by a space
+//   - ClientData: data sent by the client
+//   - ServerData: data sent by the server
+//   - Close: the connection was closed (no data)
+var captureHeaderBytes = []byte{'P', 'P', 'C', 'A', 'P', 0, 0, 1}
+
+const (
+	recordOpen       byte = 1
+	recordClientData byte = 2
+	recordServerData byte = 3
+	recordClose      byte = 4
+
+	// Size of a record before its data
+	recordHeaderLen = 21
+	// Max length of a record's data. Larger data is split into multiple
+	// records, and capture files with larger records aren't read (they're
+	// corrupt and reading them could allocate up to 4 GiB per record).
+	maxRecordLen = 1 << 24
+)
+
+var recorder *Recorder
+
+// Records the traffic of every connection to a capture file
+type Recorder struct {
+	f        *os.File
+	mtx      sync.Mutex
+	failed   bool
+	nextConn atomic.Uint64
+}
+
+func NewRecorder(path string) (*Recorder, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Write(captureHeaderBytes); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &Recorder{f: f}, nil
+}
+
+// Records the opening of a connection, returning its number
+func (r *Recorder) Open(clientAddr, serverAddr string) uint64 {
+	num := r.nextConn.Add(1)
+	r.record(recordOpen, num, []byte(clientAddr+" "+serverAddr))
+	return num
+}
+
+func (r *Recorder) Close(num uint64) {
+	r.record(recordClose, num, nil)
+}
+
+// Returns a PrintFunc which records the data (sent by the server if server)
+// and then calls pf
+func (r *Recorder) Wrap(pf PrintFunc, num uint64, server bool) PrintFunc {
+	typ := recordClientData
+	if server {
+		typ = recordServerData
+	}
+	return func(b []byte, from, to string, fromServer bool) {
+		for data := b; len(data) != 0; {
+			n := len(data)
+			if n > maxRecordLen {
+				n = maxRecordLen
+			}
+			r.record(typ, num, data[:n])
+			data = data[n:]
+		}
+		pf(b, from, to, fromServer)
+	}
+}
+
+func (r *Recorder) record(typ byte, num uint64, data []byte) {
+	buf := make([]byte, recordHeaderLen, recordHeaderLen+len(data))
+	buf[0] = typ
+	binary.BigEndian.PutUint64(buf[9:], num)
+	binary.BigEndian.PutUint32(buf[17:], uint32(len(data)))
+	buf = append(buf, data...)
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if r.failed {
+		return
+	}
+	// Timestamped while locked so the records are in order
+	binary.BigEndian.PutUint64(buf[1:], uint64(time.Now().UnixNano()))
+	if _, err := r.f.Write(buf); err != nil {
+		r.failed = true
+		log.Printf("error writing to capture file (no longer recording): %v", err)
+	}
+}
+
+// A connection read from a capture file
+type CapturedConn struct {
+	Num                    uint64
+	ClientAddr, ServerAddr string
+	Start, End             time.Time
+	Chunks                 []CapturedChunk
+}
+
+type CapturedChunk struct {
+	Time   time.Time
+	Server bool
+	Data   []byte
+}
+
+// Returns the total bytes sent by the server (if server) or client
+func (cc *CapturedConn) Bytes(server bool) int {
+	n := 0
+	for _, chunk := range cc.Chunks {
+		if chunk.Server == server {
+			n += len(chunk.Data)
+		}
+	}
+	return n
+}
+
+// Reads the connections from a capture file, in the order they were opened.
+// A capture file cut short (e.g., if proxyprint was killed while recording)
+// is read up to the last complete record.
+func ReadCapture(path string) ([]*CapturedConn, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+
+	header := make([]byte, len(captureHeaderBytes))
+	if _, err := io.ReadFull(r, header); err != nil ||
+		!bytes.Equal(header[:5], captureHeaderBytes[:5]) {
+		return nil, fmt.Errorf("not a capture file")
+	} else if !bytes.Equal(header, captureHeaderBytes) {
+		return nil, fmt.Errorf(
+			"can only read capture version %v, got %v",
+			captureHeaderBytes[5:], header[5:],
+		)
+	}
+
+	var conns []*CapturedConn
+	byNum := make(map[uint64]*CapturedConn)
+	var head [recordHeaderLen]byte
+	for {
+		if _, err := io.ReadFull(r, head[:]); err != nil {
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				log.Print("capture file cut short, ignoring the last record")
+			} else if err != io.EOF {
+				return nil, err
+			}
+			break
+		}
+		typ := head[0]
+		t := time.Unix(0, int64(binary.BigEndian.Uint64(head[1:])))
+		num := binary.BigEndian.Uint64(head[9:])
+		dataLen := binary.BigEndian.Uint32(head[17:])
+		if dataLen > maxRecordLen {
+			return nil, fmt.Errorf(
+				"record too large (%d bytes), the capture file is corrupt",
+				dataLen,
+			)
+		}
+		data := make([]byte, dataLen)
+		if _, err := io.ReadFull(r, data); err != nil {
+			if errors.Is(err, io.ErrUnexpectedEOF) || err == io.EOF {
+				log.Print("capture file cut short, ignoring the last record")
+				break
+			}
+			return nil, err
+		}
+
+		cc := byNum[num]
+		if typ == recordOpen {
+			if cc != nil {
+				return nil, fmt.Errorf("connection %d opened twice", num)
+			}
+			cc = &CapturedConn{Num: num, Start: t}
+			cc.ClientAddr, cc.ServerAddr, _ = strings.Cut(string(data), " ")
+			byNum[num] = cc
+			conns = append(conns, cc)
+			continue
+		} else if cc == nil {
+			return nil, fmt.Errorf("record for unknown connection %d", num)
+		}
+		switch typ {
+		case recordClientData, recordServerData:
+			cc.Chunks = append(cc.Chunks, CapturedChunk{
+				Time: t, Server: typ == recordServerData, Data: data,
+			})
+		case recordClose:
+			cc.End = t
+		default:
+			return nil, fmt.Errorf("invalid record type: %d", typ)
+		}
+	}
+	return conns, nil
+}
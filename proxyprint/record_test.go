@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCaptureRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "capture")
+	r, err := NewRecorder(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var printed [][]byte
+	pf := func(b []byte, from, to string, fromServer bool) {
+		printed = append(printed, append([]byte(nil), b...))
+	}
+
+	num1 := r.Open("127.0.0.1:1000", "127.0.0.1:80")
+	num2 := r.Open("[::1]:2000", "[::1]:80")
+	client1, server1 := r.Wrap(pf, num1, false), r.Wrap(pf, num1, true)
+	client2 := r.Wrap(pf, num2, false)
+	client1([]byte("request"), "", "", false)
+	client2([]byte("other"), "", "", false)
+	server1([]byte("response"), "", "", true)
+	r.Close(num2)
+	// Data larger than a record is split
+	big := bytes.Repeat([]byte("x"), maxRecordLen+10)
+	server1(big, "", "", true)
+	r.Close(num1)
+	if err := r.f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(printed) != 4 || !bytes.Equal(printed[3], big) {
+		t.Errorf("expected the data to be passed on whole")
+	}
+
+	conns, err := ReadCapture(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(conns) != 2 {
+		t.Fatalf("expected 2 connections, got %d", len(conns))
+	}
+	cc1, cc2 := conns[0], conns[1]
+	if cc1.Num != num1 || cc1.ClientAddr != "127.0.0.1:1000" ||
+		cc1.ServerAddr != "127.0.0.1:80" {
+		t.Errorf(
+			"connection 1: got %d %s %s", cc1.Num, cc1.ClientAddr, cc1.ServerAddr,
+		)
+	}
+	if cc2.Num != num2 || cc2.ClientAddr != "[::1]:2000" ||
+		cc2.ServerAddr != "[::1]:80" {
+		t.Errorf(
+			"connection 2: got %d %s %s", cc2.Num, cc2.ClientAddr, cc2.ServerAddr,
+		)
+	}
+	if len(cc1.Chunks) != 4 {
+		t.Fatalf("connection 1: expected 4 chunks, got %d", len(cc1.Chunks))
+	}
+	for i, want := range []struct {
+		server bool
+		data   []byte
+	}{
+		{false, []byte("request")},
+		{true, []byte("response")},
+		{true, big[:maxRecordLen]},
+		{true, big[maxRecordLen:]},
+	} {
+		chunk := cc1.Chunks[i]
+		if chunk.Server != want.server || !bytes.Equal(chunk.Data, want.data) {
+			t.Errorf("connection 1: chunk %d doesn't match", i)
+		}
+	}
+	if got, want := cc1.Bytes(true), len("response")+len(big); got != want {
+		t.Errorf("connection 1: got %d server bytes, want %d", got, want)
+	} else if got := cc2.Bytes(false); got != len("other") {
+		t.Errorf("connection 2: got %d client bytes, want %d", got, len("other"))
+	}
+	if cc1.End.Before(cc2.End) || cc2.End.Before(cc2.Start) ||
+		cc1.Chunks[0].Time.Before(cc1.Start) {
+		t.Errorf("times are out of order")
+	}
+}
+
+// Writes a capture file with the header followed by the records
+func writeCapture(t *testing.T, records ...[]byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "capture")
+	data := append([]byte(nil), captureHeaderBytes...)
+	for _, record := range records {
+		data = append(data, record...)
+	}
+	if err := os.WriteFile(path, data, 0666); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// Returns a record with the data and the given length (which may not be the
+// data's)
+func makeRecord(typ byte, num uint64, dataLen uint32, data string) []byte {
+	buf := make([]byte, recordHeaderLen)
+	buf[0] = typ
+	binary.BigEndian.PutUint64(buf[9:], num)
+	binary.BigEndian.PutUint32(buf[17:], dataLen)
+	return append(buf, data...)
+}
+
+func TestReadCaptureCutShort(t *testing.T) {
+	open := makeRecord(recordOpen, 1, 3, "a b")
+	data := makeRecord(recordClientData, 1, 4, "data")
+	// The last record is cut off in its header and then in its data
+	for _, last := range [][]byte{data[:10], data[:recordHeaderLen+2]} {
+		conns, err := ReadCapture(writeCapture(t, open, data, last))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		} else if len(conns) != 1 || len(conns[0].Chunks) != 1 {
+			t.Errorf("expected 1 connection with 1 chunk")
+		}
+	}
+}
+
+func TestReadCaptureErrors(t *testing.T) {
+	open := makeRecord(recordOpen, 1, 3, "a b")
+	tests := map[string]string{
+		"too large": writeCapture(
+			t, open, makeRecord(recordClientData, 1, 1<<31, ""),
+		),
+		"unknown conn": writeCapture(
+			t, open, makeRecord(recordClientData, 2, 1, "x"),
+		),
+		"opened twice": writeCapture(t, open, open),
+		"bad type":     writeCapture(t, open, makeRecord(9, 1, 0, "")),
+	}
+	bad := filepath.Join(t.TempDir(), "bad")
+	os.WriteFile(bad, []byte("not a capture file"), 0666)
+	tests["not a capture"] = bad
+	version := filepath.Join(t.TempDir(), "version")
+	os.WriteFile(version, []byte{'P', 'P', 'C', 'A', 'P', 0, 0, 99}, 0666)
+	tests["version"] = version
+
+	for name, path := range tests {
+		if _, err := ReadCapture(path); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	utils "github.com/johnietre/utils/go"
+	"github.com/spf13/cobra"
+)
+
+type replayConfig struct {
+	Listen  string
+	Connect string
+	// Multiplier of the replay speed (0 means no delays)
+	Speed float64
+	// Max time to wait for expected data from the other side
+	Timeout time.Duration
+	// Connections to replay (all if empty)
+	Conns []uint
+	List  bool
+}
+
+func makeReplayCmd() *cobra.Command {
+	var cfg replayConfig
+	cmd := &cobra.Command{
+		Use:   "replay CAPTURE_FILE",
+		Short: "Replay a recorded session as a fake server or client",
+		Long: "Replay a session recorded with --record, acting as the server " +
+			"(with --listen) or the client (with --connect). The recorded data " +
+			"of the side being played is sent once the data the other side sent " +
+			"before it has been received, with the recorded delays (divided by " +
+			"--speed). Received data that differs from the recording is logged. " +
+			"As a server, each accepted connection replays the next recorded " +
+			"connection. As a client, the connections are made with the recorded " +
+			"delays between them.",
+		Args: cobra.ExactArgs(1),
+		Run: func(_ *cobra.Command, args []string) {
+			runReplay(args[0], &cfg)
+		},
+		DisableFlagsInUseLine: true,
+	}
+	flags := cmd.Flags()
+	flags.StringVar(
+		&cfg.Listen, "listen", "",
+		"Network address to listen for clients on (replaying the server)",
+	)
+	flags.StringVar(
+		&cfg.Connect, "connect", "",
+		"Network address of the server to connect to (replaying the client)",
+	)
+	flags.Float64Var(
+		&cfg.Speed, "speed", 1,
+		"Speed to replay at (e.g., 2 = twice as fast, 0 = without any delays)",
+	)
+	flags.DurationVar(
+		&cfg.Timeout, "timeout", time.Second*10,
+		"Max time to wait for the data the other side is expected to send",
+	)
+	flags.UintSliceVar(
+		&cfg.Conns, "conn", nil,
+		"Numbers of the recorded connections to replay (default all)",
+	)
+	flags.BoolVar(
+		&cfg.List, "list", false,
+		"List the recorded connections rather than replaying them",
+	)
+	return cmd
+}
+
+func runReplay(path string, cfg *replayConfig) {
+	conns, err := ReadCapture(path)
+	if err != nil {
+		log.Fatal("error reading capture file: ", err)
+	}
+	if len(cfg.Conns) != 0 {
+		selected := make(map[uint64]bool, len(cfg.Conns))
+		for _, num := range cfg.Conns {
+			selected[uint64(num)] = true
+		}
+		filtered := conns[:0]
+		for _, cc := range conns {
+			if selected[cc.Num] {
+				filtered = append(filtered, cc)
+			}
+		}
+		conns = filtered
+	}
+
+	if cfg.List {
+		listCaptured(conns)
+		return
+	} else if (cfg.Listen == "") == (cfg.Connect == "") {
+		log.Fatal("must provide either listen or connect addr")
+	} else if cfg.Speed < 0 {
+		log.Fatal("speed must be non-negative")
+	} else if cfg.Timeout <= 0 {
+		log.Fatal("timeout must be positive")
+	} else if len(conns) == 0 {
+		log.Fatal("no connections to replay")
+	}
+	if cfg.Listen != "" {
+		replayAsServer(conns, cfg)
+	} else {
+		replayAsClient(conns, cfg)
+	}
+}
+
+func listCaptured(conns []*CapturedConn) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(
+		w, "CONN\tCLIENT\tSERVER\tSTART\tDURATION\tCLIENT BYTES\tSERVER BYTES",
+	)
+	for _, cc := range conns {
+		duration := "-"
+		if !cc.End.IsZero() {
+			duration = cc.End.Sub(cc.Start).Round(time.Millisecond).String()
+		}
+		fmt.Fprintf(
+			w, "%d\t%s\t%s\t%s\t%s\t%d\t%d\n",
+			cc.Num, cc.ClientAddr, cc.ServerAddr,
+			cc.Start.Format("2006-01-02 15:04:05.000"), duration,
+			cc.Bytes(false), cc.Bytes(true),
+		)
+	}
+	w.Flush()
+}
+
+func replayAsServer(conns []*CapturedConn, cfg *replayConfig) {
+	ln, err := net.Listen("tcp", cfg.Listen)
+	if err != nil {
+		log.Fatal("error listening: ", err)
+	}
+	defer ln.Close()
+
+	fmt.Printf(
+		"Replaying %d connection(s) as the server on %s...\n",
+		len(conns), cfg.Listen,
+	)
+	var wg sync.WaitGroup
+	for _, cc := range conns {
+		c, err := ln.Accept()
+		if err != nil {
+			log.Fatal("error accepting: ", err)
+		}
+		wg.Add(1)
+		go func(cc *CapturedConn) {
+			defer wg.Done()
+			replayLogged(c, cc, true, cfg)
+		}(cc)
+	}
+	wg.Wait()
+}
+
+func replayAsClient(conns []*CapturedConn, cfg *replayConfig) {
+	fmt.Printf(
+		"Replaying %d connection(s) as the client to %s...\n",
+		len(conns), cfg.Connect,
+	)
+	var wg sync.WaitGroup
+	start, first := time.Now(), conns[0].Start
+	for _, cc := range conns {
+		delay := scaleDelay(cc.Start.Sub(first), cfg.Speed)
+		time.Sleep(time.Until(start.Add(delay)))
+		c, err := net.Dial("tcp", cfg.Connect)
+		if err != nil {
+			log.Printf("[conn %d] error connecting: %v", cc.Num, err)
+			continue
+		}
+		wg.Add(1)
+		go func(cc *CapturedConn) {
+			defer wg.Done()
+			replayLogged(c, cc, false, cfg)
+		}(cc)
+	}
+	wg.Wait()
+}
+
+func replayLogged(
+	c net.Conn, cc *CapturedConn, asServer bool, cfg *replayConfig,
+) {
+	if err := replayConn(c, cc, asServer, cfg); err != nil {
+		log.Printf("[conn %d] error replaying: %v", cc.Num, err)
+		return
+	}
+	log.Printf("[conn %d] replayed", cc.Num)
+}
+
+// Replays the server's (if asServer) or client's side of the connection over
+// c, closing c once done. Each recorded chunk of the side is sent once all
+// the data the other side sent before it has been received, after the
+// recorded delay since the previous chunk (either side's).
+func replayConn(
+	c net.Conn, cc *CapturedConn, asServer bool, cfg *replayConfig,
+) error {
+	var expected []byte
+	for _, chunk := range cc.Chunks {
+		if chunk.Server != asServer {
+			expected = append(expected, chunk.Data...)
+		}
+	}
+	peer := newReplayPeer(c, expected, cc.Num)
+	defer peer.stop()
+
+	// The recorded and replay times of the previous chunk
+	prevTime, prevReplayed := cc.Start, time.Now()
+	wantBytes := 0
+	for _, chunk := range cc.Chunks {
+		if chunk.Server != asServer {
+			wantBytes += len(chunk.Data)
+			if err := peer.waitFor(wantBytes, cfg.Timeout); err != nil {
+				return err
+			}
+		} else {
+			delay := scaleDelay(chunk.Time.Sub(prevTime), cfg.Speed)
+			time.Sleep(time.Until(prevReplayed.Add(delay)))
+			if _, err := utils.WriteAll(c, chunk.Data); err != nil {
+				return fmt.Errorf("error sending: %v", err)
+			}
+		}
+		prevTime, prevReplayed = chunk.Time, time.Now()
+	}
+	if !cc.End.IsZero() {
+		time.Sleep(time.Until(
+			prevReplayed.Add(scaleDelay(cc.End.Sub(prevTime), cfg.Speed)),
+		))
+	}
+	return nil
+}
+
+func scaleDelay(d time.Duration, speed float64) time.Duration {
+	if speed == 0 || d <= 0 {
+		return 0
+	}
+	return time.Duration(float64(d) / speed)
+}
+
+// Reads the data sent by the other side of a replayed connection, comparing
+// it with the recorded data
+type replayPeer struct {
+	conn net.Conn
+	// Number of bytes read in each read (closed once reading stops)
+	progress chan int
+	received int
+	err      error
+}
+
+func newReplayPeer(c net.Conn, expected []byte, num uint64) *replayPeer {
+	p := &replayPeer{conn: c, progress: make(chan int, 64)}
+	go func() {
+		defer close(p.progress)
+		buf := make([]byte, 1<<15)
+		offset, warned := 0, false
+		for {
+			n, err := c.Read(buf)
+			if n != 0 && !warned {
+				rest, got := expected[offset:], buf[:n]
+				if len(got) > len(rest) {
+					got = got[:len(rest)]
+				}
+				if i := mismatchIndex(got, rest); i != -1 {
+					log.Printf(
+						"[conn %d] received data differs from the recording at byte %d",
+						num, offset+i,
+					)
+					warned = true
+				} else if n > len(rest) {
+					log.Printf("[conn %d] received more data than recorded", num)
+					warned = true
+				}
+				offset += n
+			}
+			if n != 0 {
+				p.progress <- n
+			}
+			if err != nil {
+				p.err = err
+				return
+			}
+		}
+	}()
+	return p
+}
+
+// Returns the index of the first byte of got that differs from want
+func mismatchIndex(got, want []byte) int {
+	if bytes.HasPrefix(want, got) {
+		return -1
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			return i
+		}
+	}
+	return -1
+}
+
+// Waits until at least n bytes have been received in total
+func (p *replayPeer) waitFor(n int, timeout time.Duration) error {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for p.received < n {
+		select {
+		case m, ok := <-p.progress:
+			if !ok {
+				if shouldIgnoreErr(p.err) {
+					return fmt.Errorf(
+						"connection closed after %d of %d expected bytes",
+						p.received, n,
+					)
+				}
+				return fmt.Errorf("error receiving: %v", p.err)
+			}
+			p.received += m
+		case <-timer.C:
+			return fmt.Errorf(
+				"timed out waiting for data (received %d of %d expected bytes)",
+				p.received, n,
+			)
+		}
+	}
+	return nil
+}
+
+// Closes the connection, waiting for reading to stop
+func (p *replayPeer) stop() {
+	p.conn.Close()
+	for range p.progress {
+	}
+}
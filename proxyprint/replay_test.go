@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Records a connection with the given chunks (alternating between the
+// client's and server's, starting with the client's) and reads it back
+func recordConn(t *testing.T, chunks ...string) *CapturedConn {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "capture")
+	r, err := NewRecorder(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pf := func([]byte, string, string, bool) {}
+	num := r.Open("127.0.0.1:1000", "127.0.0.1:80")
+	client, server := r.Wrap(pf, num, false), r.Wrap(pf, num, true)
+	for i, chunk := range chunks {
+		if i%2 == 0 {
+			client([]byte(chunk), "", "", false)
+		} else {
+			server([]byte(chunk), "", "", true)
+		}
+	}
+	r.Close(num)
+	if err := r.f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	conns, err := ReadCapture(path)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(conns) != 1 {
+		t.Fatalf("expected 1 connection, got %d", len(conns))
+	}
+	return conns[0]
+}
+
+// Plays the other side of a replayed connection, sending each of sends after
+// reading each of the corresponding wants (which may be empty), and then
+// reading until the connection closes. Returns everything read.
+func playPeer(c net.Conn, sends, wants []string) <-chan string {
+	done := make(chan string, 1)
+	go func() {
+		defer c.Close()
+		var got bytes.Buffer
+		for i := range sends {
+			if sends[i] != "" {
+				if _, err := c.Write([]byte(sends[i])); err != nil {
+					break
+				}
+			}
+			buf := make([]byte, len(wants[i]))
+			n, _ := io.ReadFull(c, buf)
+			got.Write(buf[:n])
+		}
+		io.Copy(&got, c)
+		done <- got.String()
+	}()
+	return done
+}
+
+// Captures what's logged until the returned function is called
+func captureLog(t *testing.T) func() string {
+	t.Helper()
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	restored := false
+	restore := func() string {
+		if !restored {
+			log.SetOutput(os.Stderr)
+			restored = true
+		}
+		return buf.String()
+	}
+	t.Cleanup(func() { restore() })
+	return restore
+}
+
+func TestReplayConn(t *testing.T) {
+	cc := recordConn(t, "hello", "world", "bye", "ok")
+	cfg := &replayConfig{Speed: 0, Timeout: 5 * time.Second}
+
+	// As the server, the test plays the client
+	c1, c2 := net.Pipe()
+	done := playPeer(c2, []string{"hello", "bye"}, []string{"world", "ok"})
+	if err := replayConn(c1, cc, true, cfg); err != nil {
+		t.Fatalf("as server: unexpected error: %v", err)
+	}
+	if got := <-done; got != "worldok" {
+		t.Errorf("as server: got %q, want %q", got, "worldok")
+	}
+
+	// As the client, the test plays the server
+	c1, c2 = net.Pipe()
+	done = playPeer(c2, []string{"", "world", "ok"}, []string{"hello", "bye", ""})
+	if err := replayConn(c1, cc, false, cfg); err != nil {
+		t.Fatalf("as client: unexpected error: %v", err)
+	}
+	if got := <-done; got != "hellobye" {
+		t.Errorf("as client: got %q, want %q", got, "hellobye")
+	}
+}
+
+func TestReplayAsClient(t *testing.T) {
+	cc1 := recordConn(t, "one", "1")
+	cc2 := recordConn(t, "two", "2")
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	got := make(chan string, 2)
+	go func() {
+		for i := 0; i < 2; i++ {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				buf := make([]byte, 3)
+				if _, err := io.ReadFull(c, buf); err != nil {
+					got <- err.Error()
+					return
+				}
+				got <- string(buf)
+				c.Write(buf[:1])
+			}()
+		}
+	}()
+
+	logs := captureLog(t)
+	replayAsClient([]*CapturedConn{cc1, cc2}, &replayConfig{
+		Connect: ln.Addr().String(), Speed: 0, Timeout: 5 * time.Second,
+	})
+	if s := logs(); strings.Contains(s, "error") {
+		t.Errorf("unexpected errors:\n%s", s)
+	}
+	received := map[string]bool{<-got: true, <-got: true}
+	if !received["one"] || !received["two"] {
+		t.Errorf("expected both connections to be replayed, got %v", received)
+	}
+}
+
+func TestReplayConnMismatch(t *testing.T) {
+	cc := recordConn(t, "hello", "world")
+	cfg := &replayConfig{Speed: 0, Timeout: 5 * time.Second}
+	tests := []struct {
+		send, want string
+	}{
+		{"hellx", "differs from the recording at byte 4"},
+		{"hello!", "received more data than recorded"},
+	}
+	for _, test := range tests {
+		logs := captureLog(t)
+		c1, c2 := net.Pipe()
+		done := playPeer(c2, []string{test.send}, []string{"world"})
+		if err := replayConn(c1, cc, true, cfg); err != nil {
+			t.Errorf("%s: unexpected error: %v", test.send, err)
+		}
+		<-done
+		if s := logs(); !strings.Contains(s, test.want) {
+			t.Errorf("%s: expected log containing %q, got:\n%s", test.send, test.want, s)
+		}
+	}
+
+	// Too little data
+	c1, c2 := net.Pipe()
+	go func() {
+		c2.Write([]byte("hel"))
+		c2.Close()
+	}()
+	err := replayConn(c1, cc, true, cfg)
+	if err == nil || !strings.Contains(err.Error(), "closed after 3 of 5") {
+		t.Errorf("expected a closed connection error, got %v", err)
+	}
+	c1, c2 = net.Pipe()
+	defer c2.Close()
+	cfg.Timeout = 50 * time.Millisecond
+	err = replayConn(c1, cc, true, cfg)
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("expected a timeout error, got %v", err)
+	}
+}
+
+func TestReplaySpeed(t *testing.T) {
+	if got := scaleDelay(time.Second, 4); got != 250*time.Millisecond {
+		t.Errorf("got %s, want 250ms", got)
+	} else if got := scaleDelay(time.Second, 0.5); got != 2*time.Second {
+		t.Errorf("got %s, want 2s", got)
+	} else if got := scaleDelay(time.Second, 0); got != 0 {
+		t.Errorf("got %s with no delays", got)
+	} else if got := scaleDelay(-time.Second, 1); got != 0 {
+		t.Errorf("got %s for a negative delay", got)
+	}
+
+	// The server's chunk was sent 400ms after the connection opened
+	start := time.Now()
+	cc := &CapturedConn{
+		Num:   1,
+		Start: start,
+		End:   start.Add(400 * time.Millisecond),
+		Chunks: []CapturedChunk{
+			{Time: start.Add(400 * time.Millisecond), Server: true, Data: []byte("x")},
+		},
+	}
+	for _, test := range []struct {
+		speed    float64
+		min, max time.Duration
+	}{
+		{4, 100 * time.Millisecond, 300 * time.Millisecond},
+		{0, 0, 100 * time.Millisecond},
+	} {
+		c1, c2 := net.Pipe()
+		go io.Copy(io.Discard, c2)
+		begin := time.Now()
+		err := replayConn(c1, cc, true, &replayConfig{
+			Speed: test.speed, Timeout: time.Second,
+		})
+		elapsed := time.Since(begin)
+		c2.Close()
+		if err != nil {
+			t.Errorf("speed %g: unexpected error: %v", test.speed, err)
+		} else if elapsed < test.min || elapsed >= test.max {
+			t.Errorf(
+				"speed %g: took %s, expected between %s and %s",
+				test.speed, elapsed, test.min, test.max,
+			)
+		}
+	}
+}